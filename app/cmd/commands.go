@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"kentech-project/internal/adapters/export"
+	"kentech-project/internal/adapters/http/server"
+	"kentech-project/internal/adapters/repository/postgres"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/migrations"
+	"kentech-project/pkg/config"
+	"kentech-project/pkg/logger"
+
+	"github.com/google/uuid"
+)
+
+// runCommand runs a one-off command instead of the API server, e.g. `app reconcile -format csv`.
+func runCommand(ctx context.Context, name string, args []string, cfg *config.Config, db *sql.DB, log *logger.Logger) error {
+	switch name {
+	case "reconcile":
+		return reconcile(ctx, args, cfg, db, log)
+	case "export-transactions":
+		return exportTransactions(ctx, args, cfg, db, log)
+	case "migrate":
+		return migrate(ctx, args, db, log)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// reconcile runs a balance reconciliation and writes its report to stdout or to a file.
+func reconcile(ctx context.Context, args []string, cfg *config.Config, db *sql.DB, log *logger.Logger) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	formatName := flags.String("format", "json", "report format, json or csv")
+	output := flags.String("output", "", "report file, stdout when empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	format, ok := export.ParseFormat(*formatName, export.FormatJSON, export.FormatCSV)
+	if !ok {
+		return fmt.Errorf("unknown report format %q", *formatName)
+	}
+
+	reconciliation := server.NewServer(cfg, db, log).Reconciliation()
+	run, err := reconciliation.Run(ctx)
+	if err != nil {
+		return err
+	}
+	report, err := reconciliation.Report(ctx, run.ID)
+	if err != nil {
+		return err
+	}
+
+	w, closeOutput, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+	if err := export.WriteReconciliation(w, format, report); err != nil {
+		return err
+	}
+	log.Infof("Reconciliation report written: run_id=%s, users_checked=%d, discrepancies=%d", run.ID.String(), run.UsersChecked, run.Discrepancies)
+	return nil
+}
+
+// exportTransactions writes the transactions of a user, with the filters of the transaction history,
+// to stdout or to a file.
+func exportTransactions(ctx context.Context, args []string, cfg *config.Config, db *sql.DB, log *logger.Logger) error {
+	flags := flag.NewFlagSet("export-transactions", flag.ContinueOnError)
+	user := flags.String("user", "", "ID of the user")
+	formatName := flags.String("format", "csv", "export format, csv or ndjson")
+	output := flags.String("output", "", "export file, stdout when empty")
+	types := flags.String("type", "", "comma separated transaction types")
+	statuses := flags.String("status", "", "comma separated transaction statuses")
+	from := flags.String("from", "", "transactions created at or after this RFC 3339 time")
+	to := flags.String("to", "", "transactions created before this RFC 3339 time")
+	reference := flags.String("reference", "", "provider transaction ID")
+	minAmount := flags.String("min-amount", "", "minimum amount in the user currency")
+	maxAmount := flags.String("max-amount", "", "maximum amount in the user currency")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	userID, err := uuid.Parse(*user)
+	if err != nil {
+		return fmt.Errorf("invalid user ID %q", *user)
+	}
+	format, ok := export.ParseFormat(*formatName, export.FormatCSV, export.FormatNDJSON)
+	if !ok {
+		return fmt.Errorf("unknown export format %q", *formatName)
+	}
+
+	req := model.TransactionHistoryRequest{Reference: *reference, MinAmount: *minAmount, MaxAmount: *maxAmount}
+	for _, txType := range splitList(*types) {
+		req.Types = append(req.Types, model.TransactionType(txType))
+	}
+	for _, status := range splitList(*statuses) {
+		req.Statuses = append(req.Statuses, model.TransactionStatus(status))
+	}
+	if req.From, err = parseTime(*from); err != nil {
+		return err
+	}
+	if req.To, err = parseTime(*to); err != nil {
+		return err
+	}
+
+	w, closeOutput, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+	writer := export.NewTransactionWriter(w, format)
+	summary, err := server.NewServer(cfg, db, log).Players().ExportTransactions(ctx, userID, req, writer.Write)
+	if err != nil {
+		return err
+	}
+	if err := writer.Close(summary); err != nil {
+		return err
+	}
+	log.Infof("Transactions exported: user_id=%s, count=%d", userID.String(), summary.Count)
+	return nil
+}
+
+// openOutput opens the file a command writes to, stdout when path is empty.
+func openOutput(path string) (io.Writer, func(), error) {
+	if path == "" {
+		return os.Stdout, func() {}, nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, func() { file.Close() }, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q, expected RFC 3339", value)
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+// migrate applies the pending schema migrations (up), reverts the last ones (down -steps n) or lists
+// them (status).
+func migrate(ctx context.Context, args []string, db *sql.DB, log *logger.Logger) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down|status")
+	}
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	steps := flags.Int("steps", 1, "number of migrations to revert")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	migrator, err := postgres.NewMigrator(db, migrations.FS, log)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		log.Infof("Migrations applied: %d", applied)
+	case "down":
+		if *steps < 1 {
+			return fmt.Errorf("steps must be at least 1")
+		}
+		reverted, err := migrator.Down(ctx, *steps)
+		if err != nil {
+			return err
+		}
+		log.Infof("Migrations reverted: %d", reverted)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Migration.Version, s.Migration.Name, applied)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"kentech-project/internal/adapters/repository/wallet/fakewallet"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+)
+
+// accountFlags collects the repeated -account flags, formatted as userId:currency:balance.
+type accountFlags []string
+
+func (a *accountFlags) String() string {
+	return strings.Join(*a, ",")
+}
+
+func (a *accountFlags) Set(value string) error {
+	*a = append(*a, value)
+	return nil
+}
+
+func main() {
+	logger := logger.New()
+
+	var accounts accountFlags
+	addr := flag.String("addr", ":8000", "address to listen on")
+	apiKey := flag.String("api-key", "", "required x-api-key header, any key is accepted when empty")
+	duplicates := flag.String("duplicates", string(fakewallet.DuplicateReplay), "answer to a repeated reference: replay or apply")
+	latency := flag.Duration("latency", 0, "latency added to every response")
+	errorRate := flag.Float64("error-rate", 0, "fraction of the requests answered with 500")
+	timeoutRate := flag.Float64("timeout-rate", 0, "fraction of the requests never answered")
+	lostResponseRate := flag.Float64("lost-response-rate", 0, "fraction of the operations applied but answered with 500")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed of the random faults")
+	flag.Var(&accounts, "account", "account to create as userId:currency:balance, can be repeated")
+	flag.Parse()
+
+	mode := fakewallet.DuplicateMode(*duplicates)
+	switch mode {
+	case fakewallet.DuplicateReplay, fakewallet.DuplicateApply:
+	default:
+		log.Fatalf("Invalid -duplicates %q, expected replay or apply", *duplicates)
+	}
+
+	wallet := fakewallet.NewServer(*apiKey, mode, logger)
+	for _, account := range accounts {
+		userID, balance, err := parseAccount(account)
+		if err != nil {
+			log.Fatalf("Invalid -account %q: %v", account, err)
+		}
+		wallet.SetBalance(userID, balance)
+	}
+	wallet.SetFaults(fakewallet.Faults{
+		Latency:          *latency,
+		ErrorRate:        *errorRate,
+		TimeoutRate:      *timeoutRate,
+		LostResponseRate: *lostResponseRate,
+		Seed:             *seed,
+	})
+
+	srv := &http.Server{
+		Addr:    *addr,
+		Handler: wallet,
+	}
+	go func() {
+		logger.Infof("Starting fake wallet on %s with %d accounts", *addr, len(accounts))
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to start fake wallet: %v", err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// hanging requests only end with their client, close them instead of waiting
+	if err := srv.Shutdown(ctx); err != nil {
+		srv.Close()
+	}
+	logger.Info("Fake wallet exited")
+}
+
+func parseAccount(value string) (int, model.Money, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, model.Money{}, fmt.Errorf("expected userId:currency:balance")
+	}
+	userID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, model.Money{}, fmt.Errorf("invalid user id: %w", err)
+	}
+	balance, err := model.ParseMoney(parts[2], strings.ToUpper(parts[1]))
+	if err != nil {
+		return 0, model.Money{}, err
+	}
+	return userID, balance, nil
+}
@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"kentech-project/internal/adapters/http/server"
+	"kentech-project/internal/adapters/repository/postgres"
+	"kentech-project/migrations"
 	"kentech-project/pkg/config"
 	"kentech-project/pkg/database"
 	"kentech-project/pkg/logger"
@@ -29,6 +31,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
+	db.SetMaxOpenConns(cfg.DatabaseMaxOpenConns)
 	defer func(db *sql.DB) {
 		err := db.Close()
 		if err != nil {
@@ -38,6 +41,25 @@ func main() {
 		}
 	}(db)
 
+	if len(os.Args) > 1 {
+		if err := runCommand(context.Background(), os.Args[1], os.Args[2:], cfg, db, logger); err != nil {
+			logger.Errorf("Command %s failed: %v", os.Args[1], err)
+			db.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.MigrateOnStart {
+		migrator, err := postgres.NewMigrator(db, migrations.FS, logger)
+		if err != nil {
+			log.Fatalf("Failed to load migrations: %v", err)
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+	}
+
 	shutdown, err := trace.InitTracer("kentech-project")
 	if err != nil {
 		log.Fatalf("Failed to initialize trace: %v", err)
@@ -51,6 +73,15 @@ func main() {
 		Handler: serverInstance.Handler(),
 	}
 
+	recovery := serverInstance.RecoveryWorker()
+	if cfg.RecoveryEnabled {
+		recovery.Start(context.Background())
+	}
+	reconciliation := serverInstance.Reconciliation()
+	if cfg.ReconciliationEnabled {
+		reconciliation.Start(context.Background())
+	}
+
 	go func() {
 		logger.Info("Starting server on port " + cfg.Port)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -67,6 +98,13 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	if err := recovery.Stop(ctx); err != nil {
+		logger.Error("Recovery worker did not stop in time: " + err.Error())
+	}
+	if err := reconciliation.Stop(ctx); err != nil {
+		logger.Error("Reconciliation did not stop in time: " + err.Error())
+	}
+
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
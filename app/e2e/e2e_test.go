@@ -0,0 +1,328 @@
+package e2e
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"kentech-project/internal/adapters/repository/wallet/fakewallet"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/config"
+)
+
+func TestPlayerJourney(t *testing.T) {
+	h := newHarness(t)
+	p := h.newPlayer(10000)
+
+	anonymous := &player{h: h}
+	if status := anonymous.do(http.MethodGet, "/api/player/balance", nil, nil); status != http.StatusUnauthorized {
+		t.Fatalf("balance without token: status %d, want 401", status)
+	}
+	credentials := map[string]string{"username": p.username, "password": "wrong"}
+	if status := anonymous.do(http.MethodPost, "/api/auth/login", credentials, nil); status != http.StatusUnauthorized {
+		t.Fatalf("login with a wrong password: status %d, want 401", status)
+	}
+
+	bet, status := p.withdraw("25.50", "bet-1")
+	if status != http.StatusCreated || bet.Status != "COMPLETED" || bet.NewBalance.String() != "74.50" {
+		t.Fatalf("withdraw: status %d, response %+v", status, bet)
+	}
+	replay, status := p.withdraw("25.50", "bet-1")
+	if status != http.StatusCreated || replay.TransactionID != bet.TransactionID {
+		t.Fatalf("replayed withdraw: status %d, response %+v, want transaction %s", status, replay, bet.TransactionID)
+	}
+
+	win, status := p.deposit("40.00", "win-1", "bet-1")
+	if status != http.StatusCreated || win.Status != "WON" || win.NewBalance.String() != "114.50" {
+		t.Fatalf("deposit: status %d, response %+v", status, win)
+	}
+
+	if _, status := p.withdraw("10.00", "bet-2"); status != http.StatusCreated {
+		t.Fatalf("second withdraw: status %d", status)
+	}
+	var rollback transactionResponse
+	status = p.do(http.MethodPost, "/api/transactions/cancel", map[string]string{"provider_transaction_id": "bet-2"}, &rollback)
+	if status != http.StatusOK || rollback.NewBalance.String() != "114.50" {
+		t.Fatalf("cancel by reference: status %d, response %+v", status, rollback)
+	}
+
+	status = p.do(http.MethodPost, "/api/transactions/"+win.TransactionID+"/cancel", nil, &rollback)
+	if status != http.StatusOK || rollback.NewBalance.String() != "74.50" {
+		t.Fatalf("cancel by ID: status %d, response %+v", status, rollback)
+	}
+
+	// a withdraw arriving after its own cancel is refused
+	status = p.do(http.MethodPost, "/api/transactions/cancel", map[string]string{"provider_transaction_id": "bet-3"}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("cancel before withdraw: status %d", status)
+	}
+	if _, status := p.withdraw("5.00", "bet-3"); status == http.StatusCreated {
+		t.Fatal("withdraw after its cancel was accepted")
+	}
+
+	if got := p.walletBalance(); got != "74.50" {
+		t.Fatalf("wallet balance = %s, want 74.50", got)
+	}
+	if got := p.balance(); got != "74.50" {
+		t.Fatalf("balance = %s, want 74.50", got)
+	}
+
+	want := []historyTransaction{
+		{Type: "withdraw", Status: "canceled", Reference: "bet-3"},
+		{Type: "rollback", Status: "completed", Reference: "win-1"},
+		{Type: "rollback", Status: "completed", Reference: "bet-2"},
+		{Type: "withdraw", Status: "rolled_back", Reference: "bet-2"},
+		{Type: "deposit", Status: "rolled_back", Reference: "win-1"},
+		{Type: "withdraw", Status: "completed", Reference: "bet-1"},
+	}
+	history := p.history()
+	if len(history) != len(want) {
+		t.Fatalf("history has %d transactions, want %d: %+v", len(history), len(want), history)
+	}
+	for i, transaction := range history {
+		if transaction.Type != want[i].Type || transaction.Status != want[i].Status || transaction.Reference != want[i].Reference {
+			t.Errorf("history[%d] = %s %s %s, want %s %s %s", i, transaction.Type, transaction.Status,
+				transaction.Reference, want[i].Type, want[i].Status, want[i].Reference)
+		}
+	}
+}
+
+func TestParallelWithdraws(t *testing.T) {
+	const withdraws = 20
+	h := newHarness(t)
+	p := h.newPlayer(10000)
+
+	var wg sync.WaitGroup
+	statuses := make([]int, withdraws)
+	for i := range withdraws {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var resp transactionResponse
+			status, err := p.send(http.MethodPost, "/api/transactions/withdraw", withdrawRequest("10.00", fmt.Sprintf("bet-%d", i)), &resp)
+			if err != nil {
+				t.Errorf("withdraw %d: %v", i, err)
+			}
+			statuses[i] = status
+		}()
+	}
+	wg.Wait()
+
+	completed := 0
+	for i, status := range statuses {
+		switch status {
+		case http.StatusCreated:
+			completed++
+		case http.StatusConflict:
+			// refused by the service for lack of funds
+		default:
+			t.Errorf("withdraw %d: status %d", i, status)
+		}
+	}
+	if completed != 10 {
+		t.Fatalf("%d withdraws of 10.00 completed out of a balance of 100.00, want 10", completed)
+	}
+	if got := p.walletBalance(); got != "0.00" {
+		t.Fatalf("wallet balance = %s, want 0.00", got)
+	}
+	if got := p.storedBalance(); got != "0.00" {
+		t.Fatalf("stored balance = %s, want 0.00", got)
+	}
+	recorded := 0
+	for _, transaction := range p.history() {
+		if transaction.Status == "pending" {
+			t.Errorf("transaction %s left pending", transaction.Reference)
+		}
+		if transaction.Status == "completed" {
+			recorded++
+		}
+	}
+	if recorded != completed {
+		t.Fatalf("%d completed transactions recorded, want %d", recorded, completed)
+	}
+}
+
+// TestConcurrentPlayerOperations races bets, wins and cancels of one player. Every change of the
+// balance must reach both the wallet and the stored balance.
+func TestConcurrentPlayerOperations(t *testing.T) {
+	const bets = 30
+	h := newHarness(t)
+	p := h.newPlayer(5000)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	withdraws, wins, cancels := 0, 0, 0
+	for i := range bets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reference := fmt.Sprintf("bet-%d", i)
+			status, err := p.send(http.MethodPost, "/api/transactions/withdraw", withdrawRequest("5.00", reference), nil)
+			if err != nil || (status != http.StatusCreated && status != http.StatusConflict) {
+				t.Errorf("withdraw %d: status %d, err %v", i, status, err)
+				return
+			}
+			if status != http.StatusCreated {
+				return
+			}
+
+			var settled *int
+			if i%2 == 0 {
+				status, err = p.send(http.MethodPost, "/api/transactions/deposit", map[string]any{
+					"currency":                "USD",
+					"amount":                  json.Number("7.50"),
+					"provider_transaction_id": fmt.Sprintf("win-%d", i),
+					"provider_withdrawn_id":   reference,
+				}, nil)
+				settled = &wins
+			} else {
+				status, err = p.send(http.MethodPost, "/api/transactions/cancel", map[string]string{"provider_transaction_id": reference}, nil)
+				settled = &cancels
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			withdraws++
+			if err != nil || (status != http.StatusCreated && status != http.StatusOK) {
+				t.Errorf("settlement of bet %d: status %d, err %v", i, status, err)
+				return
+			}
+			*settled++
+		}()
+	}
+	wg.Wait()
+	if t.Failed() {
+		t.FailNow()
+	}
+
+	want := model.NewMoney(int64(5000-500*withdraws+750*wins+500*cancels), "USD").String()
+	if got := p.walletBalance(); got != want {
+		t.Fatalf("wallet balance = %s after %d withdraws, %d wins and %d cancels, want %s", got, withdraws, wins, cancels, want)
+	}
+	if got := p.storedBalance(); got != want {
+		t.Fatalf("stored balance = %s, want %s", got, want)
+	}
+	for _, req := range h.wallet.Requests() {
+		if req.Status == http.StatusBadRequest {
+			t.Errorf("wallet refused %s %s", req.Method, req.Path)
+		}
+	}
+	for _, transaction := range p.history() {
+		if transaction.Status == "pending" {
+			t.Errorf("transaction %s left pending", transaction.Reference)
+		}
+	}
+}
+
+func TestWalletOutages(t *testing.T) {
+	t.Run("errors are retried", func(t *testing.T) {
+		h := newHarness(t)
+		p := h.newPlayer(10000)
+		h.wallet.Script(fakewallet.Outcome{Status: http.StatusServiceUnavailable}, fakewallet.Outcome{Status: http.StatusBadGateway})
+
+		if _, status := p.withdraw("10.00", "bet-1"); status != http.StatusCreated {
+			t.Fatalf("withdraw: status %d", status)
+		}
+		if got := h.walletRequests("/withdraw"); got != 3 {
+			t.Fatalf("wallet received %d withdraws, want 3", got)
+		}
+		if got := p.walletBalance(); got != "90.00" {
+			t.Fatalf("wallet balance = %s, want 90.00", got)
+		}
+	})
+
+	t.Run("outage leaves the transaction pending until it is recovered", func(t *testing.T) {
+		h := newHarness(t)
+		p := h.newPlayer(10000)
+		outage := fakewallet.Outcome{Status: http.StatusServiceUnavailable}
+		h.wallet.Script(outage, outage, outage)
+
+		if _, status := p.withdraw("10.00", "bet-1"); status < http.StatusInternalServerError {
+			t.Fatalf("withdraw during outage: status %d, want 5xx", status)
+		}
+		if history := p.history(); len(history) != 1 || history[0].Status != "pending" {
+			t.Fatalf("history after outage = %+v, want one pending withdraw", history)
+		}
+		if _, status := p.withdraw("10.00", "bet-1"); status != http.StatusConflict {
+			t.Fatalf("retried withdraw while pending: status %d, want 409", status)
+		}
+
+		h.recoverPending()
+		if history := p.history(); len(history) != 1 || history[0].Status != "completed" {
+			t.Fatalf("history after recovery = %+v, want one completed withdraw", history)
+		}
+		if got := p.balance(); got != "90.00" {
+			t.Fatalf("balance = %s, want 90.00", got)
+		}
+		resp, status := p.withdraw("10.00", "bet-1")
+		if status != http.StatusCreated || resp.NewBalance.String() != "90.00" {
+			t.Fatalf("replayed withdraw: status %d, response %+v", status, resp)
+		}
+	})
+
+	t.Run("lost response is not applied twice", func(t *testing.T) {
+		h := newHarness(t)
+		p := h.newPlayer(10000)
+		h.wallet.Script(fakewallet.Outcome{Status: http.StatusInternalServerError, Applied: true})
+
+		resp, status := p.withdraw("10.00", "bet-1")
+		if status != http.StatusCreated || resp.NewBalance.String() != "90.00" {
+			t.Fatalf("withdraw: status %d, response %+v", status, resp)
+		}
+		if got := p.walletBalance(); got != "90.00" {
+			t.Fatalf("wallet balance = %s, want 90.00", got)
+		}
+	})
+
+	t.Run("hanging wallet times out", func(t *testing.T) {
+		h := newHarness(t, func(cfg *config.Config) {
+			cfg.WalletAttemptTimeout = 100 * time.Millisecond
+		})
+		p := h.newPlayer(10000)
+		h.wallet.Script(fakewallet.Outcome{Hang: true})
+
+		if _, status := p.withdraw("10.00", "bet-1"); status != http.StatusCreated {
+			t.Fatalf("withdraw: status %d", status)
+		}
+		if got := p.walletBalance(); got != "90.00" {
+			t.Fatalf("wallet balance = %s, want 90.00", got)
+		}
+	})
+
+	t.Run("open breaker degrades the service", func(t *testing.T) {
+		h := newHarness(t, func(cfg *config.Config) {
+			cfg.WalletMaxAttempts = 1
+			cfg.WalletBreakerWindowSize = 4
+			cfg.WalletBreakerMinRequests = 4
+		})
+		p := h.newPlayer(10000)
+		outage := fakewallet.Outcome{Status: http.StatusServiceUnavailable}
+		h.wallet.Script(outage, outage, outage, outage)
+
+		for i := range 4 {
+			if _, status := p.withdraw("10.00", fmt.Sprintf("bet-%d", i)); status < http.StatusInternalServerError {
+				t.Fatalf("withdraw %d during outage: status %d, want 5xx", i, status)
+			}
+		}
+
+		var health struct {
+			Status string `json:"status"`
+		}
+		if status := p.do(http.MethodGet, "/health", nil, &health); status != http.StatusOK || health.Status != "degraded" {
+			t.Fatalf("health: status %d, %+v, want degraded", status, health)
+		}
+		received := h.walletRequests("/withdraw")
+		if _, status := p.withdraw("10.00", "bet-4"); status != http.StatusServiceUnavailable {
+			t.Fatalf("withdraw with open breaker: status %d, want 503", status)
+		}
+		if got := h.walletRequests("/withdraw"); got != received {
+			t.Fatalf("wallet received %d withdraws with the breaker open", got-received)
+		}
+		if got := p.walletBalance(); got != "100.00" {
+			t.Fatalf("wallet balance = %s, want 100.00", got)
+		}
+	})
+}
@@ -0,0 +1,331 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"kentech-project/internal/adapters/http/server"
+	"kentech-project/internal/adapters/lock"
+	"kentech-project/internal/adapters/repository/memory"
+	"kentech-project/internal/adapters/repository/postgres"
+	"kentech-project/internal/adapters/repository/wallet/fakewallet"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/migrations"
+	"kentech-project/pkg/config"
+	"kentech-project/pkg/database"
+	"kentech-project/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	walletAPIKey = "e2e-wallet-key"
+	adminAPIKey  = "e2e-admin-key"
+	password     = "e2e-password"
+)
+
+// walletUserIDs hands out wallet accounts, unique across the harnesses of a run.
+var walletUserIDs atomic.Int64
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	if os.Getenv("LOG_LEVEL") == "" {
+		os.Setenv("LOG_LEVEL", "ERROR")
+	}
+	os.Exit(m.Run())
+}
+
+// harness serves the API over HTTP against a fake wallet, on the in-memory store or on the database
+// of TEST_DATABASE_URL when it is set.
+type harness struct {
+	t       *testing.T
+	url     string
+	wallet  *fakewallet.Server
+	storage server.Storage
+	server  *server.Server
+}
+
+func testConfig() *config.Config {
+	return &config.Config{
+		JWTSecret:               "e2e-secret",
+		WalletAPIKey:            walletAPIKey,
+		WalletMaxAttempts:       3,
+		WalletInitialBackoff:    time.Millisecond,
+		WalletMaxBackoff:        5 * time.Millisecond,
+		WalletBackoffMultiplier: 2,
+		WalletAttemptTimeout:    300 * time.Millisecond,
+		WalletRetryableStatuses: []int{500, 502, 503, 504},
+
+		WalletBreakerWindowSize:    20,
+		WalletBreakerMinRequests:   10,
+		WalletBreakerFailureRate:   0.5,
+		WalletBreakerCooldown:      time.Minute,
+		WalletBreakerHalfOpenCalls: 1,
+
+		RecoveryBatchSize:   10,
+		RecoveryMaxAttempts: 5,
+
+		DatabaseMaxOpenConns: 10,
+		PlayerLockTimeout:    5 * time.Second,
+
+		BalanceMode: "live",
+		AdminAPIKey: adminAPIKey,
+	}
+}
+
+// newHarness starts the API, configure changes the test configuration before it is built.
+func newHarness(t *testing.T, configure ...func(cfg *config.Config)) *harness {
+	t.Helper()
+	log := logger.New()
+	cfg := testConfig()
+	for _, c := range configure {
+		c(cfg)
+	}
+
+	fake := fakewallet.NewServer(walletAPIKey, fakewallet.DuplicateReplay, log)
+	walletServer := httptest.NewServer(fake)
+	t.Cleanup(walletServer.Close)
+	cfg.WalletURL = walletServer.URL
+
+	storage := newStorage(t, cfg, log)
+	srv := server.NewServerWith(cfg, storage, server.NewWalletClient(cfg, log), log)
+	apiServer := httptest.NewServer(srv.Handler())
+	t.Cleanup(apiServer.Close)
+
+	return &harness{t: t, url: apiServer.URL, wallet: fake, storage: storage, server: srv}
+}
+
+// recoverPending runs one pass of the recovery worker over every pending transaction.
+func (h *harness) recoverPending() {
+	h.server.RecoveryWorker().RunOnce(context.Background())
+}
+
+func newStorage(t *testing.T, cfg *config.Config, log *logger.Logger) server.Storage {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		store := memory.NewStore(log)
+		return server.Storage{
+			Users:           store.Users,
+			Transactions:    store.Transactions,
+			Bets:            store.Bets,
+			WalletAccounts:  store.WalletAccounts,
+			Ledger:          store.Ledger,
+			Reconciliations: store.Reconciliations,
+			UnitOfWork:      store,
+			PlayerLocks:     lock.NewLocalLocker(log),
+		}
+	}
+
+	db, err := database.NewPostgresConnection(url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(cfg.DatabaseMaxOpenConns)
+	migrator, err := postgres.NewMigrator(db, migrations.FS, log)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	truncate := `
+		TRUNCATE reconciliation_items, reconciliation_runs, journal_lines, journal_entries, ledger_accounts,
+		bets, transactions, users, wallet_accounts CASCADE
+	`
+	if _, err := db.ExecContext(ctx, truncate); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	return server.PostgresStorage(db, cfg.PlayerLockTimeout, log)
+}
+
+// player is a registered and logged in player, whose stored balance was synced with the wallet.
+type player struct {
+	h            *harness
+	username     string
+	token        string
+	walletUserID int
+}
+
+// newPlayer provisions a wallet account holding balance (in cents of USD) and signs a player up on it.
+func (h *harness) newPlayer(balance int64) *player {
+	h.t.Helper()
+	walletUserID := int(walletUserIDs.Add(1))
+	account := &model.WalletAccount{WalletUserID: walletUserID, Currency: "USD"}
+	if err := h.storage.WalletAccounts.Add(context.Background(), account); err != nil {
+		h.t.Fatalf("add wallet account: %v", err)
+	}
+	h.wallet.SetBalance(walletUserID, model.NewMoney(balance, "USD"))
+
+	p := &player{h: h, username: fmt.Sprintf("player%d", walletUserID), walletUserID: walletUserID}
+	register := map[string]string{
+		"username": p.username,
+		"email":    p.username + "@example.com",
+		"password": password,
+		"currency": "USD",
+	}
+	if status := p.do(http.MethodPost, "/api/auth/register", register, nil); status != http.StatusCreated {
+		h.t.Fatalf("register: status %d", status)
+	}
+	var login struct {
+		Token string `json:"token"`
+	}
+	credentials := map[string]string{"username": p.username, "password": password}
+	if status := p.do(http.MethodPost, "/api/auth/login", credentials, &login); status != http.StatusOK {
+		h.t.Fatalf("login: status %d", status)
+	}
+	p.token = login.Token
+
+	if got := p.balance(); got != model.NewMoney(balance, "USD").String() {
+		h.t.Fatalf("balance after sign up = %s, want %s", got, model.NewMoney(balance, "USD"))
+	}
+	return p
+}
+
+// do sends body as JSON and decodes the response into out when it is not nil. It returns the status.
+func (p *player) do(method, path string, body, out any) int {
+	p.h.t.Helper()
+	status, err := p.send(method, path, body, out)
+	if err != nil {
+		p.h.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return status
+}
+
+// send is do for the goroutines of a test, which must not stop it.
+func (p *player) send(method, path string, body, out any) (int, error) {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return 0, err
+		}
+	}
+	req, err := http.NewRequest(method, p.h.url+path, &payload)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < http.StatusBadRequest {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("decode response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// balance reads the balance of the player through the API, which syncs it from the wallet.
+func (p *player) balance() string {
+	p.h.t.Helper()
+	var balance struct {
+		Balance json.Number `json:"balance"`
+	}
+	if status := p.do(http.MethodGet, "/api/player/balance", nil, &balance); status != http.StatusOK {
+		p.h.t.Fatalf("balance: status %d", status)
+	}
+	return balance.Balance.String()
+}
+
+// walletBalance is the balance the wallet holds for the player.
+func (p *player) walletBalance() string {
+	p.h.t.Helper()
+	balance, ok := p.h.wallet.Balance(p.walletUserID)
+	if !ok {
+		p.h.t.Fatalf("wallet account %d not found", p.walletUserID)
+	}
+	return balance.String()
+}
+
+// storedBalance is the balance the API stored for the player, without syncing it from the wallet.
+func (p *player) storedBalance() string {
+	p.h.t.Helper()
+	user, err := p.h.storage.Users.GetByUsername(context.Background(), p.username)
+	if err != nil {
+		p.h.t.Fatalf("get user: %v", err)
+	}
+	return user.Balance.String()
+}
+
+type transactionResponse struct {
+	TransactionID         string      `json:"transaction_id"`
+	ProviderTransactionID string      `json:"provider_transaction_id"`
+	OldBalance            json.Number `json:"old_balance"`
+	NewBalance            json.Number `json:"new_balance"`
+	Status                string      `json:"status"`
+}
+
+func (p *player) withdraw(amount, reference string) (transactionResponse, int) {
+	p.h.t.Helper()
+	var resp transactionResponse
+	status := p.do(http.MethodPost, "/api/transactions/withdraw", withdrawRequest(amount, reference), &resp)
+	return resp, status
+}
+
+func withdrawRequest(amount, reference string) map[string]any {
+	return map[string]any{
+		"currency":                "USD",
+		"amount":                  json.Number(amount),
+		"provider_transaction_id": reference,
+	}
+}
+
+func (p *player) deposit(amount, reference, betReference string) (transactionResponse, int) {
+	p.h.t.Helper()
+	var resp transactionResponse
+	status := p.do(http.MethodPost, "/api/transactions/deposit", map[string]any{
+		"currency":                "USD",
+		"amount":                  json.Number(amount),
+		"provider_transaction_id": reference,
+		"provider_withdrawn_id":   betReference,
+	}, &resp)
+	return resp, status
+}
+
+type historyTransaction struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	Status    string      `json:"status"`
+	Reference string      `json:"reference"`
+	Amount    json.Number `json:"amount"`
+}
+
+// history returns the transactions of the player, newest first.
+func (p *player) history() []historyTransaction {
+	p.h.t.Helper()
+	var page struct {
+		Transactions []historyTransaction `json:"transactions"`
+	}
+	if status := p.do(http.MethodGet, "/api/player/transactions?limit=100", nil, &page); status != http.StatusOK {
+		p.h.t.Fatalf("history: status %d", status)
+	}
+	return page.Transactions
+}
+
+// walletRequests counts the operations the wallet received on path, e.g. "/withdraw".
+func (h *harness) walletRequests(suffix string) int {
+	count := 0
+	for _, req := range h.wallet.Requests() {
+		if strings.HasSuffix(req.Path, suffix) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,39 @@
+package export
+
+import "strings"
+
+// Format of an export.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatCSV  Format = "csv"
+	// FormatNDJSON writes one JSON document per line.
+	FormatNDJSON Format = "ndjson"
+)
+
+// ParseFormat returns the format named by s when it is one of formats, the first of formats when s
+// is empty.
+func ParseFormat(s string, formats ...Format) (Format, bool) {
+	if s == "" && len(formats) > 0 {
+		return formats[0], true
+	}
+	for _, format := range formats {
+		if Format(strings.ToLower(s)) == format {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// ContentType returns the MIME type of the format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/json"
+	}
+}
@@ -0,0 +1,59 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"kentech-project/internal/core/domain/model"
+	"strconv"
+	"strings"
+)
+
+var reconciliationHeader = []string{
+	"run_id", "user_id", "wallet_user_id", "currency", "stored_balance", "transactions_balance",
+	"wallet_balance", "issues", "wallet_error",
+}
+
+// WriteReconciliation writes a reconciliation report. JSON holds the run and its items, CSV one row
+// per item with the issues separated by semicolons.
+func WriteReconciliation(w io.Writer, format Format, report *model.ReconciliationReport) error {
+	if format == FormatCSV {
+		return writeReconciliationCSV(w, report)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+func writeReconciliationCSV(w io.Writer, report *model.ReconciliationReport) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(reconciliationHeader); err != nil {
+		return err
+	}
+	for _, item := range report.Items {
+		walletBalance := ""
+		if item.WalletBalance != nil {
+			walletBalance = item.WalletBalance.String()
+		}
+		issues := make([]string, len(item.Issues))
+		for i, issue := range item.Issues {
+			issues[i] = string(issue)
+		}
+		err := writer.Write([]string{
+			item.RunID.String(),
+			item.UserID.String(),
+			strconv.Itoa(item.WalletUserID),
+			item.Currency,
+			item.StoredBalance.String(),
+			item.TransactionsBalance.String(),
+			walletBalance,
+			strings.Join(issues, ";"),
+			item.WalletError,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
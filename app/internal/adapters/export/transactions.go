@@ -0,0 +1,123 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"kentech-project/internal/core/domain/model"
+	"strconv"
+	"time"
+)
+
+// TransactionWriter streams a transaction export: the transactions as they are read, then the
+// summary closing it. An export without its summary was interrupted.
+type TransactionWriter interface {
+	Write(transaction *model.Transaction) error
+	Close(summary *model.TransactionSummary) error
+}
+
+// NewTransactionWriter returns the writer of format, CSV or NDJSON.
+//
+// CSV starts every row with its record, "transaction" or "total", followed by one "total" row per
+// transaction type, status and currency. NDJSON writes a transaction per line and a last {"summary": ...} line.
+func NewTransactionWriter(w io.Writer, format Format) TransactionWriter {
+	if format == FormatCSV {
+		return &transactionCSVWriter{writer: csv.NewWriter(w)}
+	}
+	return &transactionNDJSONWriter{encoder: json.NewEncoder(w)}
+}
+
+var transactionHeader = []string{
+	"record", "id", "created_at", "type", "status", "currency", "amount", "game_currency", "game_amount",
+	"exchange_rate", "balance_before", "balance_after", "reference", "original_transaction_id",
+	"wallet_transaction_id", "failure_reason", "count",
+}
+
+type transactionCSVWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func (w *transactionCSVWriter) Write(transaction *model.Transaction) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	exchangeRate := ""
+	if transaction.ExchangeRate != nil {
+		exchangeRate = transaction.ExchangeRate.String()
+	}
+	originalTransactionID := ""
+	if transaction.OriginalTransactionID != nil {
+		originalTransactionID = transaction.OriginalTransactionID.String()
+	}
+	// balances are empty for transactions recorded before they were stored
+	balanceBefore, balanceAfter := "", ""
+	if transaction.BalanceBefore != nil {
+		balanceBefore = transaction.BalanceBefore.String()
+	}
+	if transaction.BalanceAfter != nil {
+		balanceAfter = transaction.BalanceAfter.String()
+	}
+	walletTransactionID := ""
+	if transaction.WalletTransactionID != nil {
+		walletTransactionID = strconv.Itoa(*transaction.WalletTransactionID)
+	}
+	return w.writer.Write([]string{
+		"transaction",
+		transaction.ID.String(),
+		transaction.CreatedAt.UTC().Format(time.RFC3339Nano),
+		string(transaction.Type),
+		string(transaction.Status),
+		transaction.Amount.Currency(),
+		transaction.Amount.String(),
+		transaction.GameAmount.Currency(),
+		transaction.GameAmount.String(),
+		exchangeRate,
+		balanceBefore,
+		balanceAfter,
+		transaction.Reference,
+		originalTransactionID,
+		walletTransactionID,
+		transaction.FailureReason,
+		"",
+	})
+}
+
+func (w *transactionCSVWriter) Close(summary *model.TransactionSummary) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	for _, total := range summary.Totals {
+		err := w.writer.Write([]string{
+			"total", "", "", string(total.Type), string(total.Status), total.Currency, total.Amount.String(),
+			"", "", "", "", "", "", "", "", "", strconv.Itoa(total.Count),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+func (w *transactionCSVWriter) writeHeader() error {
+	if w.headerWritten {
+		return nil
+	}
+	w.headerWritten = true
+	return w.writer.Write(transactionHeader)
+}
+
+type transactionNDJSONWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *transactionNDJSONWriter) Write(transaction *model.Transaction) error {
+	return w.encoder.Encode(transaction)
+}
+
+func (w *transactionNDJSONWriter) Close(summary *model.TransactionSummary) error {
+	return w.encoder.Encode(struct {
+		Summary *model.TransactionSummary `json:"summary"`
+	}{summary})
+}
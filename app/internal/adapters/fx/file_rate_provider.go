@@ -0,0 +1,73 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+	"os"
+)
+
+// fileRate is one entry of a rates file:
+//
+//	[{"base": "EUR", "quote": "KES", "rate": "140.25"}]
+type fileRate struct {
+	Base  string `json:"base"`
+	Quote string `json:"quote"`
+	Rate  string `json:"rate"`
+}
+
+// FileRateProvider serves exchange rates loaded from a JSON file, meant for local development.
+type FileRateProvider struct {
+	rates  map[string]*model.ExchangeRate
+	logger *logger.Logger
+}
+
+func NewFileRateProvider(path string, log *logger.Logger) (*FileRateProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rates file: %w", err)
+	}
+
+	var entries []fileRate
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse rates file: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat rates file: %w", err)
+	}
+
+	rates := make(map[string]*model.ExchangeRate, len(entries))
+	for _, entry := range entries {
+		rate, err := model.ParseRate(entry.Rate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate for %s/%s: %w", entry.Base, entry.Quote, err)
+		}
+		rates[rateKey(entry.Base, entry.Quote)] = &model.ExchangeRate{
+			Base:      entry.Base,
+			Quote:     entry.Quote,
+			Rate:      rate,
+			UpdatedAt: info.ModTime(),
+		}
+	}
+
+	log.Infof("Loaded %d exchange rates from %s", len(rates), path)
+	return &FileRateProvider{rates: rates, logger: log}, nil
+}
+
+func (p *FileRateProvider) GetRate(ctx context.Context, base, quote string) (*model.ExchangeRate, error) {
+	rate, ok := p.rates[rateKey(base, quote)]
+	if !ok {
+		p.logger.Debugf("Exchange rate not found: base=%s, quote=%s", base, quote)
+		return nil, model.ErrExchangeRateNotFound
+	}
+	copied := *rate
+	return &copied, nil
+}
+
+func rateKey(base, quote string) string {
+	return base + "/" + quote
+}
@@ -0,0 +1,172 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"kentech-project/internal/adapters/export"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/internal/core/domain/service"
+	"kentech-project/pkg/logger"
+	"net/http"
+	"strconv"
+)
+
+type AdminHandler struct {
+	accountService *service.WalletAccountService
+	reconService   *service.ReconciliationService
+	playerService  *service.PlayerService
+	logger         *logger.Logger
+}
+
+func NewAdminHandler(accountService *service.WalletAccountService, reconService *service.ReconciliationService, playerService *service.PlayerService, log *logger.Logger) *AdminHandler {
+	return &AdminHandler{
+		accountService: accountService,
+		reconService:   reconService,
+		playerService:  playerService,
+		logger:         log,
+	}
+}
+
+func (h *AdminHandler) ImportWalletAccountsGin(c *gin.Context) {
+	h.logger.Debug("ImportWalletAccounts endpoint called")
+
+	var req model.ImportWalletAccountsRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Accounts) == 0 {
+		h.logger.Warn("Invalid request body for wallet account import")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	response, err := h.accountService.Import(c.Request.Context(), req.Accounts)
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidWalletAccount) || errors.Is(err, model.ErrUnknownCurrency) {
+			h.logger.Warnf("Wallet account import rejected: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("Internal error during wallet account import: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *AdminHandler) ListWalletAccountsGin(c *gin.Context) {
+	h.logger.Debug("ListWalletAccounts endpoint called")
+
+	accounts, err := h.accountService.List(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Internal error listing wallet accounts: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"accounts": accounts})
+}
+
+func (h *AdminHandler) StartReconciliationGin(c *gin.Context) {
+	h.logger.Debug("StartReconciliation endpoint called")
+
+	run, err := h.reconService.Trigger(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, model.ErrReconciliationInProgress) {
+			h.logger.Warn("Reconciliation already in progress")
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "RECONCILIATION_IN_PROGRESS"})
+			return
+		}
+		h.logger.Error("Internal error starting reconciliation: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusAccepted, run)
+}
+
+func (h *AdminHandler) ListReconciliationsGin(c *gin.Context) {
+	h.logger.Debug("ListReconciliations endpoint called")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		h.logger.Warnf("Invalid limit for reconciliation runs: %s", c.Query("limit"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+		return
+	}
+
+	runs, err := h.reconService.ListRuns(c.Request.Context(), limit)
+	if err != nil {
+		h.logger.Error("Internal error listing reconciliation runs: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if runs == nil {
+		runs = make([]*model.ReconciliationRun, 0)
+	}
+	c.JSON(http.StatusOK, gin.H{"runs": runs})
+}
+
+func (h *AdminHandler) GetReconciliationGin(c *gin.Context) {
+	h.logger.Debug("GetReconciliation endpoint called")
+
+	report, ok := h.reconciliationReport(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// ExportReconciliationGin downloads a report as JSON or, with ?format=csv, as CSV.
+func (h *AdminHandler) ExportReconciliationGin(c *gin.Context) {
+	h.logger.Debug("ExportReconciliation endpoint called")
+
+	format, ok := export.ParseFormat(c.Query("format"), export.FormatJSON, export.FormatCSV)
+	if !ok {
+		h.logger.Warnf("Invalid export format: %s", c.Query("format"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
+	report, ok := h.reconciliationReport(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=reconciliation-%s.%s", report.Run.ID.String(), format))
+	c.Status(http.StatusOK)
+	if err := export.WriteReconciliation(c.Writer, format, report); err != nil {
+		h.logger.Error("Failed to write reconciliation export: " + err.Error())
+	}
+}
+
+func (h *AdminHandler) reconciliationReport(c *gin.Context) (*model.ReconciliationReport, bool) {
+	runID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.logger.Warnf("Invalid reconciliation run ID: %s", c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reconciliation run ID"})
+		return nil, false
+	}
+
+	report, err := h.reconService.Report(c.Request.Context(), runID)
+	if err != nil {
+		if errors.Is(err, model.ErrReconciliationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		h.logger.Error("Internal error fetching reconciliation report: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+	return report, true
+}
+
+// ExportUserTransactionsGin streams the transactions of any player, for support staff preparing statements.
+func (h *AdminHandler) ExportUserTransactionsGin(c *gin.Context) {
+	h.logger.Debug("ExportUserTransactions endpoint called")
+
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.logger.Warnf("Invalid user ID: %s", c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	exportTransactions(c, h.playerService, userID, h.logger)
+}
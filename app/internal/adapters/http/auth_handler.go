@@ -39,8 +39,13 @@ func (h *AuthHandler) RegisterGin(c *gin.Context) {
 			return
 		}
 		if err == model.ErrWalletUserIDExhausted {
-			h.logger.Warn("No more wallet user IDs available for registration")
-			c.JSON(http.StatusConflict, gin.H{"error": "No more wallet user IDs available"})
+			h.logger.Warnf("No wallet account available for registration: currency=%s", req.Currency)
+			c.JSON(http.StatusConflict, gin.H{"error": "No wallet account available"})
+			return
+		}
+		if err == model.ErrUnknownCurrency {
+			h.logger.Warnf("Unknown currency for registration: currency=%s", req.Currency)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 		h.logger.Error("Internal error during register: " + err.Error())
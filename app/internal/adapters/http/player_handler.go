@@ -2,14 +2,26 @@ package http
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"kentech-project/internal/adapters/export"
+	"kentech-project/internal/core/domain/model"
 	"kentech-project/internal/core/domain/service"
 	"kentech-project/pkg/logger"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
 type PlayerHandler struct {
 	playerService *service.PlayerService
 	logger        *logger.Logger
@@ -29,8 +41,18 @@ func (h *PlayerHandler) GetProfileGin(c *gin.Context) {
 	h.logger.Infof("Fetching profile for user_id=%s", userID.String())
 	user, err := h.playerService.GetProfile(c.Request.Context(), userID)
 	if err != nil {
-		h.logger.Warnf("User not found: user_id=%s", userID.String())
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		if errors.Is(err, model.ErrWalletUnavailable) {
+			h.logger.Warn("Wallet unavailable while fetching profile: " + err.Error())
+			writeWalletUnavailable(c, err)
+			return
+		}
+		if errors.Is(err, model.ErrUserNotFound) {
+			h.logger.Warnf("User not found: user_id=%s", userID.String())
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		h.logger.Error("Failed to fetch profile: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 	h.logger.Info("Profile fetched successfully")
@@ -42,14 +64,97 @@ func (h *PlayerHandler) GetTransactionHistoryGin(c *gin.Context) {
 
 	userID := getUserIDFromContext(c.Request.Context())
 	h.logger.Infof("Fetching transaction history for user_id=%s", userID.String())
-	transactions, err := h.playerService.GetTransactionHistory(c.Request.Context(), userID)
+	req, err := parseHistoryRequest(c)
 	if err != nil {
+		h.logger.Warnf("Invalid transaction history query: %s", err.Error())
+		writeHistoryError(c, err)
+		return
+	}
+	page, err := h.playerService.GetTransactionHistory(c.Request.Context(), userID, req)
+	if err != nil {
+		if writeHistoryError(c, err) {
+			h.logger.Warnf("Invalid transaction history query: %s", err.Error())
+			return
+		}
 		h.logger.Error("Failed to fetch transaction history: " + err.Error())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 	h.logger.Info("Transaction history fetched successfully")
-	c.JSON(http.StatusOK, transactions)
+	c.JSON(http.StatusOK, page)
+}
+
+// parseHistoryRequest reads the transaction history query: limit, cursor, type and status (comma
+// separated), from and to (RFC 3339), reference, min_amount and max_amount.
+func parseHistoryRequest(c *gin.Context) (model.TransactionHistoryRequest, error) {
+	req := model.TransactionHistoryRequest{
+		Reference: c.Query("reference"),
+		MinAmount: c.Query("min_amount"),
+		MaxAmount: c.Query("max_amount"),
+		Cursor:    c.Query("cursor"),
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultHistoryLimit)))
+	if err != nil || limit < 1 || limit > maxHistoryLimit {
+		return req, fmt.Errorf("%w: limit must be between 1 and %d", model.ErrInvalidFilter, maxHistoryLimit)
+	}
+	req.Limit = limit
+
+	for _, txType := range splitQuery(c.Query("type")) {
+		req.Types = append(req.Types, model.TransactionType(txType))
+	}
+	for _, status := range splitQuery(c.Query("status")) {
+		req.Statuses = append(req.Statuses, model.TransactionStatus(status))
+	}
+	if req.From, err = parseTimeQuery(c, "from"); err != nil {
+		return req, err
+	}
+	if req.To, err = parseTimeQuery(c, "to"); err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
+func splitQuery(value string) []string {
+	var parts []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+func parseTimeQuery(c *gin.Context, key string) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be an RFC 3339 time", model.ErrInvalidFilter, key)
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+// writeHistoryError writes the response for invalid history queries.
+func writeHistoryError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, model.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"code":  "INVALID_CURSOR",
+		})
+	case errors.Is(err, model.ErrInvalidFilter), errors.Is(err, model.ErrInvalidAmount), errors.Is(err, model.ErrAmountPrecision):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"code":  "INVALID_FILTER",
+		})
+	default:
+		return false
+	}
+	return true
 }
 
 func (h *PlayerHandler) GetBalanceGin(c *gin.Context) {
@@ -57,14 +162,41 @@ func (h *PlayerHandler) GetBalanceGin(c *gin.Context) {
 
 	userID := getUserIDFromContext(c.Request.Context())
 	h.logger.Infof("Fetching balance for user_id=%s", userID.String())
+	if c.Query("at") != "" {
+		h.getBalanceAt(c, userID)
+		return
+	}
 	balance, err := h.playerService.GetBalance(c.Request.Context(), userID)
 	if err != nil {
+		if errors.Is(err, model.ErrWalletUnavailable) {
+			h.logger.Warn("Wallet unavailable while fetching balance: " + err.Error())
+			writeWalletUnavailable(c, err)
+			return
+		}
 		h.logger.Error("Failed to fetch balance: " + err.Error())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 	h.logger.Info("Balance fetched successfully")
-	c.JSON(http.StatusOK, gin.H{"balance": balance})
+	c.JSON(http.StatusOK, balance)
+}
+
+// getBalanceAt returns the balance rebuilt from the ledger at the RFC 3339 time of the at parameter.
+func (h *PlayerHandler) getBalanceAt(c *gin.Context, userID uuid.UUID) {
+	at, err := time.Parse(time.RFC3339, c.Query("at"))
+	if err != nil {
+		h.logger.Warnf("Invalid balance time: %s", c.Query("at"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at must be an RFC 3339 time"})
+		return
+	}
+	balance, err := h.playerService.GetBalanceAt(c.Request.Context(), userID, at)
+	if err != nil {
+		h.logger.Error("Failed to fetch balance from the ledger: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	h.logger.Info("Ledger balance fetched successfully")
+	c.JSON(http.StatusOK, balance)
 }
 
 func getUserIDFromContext(ctx context.Context) uuid.UUID {
@@ -73,3 +205,59 @@ func getUserIDFromContext(ctx context.Context) uuid.UUID {
 	}
 	return uuid.Nil
 }
+
+// ExportTransactionsGin streams the transaction history of the player as CSV or, with ?format=ndjson,
+// as JSON lines. It takes the filters of the history.
+func (h *PlayerHandler) ExportTransactionsGin(c *gin.Context) {
+	h.logger.Debug("ExportTransactions endpoint called")
+
+	userID := getUserIDFromContext(c.Request.Context())
+	exportTransactions(c, h.playerService, userID, h.logger)
+}
+
+// exportTransactions streams the transactions of a user. Errors after the first row has been sent
+// cannot change the response anymore, the export is then cut short without its summary.
+func exportTransactions(c *gin.Context, playerService *service.PlayerService, userID uuid.UUID, log *logger.Logger) {
+	format, ok := export.ParseFormat(c.Query("format"), export.FormatCSV, export.FormatNDJSON)
+	if !ok {
+		log.Warnf("Invalid export format: %s", c.Query("format"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or ndjson"})
+		return
+	}
+	req, err := parseHistoryRequest(c)
+	if err != nil {
+		log.Warnf("Invalid transaction export query: %s", err.Error())
+		writeHistoryError(c, err)
+		return
+	}
+
+	log.Infof("Exporting transactions for user_id=%s, format=%s", userID.String(), format)
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=transactions-%s.%s", userID.String(), format))
+	writer := export.NewTransactionWriter(c.Writer, format)
+	summary, err := playerService.ExportTransactions(c.Request.Context(), userID, req, writer.Write)
+	if err != nil {
+		if c.Writer.Written() {
+			log.Error("Transaction export interrupted: " + err.Error())
+			return
+		}
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Disposition")
+		if writeHistoryError(c, err) {
+			log.Warnf("Invalid transaction export query: %s", err.Error())
+			return
+		}
+		if errors.Is(err, model.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Error("Failed to export transactions: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if err := writer.Close(summary); err != nil {
+		log.Error("Failed to write transaction export: " + err.Error())
+		return
+	}
+	log.Infof("Transactions exported for user_id=%s: count=%d", userID.String(), summary.Count)
+}
@@ -2,16 +2,22 @@ package server
 
 import (
 	"context"
+	"crypto/subtle"
 	"database/sql"
 	httpSwagger "github.com/swaggo/http-swagger"
 	"kentech-project/internal/adapters/repository/wallet"
+	"kentech-project/internal/adapters/repository/wallet/breaker"
 	service2 "kentech-project/internal/core/domain/service"
 	"net/http"
 	"strings"
+	"time"
 
 	"kentech-project/internal/adapters/auth"
+	"kentech-project/internal/adapters/fx"
 	httpHandlers "kentech-project/internal/adapters/http"
+	"kentech-project/internal/adapters/lock"
 	"kentech-project/internal/adapters/repository/postgres"
+	"kentech-project/internal/core/port"
 	"kentech-project/pkg/config"
 	"kentech-project/pkg/logger"
 
@@ -22,27 +28,117 @@ import (
 )
 
 type Server struct {
-	router        *gin.Engine
-	logger        *logger.Logger
-	authHandler   *httpHandlers.AuthHandler
-	playerHandler *httpHandlers.PlayerHandler
-	txHandler     *httpHandlers.TransactionHandler
-	jwtService    *auth.JWTService
+	router         *gin.Engine
+	logger         *logger.Logger
+	authHandler    *httpHandlers.AuthHandler
+	playerHandler  *httpHandlers.PlayerHandler
+	txHandler      *httpHandlers.TransactionHandler
+	adminHandler   *httpHandlers.AdminHandler
+	adminAPIKey    string
+	jwtService     *auth.JWTService
+	walletService  *breaker.WalletService
+	recovery       *service2.RecoveryWorker
+	reconciliation *service2.ReconciliationService
+	playerService  *service2.PlayerService
+}
+
+// Storage is the persistence the server runs on.
+type Storage struct {
+	Users           port.UserRepository
+	Transactions    port.TransactionRepository
+	Bets            port.BetRepository
+	WalletAccounts  port.WalletAccountRepository
+	Ledger          port.LedgerRepository
+	Reconciliations port.ReconciliationRepository
+	// Rates is the rate source used when FX_RATES_SOURCE is db, FX is disabled when it is nil
+	Rates      port.RateProvider
+	UnitOfWork port.UnitOfWork
+	// PlayerLocks serialises the balance changes of a player, within this process when it is nil
+	PlayerLocks port.PlayerLocker
+}
+
+// PostgresStorage builds the storage on db, a balance change waits at most lockWait for another one
+// of the same player.
+func PostgresStorage(db *sql.DB, lockWait time.Duration, log *logger.Logger) Storage {
+	return Storage{
+		Users:           postgres.NewUserRepository(db, log),
+		Transactions:    postgres.NewTransactionRepository(db, log),
+		Bets:            postgres.NewBetRepository(db, log),
+		WalletAccounts:  postgres.NewWalletAccountRepository(db, log),
+		Ledger:          postgres.NewLedgerRepository(db, log),
+		Reconciliations: postgres.NewReconciliationRepository(db, log),
+		Rates:           postgres.NewRateRepository(db, log),
+		UnitOfWork:      postgres.NewUnitOfWork(db, log),
+		PlayerLocks:     postgres.NewPlayerLocker(db, lockWait, log),
+	}
+}
+
+// NewWalletClient builds the client of the wallet at WALLET_URL with the configured retry policy.
+func NewWalletClient(cfg *config.Config, log *logger.Logger) *wallet.WalletClient {
+	return wallet.NewWalletClient(cfg.WalletURL, log, cfg.WalletAPIKey, wallet.RetryPolicy{
+		MaxAttempts:       cfg.WalletMaxAttempts,
+		InitialBackoff:    cfg.WalletInitialBackoff,
+		MaxBackoff:        cfg.WalletMaxBackoff,
+		Multiplier:        cfg.WalletBackoffMultiplier,
+		Jitter:            cfg.WalletRetryJitter,
+		AttemptTimeout:    cfg.WalletAttemptTimeout,
+		RetryableStatuses: cfg.WalletRetryableStatuses,
+	})
 }
 
 func NewServer(cfg *config.Config, db *sql.DB, log *logger.Logger) *Server {
-	userRepo := postgres.NewUserRepository(db, log)
-	txRepo := postgres.NewTransactionRepository(db, log)
-	walletClient := wallet.NewWalletClient(cfg.WalletURL, log, cfg.WalletAPIKey)
+	return NewServerWith(cfg, PostgresStorage(db, cfg.PlayerLockTimeout, log), NewWalletClient(cfg, log), log)
+}
+
+// NewServerWith builds the server on the given storage and wallet, which the circuit breaker wraps.
+func NewServerWith(cfg *config.Config, storage Storage, walletClient port.WalletService, log *logger.Logger) *Server {
+	userRepo := storage.Users
+	txRepo := storage.Transactions
+	betRepo := storage.Bets
+	accountRepo := storage.WalletAccounts
+	reconRepo := storage.Reconciliations
+	ledgerRepo := storage.Ledger
+	uow := storage.UnitOfWork
+	playerLocks := storage.PlayerLocks
+	if playerLocks == nil {
+		log.Warn("Player locks are local, balance changes are only serialised within this process")
+		playerLocks = lock.NewLocalLocker(log)
+	}
+	walletService := breaker.NewWalletService(walletClient, breaker.Config{
+		WindowSize:           cfg.WalletBreakerWindowSize,
+		MinRequests:          cfg.WalletBreakerMinRequests,
+		FailureRateThreshold: cfg.WalletBreakerFailureRate,
+		Cooldown:             cfg.WalletBreakerCooldown,
+		HalfOpenMaxCalls:     cfg.WalletBreakerHalfOpenCalls,
+	}, log)
 	jwtService := auth.NewJWTService(cfg.JWTSecret, log)
+	exchangeService := service2.NewExchangeService(newRateProvider(cfg, storage.Rates, log), cfg.FXSpread, log)
+
+	authService := service2.NewAuthService(userRepo, jwtService, uow, log)
+	playerService := service2.NewPlayerService(userRepo, txRepo, ledgerRepo, walletService, service2.BalancePolicy{
+		Mode:          service2.BalanceMode(cfg.BalanceMode),
+		TTL:           cfg.BalanceCacheTTL,
+		FallbackLocal: cfg.BalanceFallbackLocal,
+	}, log)
+	txService := service2.NewTransactionService(userRepo, txRepo, betRepo, walletService, exchangeService, uow, playerLocks, log)
+	accountService := service2.NewWalletAccountService(accountRepo, log)
 
-	authService := service2.NewAuthService(userRepo, jwtService, log)
-	playerService := service2.NewPlayerService(userRepo, txRepo, log)
-	txService := service2.NewTransactionService(userRepo, txRepo, walletClient, db, log)
+	recovery := service2.NewRecoveryWorker(txService, txRepo, service2.RecoveryConfig{
+		Interval:    cfg.RecoveryInterval,
+		StaleAfter:  cfg.RecoveryStaleAfter,
+		BatchSize:   cfg.RecoveryBatchSize,
+		MaxAttempts: cfg.RecoveryMaxAttempts,
+	}, log)
+	reconciliation := service2.NewReconciliationService(reconRepo, walletService, service2.ReconciliationConfig{
+		Interval:  cfg.ReconciliationInterval,
+		BatchSize: cfg.ReconciliationBatchSize,
+		Timeout:   cfg.ReconciliationTimeout,
+	}, log)
 
 	authHandler := httpHandlers.NewAuthHandler(authService, log)
 	playerHandler := httpHandlers.NewPlayerHandler(playerService, log)
 	txHandler := httpHandlers.NewTransactionHandler(txService, log)
+	adminHandler := httpHandlers.NewAdminHandler(accountService, reconciliation, playerService, log)
 
 	router := gin.Default()
 	log.Debug("Gin router initialized")
@@ -58,18 +154,50 @@ func NewServer(cfg *config.Config, db *sql.DB, log *logger.Logger) *Server {
 	log.Info("CORS middleware registered")
 
 	server := &Server{
-		router:        router,
-		logger:        log,
-		authHandler:   authHandler,
-		playerHandler: playerHandler,
-		txHandler:     txHandler,
-		jwtService:    jwtService,
+		router:         router,
+		logger:         log,
+		authHandler:    authHandler,
+		playerHandler:  playerHandler,
+		txHandler:      txHandler,
+		adminHandler:   adminHandler,
+		adminAPIKey:    cfg.AdminAPIKey,
+		jwtService:     jwtService,
+		walletService:  walletService,
+		recovery:       recovery,
+		reconciliation: reconciliation,
+		playerService:  playerService,
 	}
 	server.registerRoutes()
 	log.Info("Server initialization complete")
 	return server
 }
 
+// newRateProvider builds the exchange rate source selected by FX_RATES_SOURCE, nil disables FX conversion.
+func newRateProvider(cfg *config.Config, rates port.RateProvider, log *logger.Logger) port.RateProvider {
+	switch cfg.FXRatesSource {
+	case "db":
+		if rates == nil {
+			log.Error("FX conversion disabled, the storage has no exchange rates")
+			return nil
+		}
+		log.Info("FX rates read from the database")
+		return rates
+	case "file":
+		provider, err := fx.NewFileRateProvider(cfg.FXRatesFile, log)
+		if err != nil {
+			log.Errorf("FX conversion disabled, failed to load rates file: %v", err)
+			return nil
+		}
+		return provider
+	case "":
+		log.Info("FX conversion disabled")
+		return nil
+	default:
+		log.Errorf("FX conversion disabled, unknown FX_RATES_SOURCE: %s", cfg.FXRatesSource)
+		return nil
+	}
+}
+
 func (s *Server) registerRoutes() {
 	s.router.POST("/api/auth/register", func(c *gin.Context) {
 		s.logger.Info("Register endpoint called")
@@ -96,6 +224,10 @@ func (s *Server) registerRoutes() {
 		s.logger.Debug("GetTransactionHistory endpoint called")
 		s.playerHandler.GetTransactionHistoryGin(c)
 	})
+	api.GET("/player/transactions/export", func(c *gin.Context) {
+		s.logger.Debug("ExportTransactions endpoint called")
+		s.playerHandler.ExportTransactionsGin(c)
+	})
 
 	api.POST("/transactions/deposit", func(c *gin.Context) {
 		s.logger.Info("Deposit endpoint called")
@@ -105,14 +237,74 @@ func (s *Server) registerRoutes() {
 		s.logger.Info("Withdraw endpoint called")
 		s.txHandler.WithdrawGin(c)
 	})
+	api.POST("/transactions/cancel", func(c *gin.Context) {
+		s.logger.Info("CancelByReference endpoint called")
+		s.txHandler.CancelByReferenceGin(c)
+	})
 	api.POST("/transactions/:id/cancel", func(c *gin.Context) {
 		s.logger.Info("CancelTransaction endpoint called")
 		s.txHandler.CancelGin(c)
 	})
+	api.GET("/transactions", func(c *gin.Context) {
+		s.logger.Debug("GetTransactionByReference endpoint called")
+		s.txHandler.GetTransactionByReferenceGin(c)
+	})
+	api.GET("/transactions/:id", func(c *gin.Context) {
+		s.logger.Debug("GetTransaction endpoint called")
+		s.txHandler.GetTransactionGin(c)
+	})
+
+	if s.adminAPIKey == "" {
+		s.logger.Warn("ADMIN_API_KEY not set, admin endpoints disabled")
+	} else {
+		admin := s.router.Group("/admin")
+		admin.Use(NewAdminMiddleware(s.adminAPIKey, s.logger).MiddlewareGin)
+
+		admin.POST("/wallet-accounts", func(c *gin.Context) {
+			s.logger.Info("ImportWalletAccounts endpoint called")
+			s.adminHandler.ImportWalletAccountsGin(c)
+		})
+		admin.GET("/wallet-accounts", func(c *gin.Context) {
+			s.logger.Debug("ListWalletAccounts endpoint called")
+			s.adminHandler.ListWalletAccountsGin(c)
+		})
+
+		admin.POST("/reconciliations", func(c *gin.Context) {
+			s.logger.Info("StartReconciliation endpoint called")
+			s.adminHandler.StartReconciliationGin(c)
+		})
+		admin.GET("/reconciliations", func(c *gin.Context) {
+			s.logger.Debug("ListReconciliations endpoint called")
+			s.adminHandler.ListReconciliationsGin(c)
+		})
+		admin.GET("/reconciliations/:id", func(c *gin.Context) {
+			s.logger.Debug("GetReconciliation endpoint called")
+			s.adminHandler.GetReconciliationGin(c)
+		})
+		admin.GET("/reconciliations/:id/export", func(c *gin.Context) {
+			s.logger.Info("ExportReconciliation endpoint called")
+			s.adminHandler.ExportReconciliationGin(c)
+		})
+
+		admin.GET("/users/:id/transactions/export", func(c *gin.Context) {
+			s.logger.Info("ExportUserTransactions endpoint called")
+			s.adminHandler.ExportUserTransactionsGin(c)
+		})
+	}
 
 	s.router.GET("/health", func(c *gin.Context) {
 		s.logger.Debug("Health check endpoint called")
-		c.String(http.StatusOK, "OK")
+		// an open breaker degrades the service, deposits and withdraws are rejected until the wallet recovers
+		breakerState := s.walletService.State()
+		status := "ok"
+		if breakerState != breaker.StateClosed {
+			status = "degraded"
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":   status,
+			"wallet":   gin.H{"circuit_breaker": breakerState},
+			"recovery": s.recovery.Metrics(),
+		})
 	})
 
 	s.router.GET("/swagger/*any", gin.WrapH(httpSwagger.WrapHandler))
@@ -122,6 +314,21 @@ func (s *Server) Handler() http.Handler {
 	return s.router
 }
 
+// RecoveryWorker returns the worker finalising stuck pending transactions, started by the caller.
+func (s *Server) RecoveryWorker() *service2.RecoveryWorker {
+	return s.recovery
+}
+
+// Players returns the player service, used by the commands exporting transactions.
+func (s *Server) Players() *service2.PlayerService {
+	return s.playerService
+}
+
+// Reconciliation returns the balance reconciliation, its scheduled job is started by the caller.
+func (s *Server) Reconciliation() *service2.ReconciliationService {
+	return s.reconciliation
+}
+
 type AuthMiddleware struct {
 	jwtService *auth.JWTService
 	logger     *logger.Logger
@@ -158,3 +365,23 @@ func (m *AuthMiddleware) MiddlewareGin(c *gin.Context) {
 	c.Request = c.Request.WithContext(ctx)
 	c.Next()
 }
+
+// AdminMiddleware authenticates operators with the static key sent in the X-Admin-Key header.
+type AdminMiddleware struct {
+	apiKey string
+	logger *logger.Logger
+}
+
+func NewAdminMiddleware(apiKey string, log *logger.Logger) *AdminMiddleware {
+	return &AdminMiddleware{apiKey: apiKey, logger: log}
+}
+
+func (m *AdminMiddleware) MiddlewareGin(c *gin.Context) {
+	key := c.GetHeader("X-Admin-Key")
+	if key == "" || subtle.ConstantTimeCompare([]byte(key), []byte(m.apiKey)) != 1 {
+		m.logger.Warn("Invalid or missing admin key")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid admin key"})
+		return
+	}
+	c.Next()
+}
@@ -3,10 +3,13 @@ package http
 import (
 	"errors"
 	"kentech-project/internal/adapters/repository/wallet"
+	"kentech-project/internal/adapters/repository/wallet/breaker"
 	"kentech-project/internal/core/domain/model"
 	"kentech-project/internal/core/domain/service"
 	"kentech-project/pkg/logger"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -34,17 +37,27 @@ func (h *TransactionHandler) DepositGin(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "code": "INVALID_BODY"})
 		return
 	}
-	h.logger.Infof("Processing deposit: user_id=%s, amount=%f", userID.String(), req.Amount)
+	amount, err := model.ParseMoney(req.Amount.String(), req.Currency)
+	if err != nil {
+		h.logger.Warnf("Invalid deposit amount: %s %s", req.Amount, req.Currency)
+		h.handleAmountError(c, err)
+		return
+	}
+	h.logger.Infof("Processing deposit: user_id=%s, amount=%s, currency=%s", userID.String(), amount, amount.Currency())
 
 	response, err := h.transactionService.Deposit(
 		c.Request.Context(),
 		userID,
-		req.Currency,
-		req.Amount,
+		amount,
 		req.ProviderTransactionID,
 		req.ProviderWithdrawnID,
 	)
 	if err != nil {
+		if errors.Is(err, model.ErrWalletUnavailable) {
+			h.logger.Warnf("Wallet unavailable during deposit: %s", err.Error())
+			writeWalletUnavailable(c, err)
+			return
+		}
 		var walletErr *wallet.WalletError
 		if errors.As(err, &walletErr) {
 			h.logger.Warnf("Wallet error during deposit: %s", walletErr.Message)
@@ -54,12 +67,26 @@ func (h *TransactionHandler) DepositGin(c *gin.Context) {
 			})
 			return
 		}
+		if h.handleIdempotencyError(c, err) {
+			h.logger.Warnf("Deposit rejected for provider_transaction_id=%s: %s", req.ProviderTransactionID, err.Error())
+			return
+		}
+		if h.handleAmountError(c, err) {
+			h.logger.Warnf("Invalid deposit amount %s: %s", amount, err.Error())
+			return
+		}
 		switch {
-		case errors.Is(err, model.ErrInvalidAmount):
-			h.logger.Warnf("Invalid deposit amount: %f", req.Amount)
-			c.JSON(http.StatusBadRequest, gin.H{
+		case errors.Is(err, model.ErrBetNotFound):
+			h.logger.Warnf("Bet not found for provider_withdrawn_id=%s", req.ProviderWithdrawnID)
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+				"code":  "BET_NOT_FOUND",
+			})
+		case errors.Is(err, model.ErrBetAlreadySettled):
+			h.logger.Warnf("Bet already settled for provider_withdrawn_id=%s", req.ProviderWithdrawnID)
+			c.JSON(http.StatusConflict, gin.H{
 				"error": err.Error(),
-				"code":  "INVALID_AMOUNT",
+				"code":  "BET_ALREADY_SETTLED",
 			})
 		default:
 			h.logger.Error("Internal error during deposit: " + err.Error())
@@ -84,16 +111,26 @@ func (h *TransactionHandler) WithdrawGin(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "code": "INVALID_BODY"})
 		return
 	}
-	h.logger.Infof("Processing withdraw: user_id=%s, amount=%f", userID.String(), req.Amount)
+	amount, err := model.ParseMoney(req.Amount.String(), req.Currency)
+	if err != nil {
+		h.logger.Warnf("Invalid withdraw amount: %s %s", req.Amount, req.Currency)
+		h.handleAmountError(c, err)
+		return
+	}
+	h.logger.Infof("Processing withdraw: user_id=%s, amount=%s, currency=%s", userID.String(), amount, amount.Currency())
 
 	response, err := h.transactionService.Withdraw(
 		c.Request.Context(),
 		userID,
-		req.Currency,
-		req.Amount,
+		amount,
 		req.ProviderTransactionID,
 	)
 	if err != nil {
+		if errors.Is(err, model.ErrWalletUnavailable) {
+			h.logger.Warnf("Wallet unavailable during withdraw: %s", err.Error())
+			writeWalletUnavailable(c, err)
+			return
+		}
 		var walletErr *wallet.WalletError
 		if errors.As(err, &walletErr) {
 			h.logger.Warnf("Wallet error during withdraw: %s", walletErr.Message)
@@ -103,15 +140,17 @@ func (h *TransactionHandler) WithdrawGin(c *gin.Context) {
 			})
 			return
 		}
+		if h.handleIdempotencyError(c, err) {
+			h.logger.Warnf("Withdraw rejected for provider_transaction_id=%s: %s", req.ProviderTransactionID, err.Error())
+			return
+		}
+		if h.handleAmountError(c, err) {
+			h.logger.Warnf("Invalid withdraw amount %s: %s", amount, err.Error())
+			return
+		}
 		switch {
-		case errors.Is(err, model.ErrInvalidAmount):
-			h.logger.Warnf("Invalid withdraw amount: %f", req.Amount)
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": err.Error(),
-				"code":  "INVALID_AMOUNT",
-			})
 		case errors.Is(err, model.ErrInsufficientBalance):
-			h.logger.Warnf("Insufficient balance for user_id=%s, amount=%f", userID.String(), req.Amount)
+			h.logger.Warnf("Insufficient balance for user_id=%s, amount=%s", userID.String(), amount)
 			c.JSON(http.StatusConflict, gin.H{
 				"error": err.Error(),
 				"code":  "INSUFFICIENT_BALANCE",
@@ -144,23 +183,233 @@ func (h *TransactionHandler) CancelGin(c *gin.Context) {
 
 	response, err := h.transactionService.CancelTransaction(c.Request.Context(), userID, transactionID)
 	if err != nil {
-		switch err {
-		case model.ErrTransactionNotFound:
-			h.logger.Warnf("Transaction not found: %s", transactionID.String())
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-		case model.ErrUnauthorized:
-			h.logger.Warnf("Unauthorized cancel attempt: user_id=%s, transaction_id=%s", userID.String(), transactionID.String())
-			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
-		case model.ErrTransactionNotPending:
-			h.logger.Warnf("Transaction not pending: %s", transactionID.String())
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		default:
-			h.logger.Error("Internal error during cancel: " + err.Error())
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		h.writeCancelError(c, err, userID, transactionID.String())
+		return
+	}
+
+	h.logger.Info("Transaction canceled successfully")
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *TransactionHandler) CancelByReferenceGin(c *gin.Context) {
+	h.logger.Debug("CancelByReference endpoint called")
+
+	userID := getUserIDFromContext(c.Request.Context())
+	var req model.CancelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn("Invalid request body for cancel")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "code": "INVALID_BODY"})
+		return
+	}
+	h.logger.Infof("Processing cancel: user_id=%s, provider_transaction_id=%s, type=%s", userID.String(), req.ProviderTransactionID, req.Type)
+
+	response, err := h.transactionService.CancelByReference(c.Request.Context(), userID, req.Type, req.ProviderTransactionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrMissingReference):
+			h.logger.Warn("Missing provider transaction id for cancel")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "MISSING_PROVIDER_TRANSACTION_ID"})
+			return
+		case errors.Is(err, model.ErrInvalidTransactionType):
+			h.logger.Warnf("Invalid transaction type for cancel: %s", req.Type)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_TRANSACTION_TYPE"})
+			return
+		case errors.Is(err, model.ErrAmbiguousReference):
+			h.logger.Warnf("Ambiguous provider transaction id for cancel: %s", req.ProviderTransactionID)
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "AMBIGUOUS_REFERENCE"})
+			return
 		}
+		h.writeCancelError(c, err, userID, req.ProviderTransactionID)
 		return
 	}
 
 	h.logger.Info("Transaction canceled successfully")
 	c.JSON(http.StatusOK, response)
 }
+
+func (h *TransactionHandler) GetTransactionGin(c *gin.Context) {
+	h.logger.Debug("GetTransaction endpoint called")
+
+	userID := getUserIDFromContext(c.Request.Context())
+	transactionIDStr := c.Param("id")
+	transactionID, err := uuid.Parse(transactionIDStr)
+	if err != nil {
+		h.logger.Warnf("Invalid transaction ID: %s", transactionIDStr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return
+	}
+
+	details, err := h.transactionService.GetTransaction(c.Request.Context(), userID, transactionID)
+	if err != nil {
+		h.writeLookupError(c, err, userID, transactionIDStr)
+		return
+	}
+	c.JSON(http.StatusOK, details)
+}
+
+// GetTransactionByReferenceGin looks a transaction up by ?reference=, the provider transaction ID,
+// and optionally ?type= when the reference was used for several transactions.
+func (h *TransactionHandler) GetTransactionByReferenceGin(c *gin.Context) {
+	h.logger.Debug("GetTransactionByReference endpoint called")
+
+	userID := getUserIDFromContext(c.Request.Context())
+	reference := c.Query("reference")
+	txType := model.TransactionType(c.Query("type"))
+	if txType != "" && !txType.Valid() {
+		h.logger.Warnf("Invalid transaction type: %s", txType)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction type"})
+		return
+	}
+
+	details, err := h.transactionService.GetTransactionByReference(c.Request.Context(), userID, txType, reference)
+	if err != nil {
+		if errors.Is(err, model.ErrMissingReference) {
+			h.logger.Warn("Missing provider transaction id for lookup")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "MISSING_PROVIDER_TRANSACTION_ID"})
+			return
+		}
+		h.writeLookupError(c, err, userID, reference)
+		return
+	}
+	c.JSON(http.StatusOK, details)
+}
+
+func (h *TransactionHandler) writeLookupError(c *gin.Context, err error, userID uuid.UUID, transactionRef string) {
+	switch {
+	case errors.Is(err, model.ErrTransactionNotFound):
+		h.logger.Warnf("Transaction not found: %s", transactionRef)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, model.ErrUnauthorized):
+		h.logger.Warnf("Unauthorized transaction lookup: user_id=%s, transaction=%s", userID.String(), transactionRef)
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, model.ErrAmbiguousReference):
+		h.logger.Warnf("Ambiguous provider transaction id for lookup: %s", transactionRef)
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "AMBIGUOUS_REFERENCE"})
+	default:
+		h.logger.Error("Internal error during transaction lookup: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
+
+func (h *TransactionHandler) writeCancelError(c *gin.Context, err error, userID uuid.UUID, transactionRef string) {
+	if errors.Is(err, model.ErrWalletUnavailable) {
+		h.logger.Warnf("Wallet unavailable during cancel: %s", err.Error())
+		writeWalletUnavailable(c, err)
+		return
+	}
+	var walletErr *wallet.WalletError
+	if errors.As(err, &walletErr) {
+		h.logger.Warnf("Wallet error during cancel: %s", walletErr.Message)
+		c.JSON(walletErr.StatusCode, gin.H{
+			"error": walletErr.Message,
+			"code":  "WALLET_ERROR",
+		})
+		return
+	}
+	switch {
+	case errors.Is(err, model.ErrTransactionNotFound):
+		h.logger.Warnf("Transaction not found: %s", transactionRef)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, model.ErrUnauthorized):
+		h.logger.Warnf("Unauthorized cancel attempt: user_id=%s, transaction=%s", userID.String(), transactionRef)
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, model.ErrTransactionNotCancelable):
+		h.logger.Warnf("Transaction cannot be canceled: %s", transactionRef)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, model.ErrInsufficientBalance):
+		h.logger.Warnf("Insufficient balance to roll back transaction: %s", transactionRef)
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "INSUFFICIENT_BALANCE"})
+	case errors.Is(err, model.ErrBetAlreadySettled):
+		h.logger.Warnf("Bet of transaction already settled: %s", transactionRef)
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "BET_ALREADY_SETTLED"})
+	case errors.Is(err, model.ErrTransactionInProgress):
+		h.logger.Warnf("Rollback already in progress: %s", transactionRef)
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "TRANSACTION_IN_PROGRESS"})
+	case errors.Is(err, model.ErrConcurrentModification):
+		h.logger.Warnf("Transaction modified concurrently during cancel: %s", transactionRef)
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "CONCURRENT_MODIFICATION"})
+	default:
+		h.logger.Error("Internal error during cancel: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
+
+// handleIdempotencyError writes the response for errors raised while matching a request
+// against an earlier transaction with the same provider transaction ID.
+func (h *TransactionHandler) handleIdempotencyError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, model.ErrMissingReference):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"code":  "MISSING_PROVIDER_TRANSACTION_ID",
+		})
+	case errors.Is(err, model.ErrIdempotencyConflict):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+			"code":  "IDEMPOTENCY_CONFLICT",
+		})
+	case errors.Is(err, model.ErrTransactionInProgress):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+			"code":  "TRANSACTION_IN_PROGRESS",
+		})
+	case errors.Is(err, model.ErrTransactionCanceled):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+			"code":  "TRANSACTION_CANCELED",
+		})
+	case errors.Is(err, model.ErrConcurrentModification):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+			"code":  "CONCURRENT_MODIFICATION",
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+// handleAmountError writes the response for amounts that are not valid in their currency.
+func (h *TransactionHandler) handleAmountError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, model.ErrInvalidAmount):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"code":  "INVALID_AMOUNT",
+		})
+	case errors.Is(err, model.ErrAmountPrecision):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"code":  "INVALID_AMOUNT_PRECISION",
+		})
+	case errors.Is(err, model.ErrUnknownCurrency):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"code":  "UNKNOWN_CURRENCY",
+		})
+	case errors.Is(err, model.ErrCurrencyMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"code":  "CURRENCY_MISMATCH",
+		})
+	case errors.Is(err, model.ErrExchangeRateNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"code":  "EXCHANGE_RATE_NOT_FOUND",
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+func writeWalletUnavailable(c *gin.Context, err error) {
+	var openErr *breaker.OpenError
+	if errors.As(err, &openErr) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(openErr.RetryAfter.Seconds()))))
+	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error": model.ErrWalletUnavailable.Error(),
+		"code":  "WALLET_UNAVAILABLE",
+	})
+}
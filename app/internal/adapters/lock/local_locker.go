@@ -0,0 +1,66 @@
+package lock
+
+import (
+	"context"
+	"kentech-project/pkg/logger"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// LocalLocker locks players within this process. It is enough for a single replica, several
+// replicas need a lock shared through the database, see postgres.PlayerLocker.
+type LocalLocker struct {
+	mu     sync.Mutex
+	locks  map[uuid.UUID]*playerLock
+	logger *logger.Logger
+}
+
+// playerLock is held by whoever sent into sem. It is dropped once nobody holds or waits for it.
+type playerLock struct {
+	sem     chan struct{}
+	waiters int
+}
+
+func NewLocalLocker(log *logger.Logger) *LocalLocker {
+	return &LocalLocker{
+		locks:  make(map[uuid.UUID]*playerLock),
+		logger: log,
+	}
+}
+
+func (l *LocalLocker) Lock(ctx context.Context, userID uuid.UUID) (func(), error) {
+	l.mu.Lock()
+	lock, ok := l.locks[userID]
+	if !ok {
+		lock = &playerLock{sem: make(chan struct{}, 1)}
+		l.locks[userID] = lock
+	}
+	lock.waiters++
+	l.mu.Unlock()
+
+	select {
+	case lock.sem <- struct{}{}:
+	case <-ctx.Done():
+		l.logger.Warnf("Player lock not acquired: user_id=%s: %s", userID.String(), ctx.Err().Error())
+		l.release(userID, lock)
+		return nil, ctx.Err()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-lock.sem
+			l.release(userID, lock)
+		})
+	}, nil
+}
+
+func (l *LocalLocker) release(userID uuid.UUID, lock *playerLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock.waiters--
+	if lock.waiters == 0 {
+		delete(l.locks, userID)
+	}
+}
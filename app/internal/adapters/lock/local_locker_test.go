@@ -0,0 +1,88 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"kentech-project/pkg/logger"
+
+	"github.com/google/uuid"
+)
+
+func TestLocalLockerSerialisesAPlayer(t *testing.T) {
+	locker := NewLocalLocker(logger.New())
+	userID := uuid.New()
+
+	var inside, overlaps atomic.Int32
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := locker.Lock(context.Background(), userID)
+			if err != nil {
+				t.Errorf("lock: %v", err)
+				return
+			}
+			if inside.Add(1) > 1 {
+				overlaps.Add(1)
+			}
+			time.Sleep(time.Millisecond)
+			inside.Add(-1)
+			unlock()
+		}()
+	}
+	wg.Wait()
+
+	if overlaps.Load() > 0 {
+		t.Fatalf("the lock was held %d times by two callers at once", overlaps.Load())
+	}
+	if len(locker.locks) != 0 {
+		t.Fatalf("%d locks left after every caller released", len(locker.locks))
+	}
+}
+
+func TestLocalLockerPlayersAreIndependent(t *testing.T) {
+	locker := NewLocalLocker(logger.New())
+	unlock, err := locker.Lock(context.Background(), uuid.New())
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	other, err := locker.Lock(ctx, uuid.New())
+	if err != nil {
+		t.Fatalf("lock of another player: %v", err)
+	}
+	other()
+}
+
+func TestLocalLockerGivesUpWithTheContext(t *testing.T) {
+	locker := NewLocalLocker(logger.New())
+	userID := uuid.New()
+	unlock, err := locker.Lock(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := locker.Lock(ctx, userID); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("lock of a held player = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// releasing twice is harmless
+	unlock()
+	unlock()
+	again, err := locker.Lock(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("lock after release: %v", err)
+	}
+	again()
+}
@@ -0,0 +1,155 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// errDuplicateBet stands for the unique violation of idx_bets_user_provider_bet_id.
+var errDuplicateBet = errors.New("bet already exists for this provider bet id")
+
+// BetRepository keeps bets in memory with the semantics of postgres.BetRepository. Wallet bet ids
+// are handed out in sequence like the wallet_bet_id column.
+type BetRepository struct {
+	mu        locker
+	bets      map[uuid.UUID]*model.Bet
+	lastBetID *int
+	logger    *logger.Logger
+}
+
+func NewBetRepository(log *logger.Logger) *BetRepository {
+	return &BetRepository{
+		mu:        &sync.Mutex{},
+		bets:      make(map[uuid.UUID]*model.Bet),
+		lastBetID: new(int),
+		logger:    log,
+	}
+}
+
+func (r *BetRepository) inTx() *BetRepository {
+	return &BetRepository{mu: noLock{}, bets: r.bets, lastBetID: r.lastBetID, logger: r.logger}
+}
+
+func (r *BetRepository) snapshot() func() {
+	saved := make(map[uuid.UUID]*model.Bet, len(r.bets))
+	for id, bet := range r.bets {
+		saved[id] = cloneBet(bet)
+	}
+	lastBetID := *r.lastBetID
+	return func() {
+		clear(r.bets)
+		for id, bet := range saved {
+			r.bets[id] = bet
+		}
+		*r.lastBetID = lastBetID
+	}
+}
+
+func cloneBet(bet *model.Bet) *model.Bet {
+	clone := *bet
+	if bet.DepositTransactionID != nil {
+		id := *bet.DepositTransactionID
+		clone.DepositTransactionID = &id
+	}
+	if bet.SettledAt != nil {
+		settledAt := *bet.SettledAt
+		clone.SettledAt = &settledAt
+	}
+	return &clone
+}
+
+func (r *BetRepository) Create(ctx context.Context, bet *model.Bet) error {
+	r.logger.Debug("Creating new bet")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.bets {
+		if existing.UserID == bet.UserID && existing.ProviderBetID == bet.ProviderBetID {
+			r.logger.Error("Failed to create bet: " + errDuplicateBet.Error())
+			return errDuplicateBet
+		}
+	}
+
+	*r.lastBetID++
+	bet.ID = uuid.New()
+	bet.WalletBetID = *r.lastBetID
+	bet.CreatedAt = time.Now()
+	bet.UpdatedAt = time.Now()
+	r.bets[bet.ID] = cloneBet(bet)
+
+	r.logger.Infof("Bet created: id=%s, wallet_bet_id=%d, user_id=%s", bet.ID.String(), bet.WalletBetID, bet.UserID.String())
+	return nil
+}
+
+func (r *BetRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Bet, error) {
+	r.logger.Debugf("Fetching bet by ID: %s", id.String())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bet, ok := r.bets[id]
+	if !ok {
+		r.logger.Warnf("Bet not found: id=%s", id.String())
+		return nil, model.ErrBetNotFound
+	}
+	return cloneBet(bet), nil
+}
+
+func (r *BetRepository) GetByProviderBetID(ctx context.Context, userID uuid.UUID, providerBetID string) (*model.Bet, error) {
+	r.logger.Debugf("Fetching bet by provider bet ID: user_id=%s, provider_bet_id=%s", userID.String(), providerBetID)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, bet := range r.bets {
+		if bet.UserID == userID && bet.ProviderBetID == providerBetID {
+			return cloneBet(bet), nil
+		}
+	}
+	r.logger.Warnf("Bet not found: user_id=%s, provider_bet_id=%s", userID.String(), providerBetID)
+	return nil, model.ErrBetNotFound
+}
+
+func (r *BetRepository) GetByTransactionID(ctx context.Context, transactionID uuid.UUID) (*model.Bet, error) {
+	r.logger.Debugf("Fetching bet by transaction ID: %s", transactionID.String())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, bet := range r.bets {
+		if bet.WithdrawTransactionID == transactionID ||
+			(bet.DepositTransactionID != nil && *bet.DepositTransactionID == transactionID) {
+			return cloneBet(bet), nil
+		}
+	}
+	r.logger.Debugf("Bet not found: transaction_id=%s", transactionID.String())
+	return nil, model.ErrBetNotFound
+}
+
+// Update stores the same columns as the postgres repository, the placing fields never change.
+func (r *BetRepository) Update(ctx context.Context, bet *model.Bet) error {
+	r.logger.Debugf("Updating bet: id=%s", bet.ID.String())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bet.UpdatedAt = time.Now()
+
+	stored, ok := r.bets[bet.ID]
+	if !ok {
+		return nil
+	}
+	updated := cloneBet(bet)
+	updated.UserID = stored.UserID
+	updated.WalletBetID = stored.WalletBetID
+	updated.ProviderBetID = stored.ProviderBetID
+	updated.Currency = stored.Currency
+	updated.PlacedAt = stored.PlacedAt
+	updated.CreatedAt = stored.CreatedAt
+	r.bets[bet.ID] = updated
+
+	r.logger.Infof("Bet updated: id=%s, status=%s", bet.ID.String(), bet.Status)
+	return nil
+}
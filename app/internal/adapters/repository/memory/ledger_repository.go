@@ -0,0 +1,174 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// errUnknownLedgerAccount stands for the foreign key violation of journal_lines.account_id.
+var errUnknownLedgerAccount = errors.New("ledger account not found")
+
+// ledgerLine is a posted journal line of a player account, with what BalanceAt needs to find it.
+type ledgerLine struct {
+	accountID    uuid.UUID
+	balanceAfter model.Money
+	createdAt    time.Time
+}
+
+// LedgerRepository keeps the ledger in memory with the semantics of postgres.LedgerRepository.
+// Lines of player accounts are kept in posting order, only player accounts keep a balance.
+type LedgerRepository struct {
+	mu       locker
+	accounts map[uuid.UUID]*model.LedgerAccount
+	lines    *[]ledgerLine
+	logger   *logger.Logger
+}
+
+func NewLedgerRepository(log *logger.Logger) *LedgerRepository {
+	return &LedgerRepository{
+		mu:       &sync.Mutex{},
+		accounts: make(map[uuid.UUID]*model.LedgerAccount),
+		lines:    new([]ledgerLine),
+		logger:   log,
+	}
+}
+
+func (r *LedgerRepository) inTx() *LedgerRepository {
+	return &LedgerRepository{mu: noLock{}, accounts: r.accounts, lines: r.lines, logger: r.logger}
+}
+
+func (r *LedgerRepository) snapshot() func() {
+	saved := make(map[uuid.UUID]*model.LedgerAccount, len(r.accounts))
+	for id, account := range r.accounts {
+		saved[id] = cloneLedgerAccount(account)
+	}
+	lines := len(*r.lines)
+	return func() {
+		clear(r.accounts)
+		for id, account := range saved {
+			r.accounts[id] = account
+		}
+		// lines are only ever appended
+		*r.lines = (*r.lines)[:lines]
+	}
+}
+
+func cloneLedgerAccount(account *model.LedgerAccount) *model.LedgerAccount {
+	clone := *account
+	if account.UserID != nil {
+		id := *account.UserID
+		clone.UserID = &id
+	}
+	return &clone
+}
+
+func sameOwner(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func (r *LedgerRepository) Account(ctx context.Context, userID *uuid.UUID, accountType model.LedgerAccountType, currency string) (*model.LedgerAccount, error) {
+	r.logger.Debugf("Fetching ledger account: type=%s, currency=%s", accountType, currency)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, account := range r.accounts {
+		if sameOwner(account.UserID, userID) && account.Type == accountType && account.Currency == currency {
+			return cloneLedgerAccount(account), nil
+		}
+	}
+	account := cloneLedgerAccount(&model.LedgerAccount{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Type:      accountType,
+		Currency:  currency,
+		Balance:   model.NewMoney(0, currency),
+		CreatedAt: time.Now(),
+	})
+	r.accounts[account.ID] = account
+	return cloneLedgerAccount(account), nil
+}
+
+func (r *LedgerRepository) Post(ctx context.Context, entry *model.JournalEntry) error {
+	if err := entry.Validate(); err != nil {
+		r.logger.Warnf("Rejected journal entry %q: %s", entry.Description, err.Error())
+		return err
+	}
+	r.logger.Debugf("Posting journal entry: %s", entry.Description)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// balances are computed first so a failing line leaves no partial entry behind
+	balances := make(map[uuid.UUID]model.Money)
+	for _, line := range entry.Lines {
+		account, found := r.accounts[line.AccountID]
+		if !found {
+			r.logger.Error("Failed to update ledger account balance: " + errUnknownLedgerAccount.Error())
+			return errUnknownLedgerAccount
+		}
+		if account.UserID == nil {
+			// a system account, its line has no balance after
+			line.BalanceAfter = nil
+			continue
+		}
+		balance, ok := balances[line.AccountID]
+		if !ok {
+			balance = account.Balance
+		}
+		balance, err := balance.Add(line.Credit)
+		if err == nil {
+			balance, err = balance.Sub(line.Debit)
+		}
+		if err != nil {
+			r.logger.Error("Failed to update ledger account balance: " + err.Error())
+			return err
+		}
+		balances[line.AccountID] = balance
+		line.BalanceAfter = &balance
+	}
+
+	entry.ID = uuid.New()
+	entry.CreatedAt = time.Now()
+	for _, line := range entry.Lines {
+		if line.BalanceAfter != nil {
+			*r.lines = append(*r.lines, ledgerLine{accountID: line.AccountID, balanceAfter: *line.BalanceAfter, createdAt: entry.CreatedAt})
+		}
+	}
+	for id, balance := range balances {
+		r.accounts[id].Balance = balance
+	}
+	r.logger.Infof("Journal entry posted: id=%s, description=%s", entry.ID.String(), entry.Description)
+	return nil
+}
+
+func (r *LedgerRepository) BalanceAt(ctx context.Context, userID uuid.UUID, currency string, at time.Time) (model.Money, error) {
+	r.logger.Debugf("Fetching ledger balance: user_id=%s, currency=%s, at=%s", userID.String(), currency, at.Format(time.RFC3339))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var accountID *uuid.UUID
+	for id, account := range r.accounts {
+		if account.UserID != nil && *account.UserID == userID && account.Type == model.LedgerAccountPlayer && account.Currency == currency {
+			accountID = &id
+			break
+		}
+	}
+	if accountID == nil {
+		return model.NewMoney(0, currency), nil
+	}
+	lines := *r.lines
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i].accountID == *accountID && !lines[i].createdAt.After(at) {
+			return lines[i].balanceAfter, nil
+		}
+	}
+	return model.NewMoney(0, currency), nil
+}
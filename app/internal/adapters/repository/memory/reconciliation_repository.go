@@ -0,0 +1,230 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReconciliationRepository keeps reconciliation runs in memory with the semantics of
+// postgres.ReconciliationRepository. Player balances are read from the given user and transaction
+// repositories, which must share its lock when they belong to a Store.
+type ReconciliationRepository struct {
+	mu           locker
+	runs         map[uuid.UUID]*model.ReconciliationRun
+	items        map[uuid.UUID][]*model.ReconciliationItem
+	users        *UserRepository
+	transactions *TransactionRepository
+	logger       *logger.Logger
+}
+
+func NewReconciliationRepository(users *UserRepository, transactions *TransactionRepository, log *logger.Logger) *ReconciliationRepository {
+	return &ReconciliationRepository{
+		mu:           &sync.Mutex{},
+		runs:         make(map[uuid.UUID]*model.ReconciliationRun),
+		items:        make(map[uuid.UUID][]*model.ReconciliationItem),
+		users:        users,
+		transactions: transactions,
+		logger:       log,
+	}
+}
+
+func cloneReconciliationRun(run *model.ReconciliationRun) *model.ReconciliationRun {
+	clone := *run
+	if run.FinishedAt != nil {
+		finishedAt := *run.FinishedAt
+		clone.FinishedAt = &finishedAt
+	}
+	return &clone
+}
+
+func cloneReconciliationItem(item *model.ReconciliationItem) *model.ReconciliationItem {
+	clone := *item
+	if item.WalletBalance != nil {
+		balance := *item.WalletBalance
+		clone.WalletBalance = &balance
+	}
+	clone.Issues = slices.Clone(item.Issues)
+	return &clone
+}
+
+func (r *ReconciliationRepository) CreateRun(ctx context.Context, run *model.ReconciliationRun) error {
+	r.logger.Debug("Creating reconciliation run")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.runs {
+		if existing.Status == model.ReconciliationStatusRunning {
+			r.logger.Warn("Reconciliation run already in progress")
+			return model.ErrReconciliationInProgress
+		}
+	}
+	run.ID = uuid.New()
+	run.Status = model.ReconciliationStatusRunning
+	run.StartedAt = time.Now()
+	r.runs[run.ID] = cloneReconciliationRun(run)
+
+	r.logger.Infof("Reconciliation run created: id=%s", run.ID.String())
+	return nil
+}
+
+func (r *ReconciliationRepository) UpdateRun(ctx context.Context, run *model.ReconciliationRun) error {
+	r.logger.Debugf("Updating reconciliation run: id=%s, status=%s", run.ID.String(), run.Status)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.runs[run.ID]
+	if !ok {
+		return nil
+	}
+	updated := cloneReconciliationRun(run)
+	updated.StartedAt = stored.StartedAt
+	r.runs[run.ID] = updated
+	return nil
+}
+
+func (r *ReconciliationRepository) AbandonRuns(ctx context.Context, before time.Time) (int, error) {
+	r.logger.Debugf("Abandoning reconciliation runs started before %s", before.Format(time.RFC3339))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	abandoned := 0
+	for _, run := range r.runs {
+		if run.Status != model.ReconciliationStatusRunning || !run.StartedAt.Before(before) {
+			continue
+		}
+		finishedAt := time.Now()
+		run.Status = model.ReconciliationStatusFailed
+		run.Error = "abandoned"
+		run.FinishedAt = &finishedAt
+		abandoned++
+	}
+	if abandoned > 0 {
+		r.logger.Warnf("Abandoned %d reconciliation runs", abandoned)
+	}
+	return abandoned, nil
+}
+
+func (r *ReconciliationRepository) GetRun(ctx context.Context, id uuid.UUID) (*model.ReconciliationRun, error) {
+	r.logger.Debugf("Fetching reconciliation run: id=%s", id.String())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	run, ok := r.runs[id]
+	if !ok {
+		r.logger.Warnf("Reconciliation run not found: id=%s", id.String())
+		return nil, model.ErrReconciliationNotFound
+	}
+	return cloneReconciliationRun(run), nil
+}
+
+func (r *ReconciliationRepository) ListRuns(ctx context.Context, limit int) ([]*model.ReconciliationRun, error) {
+	r.logger.Debugf("Fetching reconciliation runs: limit=%d", limit)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	runs := make([]*model.ReconciliationRun, 0, len(r.runs))
+	for _, run := range r.runs {
+		runs = append(runs, cloneReconciliationRun(run))
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	if len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+func (r *ReconciliationRepository) AddItem(ctx context.Context, item *model.ReconciliationItem) error {
+	r.logger.Debugf("Adding reconciliation item: run_id=%s, user_id=%s", item.RunID.String(), item.UserID.String())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item.ID = uuid.New()
+	item.CreatedAt = time.Now()
+	r.items[item.RunID] = append(r.items[item.RunID], cloneReconciliationItem(item))
+	return nil
+}
+
+func (r *ReconciliationRepository) ListItems(ctx context.Context, runID uuid.UUID) ([]*model.ReconciliationItem, error) {
+	r.logger.Debugf("Fetching reconciliation items: run_id=%s", runID.String())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var items []*model.ReconciliationItem
+	for _, item := range r.items[runID] {
+		items = append(items, cloneReconciliationItem(item))
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return bytes.Compare(items[i].UserID[:], items[j].UserID[:]) < 0
+	})
+	return items, nil
+}
+
+// ListPlayerBalances nets the transactions like the postgres repository does.
+func (r *ReconciliationRepository) ListPlayerBalances(ctx context.Context, after uuid.UUID, limit int) ([]*model.PlayerBalances, error) {
+	r.logger.Debugf("Fetching player balances: after=%s, limit=%d", after.String(), limit)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var balances []*model.PlayerBalances
+	for _, user := range r.users.users {
+		if bytes.Compare(user.ID[:], after[:]) <= 0 {
+			continue
+		}
+		balances = append(balances, &model.PlayerBalances{
+			UserID:              user.ID,
+			WalletUserID:        user.WalletUserID,
+			Currency:            user.Currency,
+			StoredBalance:       user.Balance,
+			TransactionsBalance: model.NewMoney(0, user.Currency),
+		})
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return bytes.Compare(balances[i].UserID[:], balances[j].UserID[:]) < 0
+	})
+	if len(balances) > limit {
+		balances = balances[:limit]
+	}
+
+	for _, balance := range balances {
+		net := r.users.openings[balance.UserID].MinorUnits()
+		for _, transaction := range r.transactions.transactions {
+			if transaction.UserID != balance.UserID ||
+				(transaction.Status != model.TransactionStatusCompleted && transaction.Status != model.TransactionStatusRolledBack) {
+				continue
+			}
+			amount := transaction.Amount.MinorUnits()
+			switch transaction.Type {
+			case model.TransactionTypeDeposit:
+				net += amount
+			case model.TransactionTypeWithdraw:
+				net -= amount
+			case model.TransactionTypeRollback:
+				original, ok := r.transactions.transactions[derefID(transaction.OriginalTransactionID)]
+				if ok && original.Type == model.TransactionTypeWithdraw {
+					net += amount
+				} else {
+					net -= amount
+				}
+			}
+		}
+		balance.TransactionsBalance = model.NewMoney(net, balance.Currency)
+	}
+	return balances, nil
+}
+
+func derefID(id *uuid.UUID) uuid.UUID {
+	if id == nil {
+		return uuid.Nil
+	}
+	return *id
+}
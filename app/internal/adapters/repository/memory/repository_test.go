@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/internal/core/port"
+	"kentech-project/internal/core/port/porttest"
+	"kentech-project/pkg/logger"
+	"testing"
+)
+
+func newRepositories(t *testing.T) port.Repositories {
+	log := logger.New()
+	return port.Repositories{
+		Users:        NewUserRepository(log),
+		Transactions: NewTransactionRepository(log),
+	}
+}
+
+func TestUserRepository(t *testing.T) {
+	porttest.TestUserRepository(t, newRepositories)
+}
+
+func TestTransactionRepository(t *testing.T) {
+	porttest.TestTransactionRepository(t, newRepositories)
+}
+
+func TestStoreRollsBack(t *testing.T) {
+	store := NewStore(logger.New())
+	ctx := context.Background()
+	if err := store.WalletAccounts.Add(ctx, &model.WalletAccount{WalletUserID: 1, Currency: "USD"}); err != nil {
+		t.Fatalf("add wallet account: %v", err)
+	}
+
+	failure := errors.New("failure")
+	err := store.RunInTx(ctx, func(ctx context.Context, repos port.Repositories) error {
+		account, err := repos.WalletAccounts.AssignNext(ctx, "USD")
+		if err != nil {
+			return err
+		}
+		user := &model.User{Username: "player", Email: "player@example.com", WalletUserID: account.WalletUserID, Currency: "USD"}
+		if err := repos.Users.Create(ctx, user); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("RunInTx = %v, want %v", err, failure)
+	}
+
+	if _, err := store.Users.GetByUsername(ctx, "player"); !errors.Is(err, model.ErrUserNotFound) {
+		t.Fatalf("user of a rolled back unit of work: %v, want %v", err, model.ErrUserNotFound)
+	}
+	if _, err := store.WalletAccounts.AssignNext(ctx, "USD"); err != nil {
+		t.Fatalf("account of a rolled back unit of work is not available again: %v", err)
+	}
+}
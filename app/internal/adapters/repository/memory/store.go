@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"context"
+	"kentech-project/internal/core/port"
+	"kentech-project/pkg/logger"
+	"sync"
+)
+
+type locker interface {
+	Lock()
+	Unlock()
+}
+
+// noLock is the lock of the repositories handed to a unit of work, which already holds the store lock.
+type noLock struct{}
+
+func (noLock) Lock()   {}
+func (noLock) Unlock() {}
+
+// Store holds one in-memory repository of each kind behind a single lock, and runs units of work
+// on them. A unit of work holds the lock until it ends, so units of work are serialised, and its
+// changes are undone when it fails.
+type Store struct {
+	mu              sync.Mutex
+	Users           *UserRepository
+	Transactions    *TransactionRepository
+	Bets            *BetRepository
+	WalletAccounts  *WalletAccountRepository
+	Ledger          *LedgerRepository
+	Reconciliations *ReconciliationRepository
+	logger          *logger.Logger
+}
+
+func NewStore(log *logger.Logger) *Store {
+	s := &Store{
+		Users:          NewUserRepository(log),
+		Transactions:   NewTransactionRepository(log),
+		Bets:           NewBetRepository(log),
+		WalletAccounts: NewWalletAccountRepository(log),
+		Ledger:         NewLedgerRepository(log),
+		logger:         log,
+	}
+	s.Reconciliations = NewReconciliationRepository(s.Users, s.Transactions, log)
+	s.Users.mu = &s.mu
+	s.Transactions.mu = &s.mu
+	s.Bets.mu = &s.mu
+	s.WalletAccounts.mu = &s.mu
+	s.Ledger.mu = &s.mu
+	s.Reconciliations.mu = &s.mu
+	return s
+}
+
+// RunInTx runs fn with repositories that must not be used outside of it. The repositories of the
+// store itself block until fn returns.
+func (s *Store) RunInTx(ctx context.Context, fn func(ctx context.Context, repos port.Repositories) error) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	restores := []func(){
+		s.Users.snapshot(),
+		s.Transactions.snapshot(),
+		s.Bets.snapshot(),
+		s.WalletAccounts.snapshot(),
+		s.Ledger.snapshot(),
+	}
+	rollback := func() {
+		for _, restore := range restores {
+			restore()
+		}
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+		if err != nil {
+			rollback()
+		}
+	}()
+
+	repos := port.Repositories{
+		Users:          s.Users.inTx(),
+		Transactions:   s.Transactions.inTx(),
+		Bets:           s.Bets.inTx(),
+		WalletAccounts: s.WalletAccounts.inTx(),
+		Ledger:         s.Ledger.inTx(),
+	}
+	return fn(ctx, repos)
+}
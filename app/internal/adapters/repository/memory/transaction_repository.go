@@ -0,0 +1,259 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TransactionRepository keeps transactions in memory with the semantics of
+// postgres.TransactionRepository. Transactions are copied in and out.
+type TransactionRepository struct {
+	mu           locker
+	transactions map[uuid.UUID]*model.Transaction
+	logger       *logger.Logger
+}
+
+func NewTransactionRepository(log *logger.Logger) *TransactionRepository {
+	return &TransactionRepository{
+		mu:           &sync.Mutex{},
+		transactions: make(map[uuid.UUID]*model.Transaction),
+		logger:       log,
+	}
+}
+
+func (r *TransactionRepository) inTx() *TransactionRepository {
+	return &TransactionRepository{mu: noLock{}, transactions: r.transactions, logger: r.logger}
+}
+
+func (r *TransactionRepository) snapshot() func() {
+	saved := make(map[uuid.UUID]*model.Transaction, len(r.transactions))
+	for id, transaction := range r.transactions {
+		saved[id] = cloneTransaction(transaction)
+	}
+	return func() {
+		clear(r.transactions)
+		for id, transaction := range saved {
+			r.transactions[id] = transaction
+		}
+	}
+}
+
+func cloneTransaction(transaction *model.Transaction) *model.Transaction {
+	clone := *transaction
+	if transaction.BalanceBefore != nil {
+		balance := *transaction.BalanceBefore
+		clone.BalanceBefore = &balance
+	}
+	if transaction.BalanceAfter != nil {
+		balance := *transaction.BalanceAfter
+		clone.BalanceAfter = &balance
+	}
+	if transaction.ExchangeRate != nil {
+		rate := *transaction.ExchangeRate
+		clone.ExchangeRate = &rate
+	}
+	if transaction.OriginalTransactionID != nil {
+		id := *transaction.OriginalTransactionID
+		clone.OriginalTransactionID = &id
+	}
+	if transaction.WalletTransactionID != nil {
+		id := *transaction.WalletTransactionID
+		clone.WalletTransactionID = &id
+	}
+	return &clone
+}
+
+// newestFirst orders transactions by creation time then ID, both descending, as the history is.
+func newestFirst(transactions []*model.Transaction) {
+	sort.Slice(transactions, func(i, j int) bool {
+		if !transactions[i].CreatedAt.Equal(transactions[j].CreatedAt) {
+			return transactions[i].CreatedAt.After(transactions[j].CreatedAt)
+		}
+		return bytes.Compare(transactions[i].ID[:], transactions[j].ID[:]) > 0
+	})
+}
+
+// sameKey reports whether two transactions violate a unique index of postgres: rollbacks are unique per
+// original transaction, other transactions per user, type and reference.
+func sameKey(a, b *model.Transaction) bool {
+	if a.Type != b.Type {
+		return false
+	}
+	if a.Type == model.TransactionTypeRollback {
+		return a.OriginalTransactionID != nil && b.OriginalTransactionID != nil && *a.OriginalTransactionID == *b.OriginalTransactionID
+	}
+	return a.UserID == b.UserID && a.Reference == b.Reference
+}
+
+func (r *TransactionRepository) Create(ctx context.Context, transaction *model.Transaction) error {
+	r.logger.Debug("Creating new transaction")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, other := range r.transactions {
+		if sameKey(other, transaction) {
+			r.logger.Warnf("Duplicate transaction: user_id=%s, type=%s, reference=%s", transaction.UserID.String(), transaction.Type, transaction.Reference)
+			return model.ErrDuplicateTransaction
+		}
+	}
+	transaction.ID = uuid.New()
+	transaction.CreatedAt = time.Now()
+	transaction.UpdatedAt = time.Now()
+	transaction.Version = 1
+	r.transactions[transaction.ID] = cloneTransaction(transaction)
+
+	r.logger.Infof("Transaction created: id=%s, user_id=%s, amount=%s", transaction.ID.String(), transaction.UserID.String(), transaction.Amount)
+	return nil
+}
+
+func (r *TransactionRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if transaction, ok := r.transactions[id]; ok {
+		return cloneTransaction(transaction), nil
+	}
+	r.logger.Warnf("Transaction not found: id=%s", id.String())
+	return nil, model.ErrTransactionNotFound
+}
+
+func (r *TransactionRepository) GetByReference(ctx context.Context, userID uuid.UUID, txType model.TransactionType, reference string) (*model.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, transaction := range r.transactions {
+		if transaction.UserID == userID && transaction.Type == txType && transaction.Reference == reference {
+			return cloneTransaction(transaction), nil
+		}
+	}
+	r.logger.Debugf("Transaction not found: user_id=%s, type=%s, reference=%s", userID.String(), txType, reference)
+	return nil, model.ErrTransactionNotFound
+}
+
+func (r *TransactionRepository) GetRollback(ctx context.Context, originalID uuid.UUID) (*model.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, transaction := range r.transactions {
+		if transaction.Type == model.TransactionTypeRollback && transaction.OriginalTransactionID != nil &&
+			*transaction.OriginalTransactionID == originalID {
+			return cloneTransaction(transaction), nil
+		}
+	}
+	r.logger.Debugf("Rollback not found: original_transaction_id=%s", originalID.String())
+	return nil, model.ErrTransactionNotFound
+}
+
+func (r *TransactionRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*model.Transaction, error) {
+	return r.list(model.TransactionFilter{UserID: userID}, nil, -1), nil
+}
+
+func (r *TransactionRepository) List(ctx context.Context, filter model.TransactionFilter, after *model.TransactionCursor, limit int) ([]*model.Transaction, error) {
+	return r.list(filter, after, limit), nil
+}
+
+// list returns the transactions matching filter after the cursor, newest first. A negative limit
+// returns them all.
+func (r *TransactionRepository) list(filter model.TransactionFilter, after *model.TransactionCursor, limit int) []*model.Transaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var transactions []*model.Transaction
+	for _, transaction := range r.transactions {
+		if matchesFilter(transaction, filter) && isAfter(transaction, after) {
+			transactions = append(transactions, cloneTransaction(transaction))
+		}
+	}
+	newestFirst(transactions)
+	if limit >= 0 && len(transactions) > limit {
+		transactions = transactions[:limit]
+	}
+	return transactions
+}
+
+// isAfter reports whether transaction comes after the cursor in the history.
+func isAfter(transaction *model.Transaction, after *model.TransactionCursor) bool {
+	if after == nil {
+		return true
+	}
+	if !transaction.CreatedAt.Equal(after.CreatedAt) {
+		return transaction.CreatedAt.Before(after.CreatedAt)
+	}
+	return bytes.Compare(transaction.ID[:], after.ID[:]) < 0
+}
+
+func matchesFilter(transaction *model.Transaction, filter model.TransactionFilter) bool {
+	if transaction.UserID != filter.UserID {
+		return false
+	}
+	if len(filter.Types) > 0 && !slices.Contains(filter.Types, transaction.Type) {
+		return false
+	}
+	if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, transaction.Status) {
+		return false
+	}
+	if filter.From != nil && transaction.CreatedAt.Before(*filter.From) {
+		return false
+	}
+	if filter.To != nil && !transaction.CreatedAt.Before(*filter.To) {
+		return false
+	}
+	if filter.Reference != "" && transaction.Reference != filter.Reference {
+		return false
+	}
+	if filter.MinAmount != nil {
+		if cmp, err := transaction.Amount.Cmp(*filter.MinAmount); err != nil || cmp < 0 {
+			return false
+		}
+	}
+	if filter.MaxAmount != nil {
+		if cmp, err := transaction.Amount.Cmp(*filter.MaxAmount); err != nil || cmp > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *TransactionRepository) ListStalePending(ctx context.Context, before time.Time, maxAttempts, limit int) ([]*model.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var transactions []*model.Transaction
+	for _, transaction := range r.transactions {
+		if transaction.Status == model.TransactionStatusPending && transaction.UpdatedAt.Before(before) &&
+			transaction.RecoveryAttempts < maxAttempts {
+			transactions = append(transactions, cloneTransaction(transaction))
+		}
+	}
+	sort.Slice(transactions, func(i, j int) bool { return transactions[i].UpdatedAt.Before(transactions[j].UpdatedAt) })
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+	}
+	return transactions, nil
+}
+
+func (r *TransactionRepository) Update(ctx context.Context, transaction *model.Transaction) error {
+	r.logger.Debugf("Updating transaction: id=%s, version=%d", transaction.ID.String(), transaction.Version)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	transaction.UpdatedAt = time.Now()
+	stored, ok := r.transactions[transaction.ID]
+	if !ok || stored.Version != transaction.Version {
+		r.logger.Warnf("Transaction not updated, it was modified concurrently: id=%s, version=%d", transaction.ID.String(), transaction.Version)
+		return model.ErrConcurrentModification
+	}
+	// the owner, the creation time and the link to the original transaction are not updated, as in postgres
+	transaction.Version++
+	updated := cloneTransaction(transaction)
+	updated.UserID = stored.UserID
+	updated.OriginalTransactionID = stored.OriginalTransactionID
+	updated.CreatedAt = stored.CreatedAt
+	r.transactions[transaction.ID] = updated
+	return nil
+}
@@ -0,0 +1,189 @@
+package memory
+
+import (
+	"context"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserRepository keeps users in memory with the semantics of postgres.UserRepository. Users are
+// copied in and out, so callers never share them with the repository.
+type UserRepository struct {
+	mu    locker
+	users map[uuid.UUID]*model.User
+	// openings holds the opening balances, which users do not carry
+	openings map[uuid.UUID]model.Money
+	logger   *logger.Logger
+}
+
+func NewUserRepository(log *logger.Logger) *UserRepository {
+	return &UserRepository{
+		mu:       &sync.Mutex{},
+		users:    make(map[uuid.UUID]*model.User),
+		openings: make(map[uuid.UUID]model.Money),
+		logger:   log,
+	}
+}
+
+func (r *UserRepository) inTx() *UserRepository {
+	return &UserRepository{mu: noLock{}, users: r.users, openings: r.openings, logger: r.logger}
+}
+
+func (r *UserRepository) snapshot() func() {
+	saved := make(map[uuid.UUID]*model.User, len(r.users))
+	for id, user := range r.users {
+		saved[id] = cloneUser(user)
+	}
+	savedOpenings := maps.Clone(r.openings)
+	return func() {
+		clear(r.users)
+		for id, user := range saved {
+			r.users[id] = user
+		}
+		clear(r.openings)
+		maps.Copy(r.openings, savedOpenings)
+	}
+}
+
+func cloneUser(user *model.User) *model.User {
+	clone := *user
+	if user.BalanceSyncedAt != nil {
+		syncedAt := *user.BalanceSyncedAt
+		clone.BalanceSyncedAt = &syncedAt
+	}
+	return &clone
+}
+
+// checkUnique returns the error of the unique constraint user would violate, ignoring the user itself.
+func (r *UserRepository) checkUnique(user *model.User) error {
+	for _, other := range r.users {
+		if other.ID == user.ID {
+			continue
+		}
+		if other.WalletUserID == user.WalletUserID {
+			r.logger.Warn("No more wallet user IDs available")
+			return model.ErrWalletUserIDExhausted
+		}
+		if other.Username == user.Username || other.Email == user.Email {
+			r.logger.Warnf("User already exists: username=%s, email=%s", user.Username, user.Email)
+			return model.ErrUserAlreadyExists
+		}
+	}
+	return nil
+}
+
+func (r *UserRepository) Create(ctx context.Context, user *model.User) error {
+	r.logger.Debug("Creating new user")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkUnique(user); err != nil {
+		return err
+	}
+	user.ID = uuid.New()
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = time.Now()
+	user.Balance = model.NewMoney(0, user.Currency)
+	user.BalanceSyncedAt = nil
+	user.Version = 1
+	r.users[user.ID] = cloneUser(user)
+
+	r.logger.Infof("User created: id=%s, username=%s, email=%s", user.ID.String(), user.Username, user.Email)
+	return nil
+}
+
+func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if user, ok := r.users[id]; ok {
+		return cloneUser(user), nil
+	}
+	r.logger.Warnf("User not found: id=%s", id.String())
+	return nil, model.ErrUserNotFound
+}
+
+func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*model.User, error) {
+	return r.find(func(user *model.User) bool { return user.Username == username }, "username="+username)
+}
+
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	return r.find(func(user *model.User) bool { return user.Email == email }, "email="+email)
+}
+
+func (r *UserRepository) find(match func(user *model.User) bool, key string) (*model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if match(user) {
+			return cloneUser(user), nil
+		}
+	}
+	r.logger.Warnf("User not found: %s", key)
+	return nil, model.ErrUserNotFound
+}
+
+func (r *UserRepository) Update(ctx context.Context, user *model.User) error {
+	r.logger.Debugf("Updating user: id=%s, version=%d", user.ID.String(), user.Version)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user.UpdatedAt = time.Now()
+	stored, ok := r.users[user.ID]
+	if !ok || stored.Version != user.Version {
+		r.logger.Warnf("User not updated, it was modified concurrently: id=%s, version=%d", user.ID.String(), user.Version)
+		return model.ErrConcurrentModification
+	}
+	if err := r.checkUnique(user); err != nil {
+		return err
+	}
+	// the balance sync time and creation time are not updated, as in postgres
+	user.Version++
+	updated := cloneUser(user)
+	updated.BalanceSyncedAt = stored.BalanceSyncedAt
+	updated.CreatedAt = stored.CreatedAt
+	r.users[user.ID] = updated
+	return nil
+}
+
+func (r *UserRepository) UpdateBalance(ctx context.Context, userID uuid.UUID, balance model.Money, syncedAt time.Time) error {
+	r.logger.Debugf("Updating user balance: id=%s, balance=%s", userID.String(), balance)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return nil
+	}
+	if user.BalanceSyncedAt != nil && user.BalanceSyncedAt.After(syncedAt) {
+		r.logger.Debugf("User balance not updated, a more recent balance is stored: id=%s", userID.String())
+		return nil
+	}
+	user.Balance = balance
+	user.BalanceSyncedAt = &syncedAt
+	user.UpdatedAt = time.Now()
+	user.Version++
+	return nil
+}
+
+func (r *UserRepository) SetOpeningBalance(ctx context.Context, userID uuid.UUID, balance model.Money) error {
+	r.logger.Debugf("Setting user opening balance: id=%s, balance=%s", userID.String(), balance)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return nil
+	}
+	if _, ok := r.openings[userID]; ok {
+		return nil
+	}
+	r.openings[userID] = balance
+	user.UpdatedAt = time.Now()
+	user.Version++
+	return nil
+}
@@ -0,0 +1,114 @@
+package memory
+
+import (
+	"context"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WalletAccountRepository keeps wallet accounts in memory with the semantics of
+// postgres.WalletAccountRepository.
+type WalletAccountRepository struct {
+	mu       locker
+	accounts map[int]*model.WalletAccount
+	logger   *logger.Logger
+}
+
+func NewWalletAccountRepository(log *logger.Logger) *WalletAccountRepository {
+	return &WalletAccountRepository{
+		mu:       &sync.Mutex{},
+		accounts: make(map[int]*model.WalletAccount),
+		logger:   log,
+	}
+}
+
+func (r *WalletAccountRepository) inTx() *WalletAccountRepository {
+	return &WalletAccountRepository{mu: noLock{}, accounts: r.accounts, logger: r.logger}
+}
+
+func (r *WalletAccountRepository) snapshot() func() {
+	saved := make(map[int]*model.WalletAccount, len(r.accounts))
+	for id, account := range r.accounts {
+		saved[id] = cloneWalletAccount(account)
+	}
+	return func() {
+		clear(r.accounts)
+		for id, account := range saved {
+			r.accounts[id] = account
+		}
+	}
+}
+
+func cloneWalletAccount(account *model.WalletAccount) *model.WalletAccount {
+	clone := *account
+	if account.AssignedAt != nil {
+		assignedAt := *account.AssignedAt
+		clone.AssignedAt = &assignedAt
+	}
+	return &clone
+}
+
+// sorted returns the accounts oldest first, in the order they are handed out.
+func (r *WalletAccountRepository) sorted() []*model.WalletAccount {
+	accounts := make([]*model.WalletAccount, 0, len(r.accounts))
+	for _, account := range r.accounts {
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		if !accounts[i].CreatedAt.Equal(accounts[j].CreatedAt) {
+			return accounts[i].CreatedAt.Before(accounts[j].CreatedAt)
+		}
+		return accounts[i].WalletUserID < accounts[j].WalletUserID
+	})
+	return accounts
+}
+
+func (r *WalletAccountRepository) Add(ctx context.Context, account *model.WalletAccount) error {
+	r.logger.Debugf("Adding wallet account: wallet_user_id=%d, currency=%s", account.WalletUserID, account.Currency)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.accounts[account.WalletUserID]; ok {
+		r.logger.Warnf("Wallet account already registered: wallet_user_id=%d", account.WalletUserID)
+		return model.ErrWalletAccountExists
+	}
+	account.CreatedAt = time.Now()
+	r.accounts[account.WalletUserID] = cloneWalletAccount(account)
+
+	r.logger.Infof("Wallet account added: wallet_user_id=%d, currency=%s", account.WalletUserID, account.Currency)
+	return nil
+}
+
+func (r *WalletAccountRepository) AssignNext(ctx context.Context, currency string) (*model.WalletAccount, error) {
+	r.logger.Debugf("Assigning wallet account: currency=%s", currency)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, account := range r.sorted() {
+		if account.AssignedAt != nil || (currency != "" && account.Currency != currency) {
+			continue
+		}
+		assignedAt := time.Now()
+		account.AssignedAt = &assignedAt
+		r.logger.Infof("Wallet account assigned: wallet_user_id=%d, currency=%s", account.WalletUserID, account.Currency)
+		return cloneWalletAccount(account), nil
+	}
+	r.logger.Warnf("No wallet account available: currency=%s", currency)
+	return nil, model.ErrWalletUserIDExhausted
+}
+
+func (r *WalletAccountRepository) List(ctx context.Context) ([]*model.WalletAccount, error) {
+	r.logger.Debug("Fetching wallet accounts")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var accounts []*model.WalletAccount
+	for _, account := range r.sorted() {
+		accounts = append(accounts, cloneWalletAccount(account))
+	}
+	r.logger.Infof("Fetched %d wallet accounts", len(accounts))
+	return accounts, nil
+}
@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const betColumns = `id, user_id, wallet_bet_id, provider_bet_id, withdraw_transaction_id, deposit_transaction_id,
+	stake, payout, currency, status, placed_at, settled_at, created_at, updated_at`
+
+type BetRepository struct {
+	db     dbtx
+	logger *logger.Logger
+}
+
+func NewBetRepository(db *sql.DB, log *logger.Logger) *BetRepository {
+	return &BetRepository{
+		db:     db,
+		logger: log,
+	}
+}
+
+func scanBet(row rowScanner) (*model.Bet, error) {
+	bet := &model.Bet{}
+	stake := &moneyColumn{dest: &bet.Stake}
+	payout := &moneyColumn{dest: &bet.Payout}
+	err := row.Scan(
+		&bet.ID, &bet.UserID, &bet.WalletBetID, &bet.ProviderBetID, &bet.WithdrawTransactionID, &bet.DepositTransactionID,
+		&stake.raw, &payout.raw, &bet.Currency, &bet.Status, &bet.PlacedAt, &bet.SettledAt, &bet.CreatedAt, &bet.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := parseMoneyColumns(bet.Currency, stake, payout); err != nil {
+		return nil, err
+	}
+	return bet, nil
+}
+
+// Create inserts the bet and assigns its ID and the wallet bet id generated by the database.
+func (r *BetRepository) Create(ctx context.Context, bet *model.Bet) error {
+	r.logger.Debug("Creating new bet")
+	query := `
+		INSERT INTO bets (id, user_id, provider_bet_id, withdraw_transaction_id, deposit_transaction_id,
+		stake, payout, currency, status, placed_at, settled_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING wallet_bet_id
+	`
+
+	bet.ID = uuid.New()
+	bet.CreatedAt = time.Now()
+	bet.UpdatedAt = time.Now()
+
+	err := r.db.QueryRowContext(ctx, query,
+		bet.ID, bet.UserID, bet.ProviderBetID, bet.WithdrawTransactionID, bet.DepositTransactionID,
+		bet.Stake, bet.Payout, bet.Currency, bet.Status, bet.PlacedAt, bet.SettledAt, bet.CreatedAt, bet.UpdatedAt,
+	).Scan(&bet.WalletBetID)
+
+	if err != nil {
+		r.logger.Error("Failed to create bet: " + err.Error())
+		return err
+	}
+	r.logger.Infof("Bet created: id=%s, wallet_bet_id=%d, user_id=%s", bet.ID.String(), bet.WalletBetID, bet.UserID.String())
+	return nil
+}
+
+func (r *BetRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Bet, error) {
+	r.logger.Debugf("Fetching bet by ID: %s", id.String())
+	query := `SELECT ` + betColumns + ` FROM bets WHERE id = $1`
+
+	bet, err := scanBet(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		r.logger.Warnf("Bet not found: id=%s", id.String())
+		return nil, model.ErrBetNotFound
+	}
+	if err != nil {
+		r.logger.Error("Failed to fetch bet: " + err.Error())
+		return nil, err
+	}
+	r.logger.Infof("Bet fetched: id=%s", bet.ID.String())
+	return bet, nil
+}
+
+func (r *BetRepository) GetByProviderBetID(ctx context.Context, userID uuid.UUID, providerBetID string) (*model.Bet, error) {
+	r.logger.Debugf("Fetching bet by provider bet ID: user_id=%s, provider_bet_id=%s", userID.String(), providerBetID)
+	query := `SELECT ` + betColumns + ` FROM bets WHERE user_id = $1 AND provider_bet_id = $2`
+
+	bet, err := scanBet(r.db.QueryRowContext(ctx, query, userID, providerBetID))
+	if err == sql.ErrNoRows {
+		r.logger.Warnf("Bet not found: user_id=%s, provider_bet_id=%s", userID.String(), providerBetID)
+		return nil, model.ErrBetNotFound
+	}
+	if err != nil {
+		r.logger.Error("Failed to fetch bet by provider bet ID: " + err.Error())
+		return nil, err
+	}
+	r.logger.Infof("Bet fetched: id=%s, provider_bet_id=%s", bet.ID.String(), providerBetID)
+	return bet, nil
+}
+
+func (r *BetRepository) GetByTransactionID(ctx context.Context, transactionID uuid.UUID) (*model.Bet, error) {
+	r.logger.Debugf("Fetching bet by transaction ID: %s", transactionID.String())
+	query := `SELECT ` + betColumns + ` FROM bets WHERE withdraw_transaction_id = $1 OR deposit_transaction_id = $1`
+
+	bet, err := scanBet(r.db.QueryRowContext(ctx, query, transactionID))
+	if err == sql.ErrNoRows {
+		r.logger.Debugf("Bet not found: transaction_id=%s", transactionID.String())
+		return nil, model.ErrBetNotFound
+	}
+	if err != nil {
+		r.logger.Error("Failed to fetch bet by transaction ID: " + err.Error())
+		return nil, err
+	}
+	r.logger.Infof("Bet fetched: id=%s, transaction_id=%s", bet.ID.String(), transactionID.String())
+	return bet, nil
+}
+
+func (r *BetRepository) Update(ctx context.Context, bet *model.Bet) error {
+	r.logger.Debugf("Updating bet: id=%s", bet.ID.String())
+	query := `
+		UPDATE bets SET withdraw_transaction_id = $2, deposit_transaction_id = $3, stake = $4, payout = $5,
+		status = $6, settled_at = $7, updated_at = $8 WHERE id = $1
+	`
+
+	bet.UpdatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query,
+		bet.ID, bet.WithdrawTransactionID, bet.DepositTransactionID, bet.Stake, bet.Payout,
+		bet.Status, bet.SettledAt, bet.UpdatedAt)
+
+	if err != nil {
+		r.logger.Error("Failed to update bet: " + err.Error())
+		return err
+	}
+	r.logger.Infof("Bet updated: id=%s, status=%s", bet.ID.String(), bet.Status)
+	return nil
+}
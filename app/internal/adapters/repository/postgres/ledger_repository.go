@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LedgerRepository struct {
+	db     dbtx
+	logger *logger.Logger
+}
+
+func NewLedgerRepository(db *sql.DB, log *logger.Logger) *LedgerRepository {
+	return &LedgerRepository{
+		db:     db,
+		logger: log,
+	}
+}
+
+func (r *LedgerRepository) Account(ctx context.Context, userID *uuid.UUID, accountType model.LedgerAccountType, currency string) (*model.LedgerAccount, error) {
+	r.logger.Debugf("Fetching ledger account: type=%s, currency=%s", accountType, currency)
+	// system accounts have no user, see idx_ledger_accounts_owner
+	insert := `
+		INSERT INTO ledger_accounts (id, user_id, type, currency, balance, created_at)
+		VALUES ($1, $2, $3, $4, 0, $5)
+		ON CONFLICT ((COALESCE(user_id, '00000000-0000-0000-0000-000000000000'::uuid)), type, currency) DO NOTHING
+	`
+	if _, err := r.db.ExecContext(ctx, insert, uuid.New(), userID, accountType, currency, time.Now()); err != nil {
+		r.logger.Error("Failed to create ledger account: " + err.Error())
+		return nil, err
+	}
+
+	query := `
+		SELECT id, user_id, type, currency, balance, created_at FROM ledger_accounts
+		WHERE user_id IS NOT DISTINCT FROM $1 AND type = $2 AND currency = $3
+	`
+	// player accounts are locked so the balance read stays valid until the entry is posted, system
+	// accounts are shared by every player and never locked, their balance is not kept up to date
+	if userID != nil {
+		query += ` FOR UPDATE`
+	}
+	account := &model.LedgerAccount{}
+	balance := &moneyColumn{dest: &account.Balance}
+	err := r.db.QueryRowContext(ctx, query, userID, accountType, currency).Scan(
+		&account.ID, &account.UserID, &account.Type, &account.Currency, &balance.raw, &account.CreatedAt)
+	if err != nil {
+		r.logger.Error("Failed to fetch ledger account: " + err.Error())
+		return nil, err
+	}
+	if err := parseMoneyColumns(account.Currency, balance); err != nil {
+		r.logger.Error("Failed to parse ledger account balance: " + err.Error())
+		return nil, err
+	}
+	return account, nil
+}
+
+func (r *LedgerRepository) Post(ctx context.Context, entry *model.JournalEntry) error {
+	if err := entry.Validate(); err != nil {
+		r.logger.Warnf("Rejected journal entry %q: %s", entry.Description, err.Error())
+		return err
+	}
+	r.logger.Debugf("Posting journal entry: %s", entry.Description)
+
+	entry.ID = uuid.New()
+	entry.CreatedAt = time.Now()
+	insertEntry := `INSERT INTO journal_entries (id, transaction_id, description, created_at) VALUES ($1, $2, $3, $4)`
+	if _, err := r.db.ExecContext(ctx, insertEntry, entry.ID, entry.TransactionID, entry.Description, entry.CreatedAt); err != nil {
+		r.logger.Error("Failed to create journal entry: " + err.Error())
+		return err
+	}
+
+	// only player accounts keep a running balance, updating the shared system accounts on every posting
+	// would serialise the postings of all players on their rows
+	updateAccount := `
+		UPDATE ledger_accounts SET balance = balance + $2 - $3
+		WHERE id = $1 AND user_id IS NOT NULL RETURNING balance
+	`
+	insertLine := `
+		INSERT INTO journal_lines (entry_id, account_id, debit, credit, balance_after, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	for _, line := range entry.Lines {
+		var raw string
+		err := r.db.QueryRowContext(ctx, updateAccount, line.AccountID, line.Credit, line.Debit).Scan(&raw)
+		switch {
+		case err == sql.ErrNoRows:
+			// a system account, its line has no balance after
+			line.BalanceAfter = nil
+		case err != nil:
+			r.logger.Error("Failed to update ledger account balance: " + err.Error())
+			return err
+		default:
+			line.BalanceAfter = new(model.Money)
+			balanceAfter := &moneyColumn{raw: raw, dest: line.BalanceAfter}
+			if err := parseMoneyColumns(line.Credit.Currency(), balanceAfter); err != nil {
+				r.logger.Error("Failed to parse ledger account balance: " + err.Error())
+				return err
+			}
+		}
+		_, err = r.db.ExecContext(ctx, insertLine, entry.ID, line.AccountID, line.Debit, line.Credit, line.BalanceAfter, entry.CreatedAt)
+		if err != nil {
+			r.logger.Error("Failed to create journal line: " + err.Error())
+			return err
+		}
+	}
+	r.logger.Infof("Journal entry posted: id=%s, description=%s", entry.ID.String(), entry.Description)
+	return nil
+}
+
+func (r *LedgerRepository) BalanceAt(ctx context.Context, userID uuid.UUID, currency string, at time.Time) (model.Money, error) {
+	r.logger.Debugf("Fetching ledger balance: user_id=%s, currency=%s, at=%s", userID.String(), currency, at.Format(time.RFC3339))
+	query := `
+		SELECT l.balance_after FROM journal_lines l
+		JOIN ledger_accounts a ON a.id = l.account_id
+		WHERE a.user_id = $1 AND a.type = $2 AND a.currency = $3 AND l.created_at <= $4
+		ORDER BY l.created_at DESC, l.id DESC
+		LIMIT 1
+	`
+
+	balance := &moneyColumn{dest: new(model.Money)}
+	err := r.db.QueryRowContext(ctx, query, userID, model.LedgerAccountPlayer, currency, at).Scan(&balance.raw)
+	if err == sql.ErrNoRows {
+		return model.NewMoney(0, currency), nil
+	}
+	if err != nil {
+		r.logger.Error("Failed to fetch ledger balance: " + err.Error())
+		return model.Money{}, err
+	}
+	if err := parseMoneyColumns(currency, balance); err != nil {
+		r.logger.Error("Failed to parse ledger balance: " + err.Error())
+		return model.Money{}, err
+	}
+	return *balance.dest, nil
+}
@@ -0,0 +1,285 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"kentech-project/pkg/logger"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// migrationLockKey is the advisory lock held while migrating, so replicas starting together apply
+// every migration once.
+const migrationLockKey = 7283416501
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var (
+	// ErrMigrationChecksum is returned when an applied migration was edited since.
+	ErrMigrationChecksum = errors.New("applied migration does not match its file")
+	// ErrUnknownMigration is returned when the database has a migration this build does not know,
+	// it was migrated by a newer version.
+	ErrUnknownMigration = errors.New("database has a migration unknown to this version")
+)
+
+// Migration is a versioned schema change. Checksum is the SHA-256 of Up.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationStatus is a migration and when it was applied, nil while pending.
+type MigrationStatus struct {
+	Migration *Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies the migrations of a source to the database and records them in schema_migrations.
+// Every migration runs in its own transaction with its record, so a failed one leaves nothing behind.
+type Migrator struct {
+	db         *sql.DB
+	migrations []*Migration
+	logger     *logger.Logger
+}
+
+// NewMigrator reads the migrations of source, see migrations.FS.
+func NewMigrator(db *sql.DB, source fs.FS, log *logger.Logger) (*Migrator, error) {
+	migrations, err := readMigrations(source)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+		logger:     log,
+	}, nil
+}
+
+func readMigrations(source fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version %q", entry.Name())
+		}
+		content, err := fs.ReadFile(source, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+			sum := sha256.Sum256(content)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Checksum == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies the pending migrations and returns how many were applied.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		status, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			if s.AppliedAt != nil {
+				continue
+			}
+			if err := m.apply(ctx, conn, s.Migration); err != nil {
+				return err
+			}
+			applied++
+		}
+		return nil
+	})
+	if err != nil {
+		m.logger.Error("Migration failed: " + err.Error())
+		return applied, err
+	}
+	if applied == 0 {
+		m.logger.Info("Database schema is up to date")
+	}
+	return applied, nil
+}
+
+// Down reverts the last steps applied migrations and returns how many were reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		status, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(status) - 1; i >= 0 && reverted < steps; i-- {
+			if status[i].AppliedAt == nil {
+				continue
+			}
+			if err := m.revert(ctx, conn, status[i].Migration); err != nil {
+				return err
+			}
+			reverted++
+		}
+		return nil
+	})
+	if err != nil {
+		m.logger.Error("Migration rollback failed: " + err.Error())
+	}
+	return reverted, err
+}
+
+// Status returns every migration, applied or pending, in version order.
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	var status []*MigrationStatus
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		var err error
+		status, err = m.status(ctx, conn)
+		return err
+	})
+	return status, err
+}
+
+// locked runs fn on a connection holding the migration lock. Advisory locks belong to a session,
+// so everything runs on the same connection.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	m.logger.Debug("Acquiring migration lock")
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrationLockKey); err != nil {
+			m.logger.Error("Failed to release migration lock: " + err.Error())
+		}
+	}()
+
+	create := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)
+	`
+	if _, err := conn.ExecContext(ctx, create); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// status matches the applied migrations with the known ones, verifying their checksums.
+func (m *Migrator) status(ctx context.Context, conn *sql.Conn) ([]*MigrationStatus, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	status := make([]*MigrationStatus, len(m.migrations))
+	byVersion := make(map[int]*MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		status[i] = &MigrationStatus{Migration: migration}
+		byVersion[migration.Version] = status[i]
+	}
+	for rows.Next() {
+		var version int
+		var name, checksum string
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &name, &checksum, &appliedAt); err != nil {
+			return nil, err
+		}
+		s, ok := byVersion[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d_%s", ErrUnknownMigration, version, name)
+		}
+		if s.Migration.Checksum != checksum {
+			return nil, fmt.Errorf("%w: %d_%s", ErrMigrationChecksum, version, name)
+		}
+		s.AppliedAt = &appliedAt
+	}
+	return status, rows.Err()
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration *Migration) error {
+	m.logger.Infof("Applying migration %d_%s", migration.Version, migration.Name)
+	return m.inTx(ctx, conn, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+			return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		insert := `INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)`
+		_, err := tx.ExecContext(ctx, insert, migration.Version, migration.Name, migration.Checksum, time.Now())
+		return err
+	})
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, migration *Migration) error {
+	if migration.Down == "" {
+		return fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+	}
+	m.logger.Infof("Reverting migration %d_%s", migration.Version, migration.Name)
+	return m.inTx(ctx, conn, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+			return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+		return err
+	})
+}
+
+func (m *Migrator) inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			m.logger.Error("Failed to roll back migration: " + rbErr.Error())
+		}
+		return err
+	}
+	return tx.Commit()
+}
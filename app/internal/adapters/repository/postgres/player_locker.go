@@ -0,0 +1,161 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"kentech-project/internal/adapters/lock"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// playerLockClass is the first key of the advisory locks of players, keeping them apart from the
+// migration lock and any other advisory lock.
+const playerLockClass = 1916
+
+// Polling interval of a player locked by another replica, doubled up to playerLockMaxPoll.
+const (
+	playerLockPoll    = 10 * time.Millisecond
+	playerLockMaxPoll = 500 * time.Millisecond
+)
+
+// PlayerLocker locks players across replicas with a session advisory lock. Requests of this
+// replica queue on a local lock first, and a player locked by another replica is polled without
+// holding a connection, so only held locks take a connection.
+//
+// A held lock keeps its connection for the whole operation, and the unit of work of the operation
+// needs a second one. When the pool is bounded (sql.DB.SetMaxOpenConns, before NewPlayerLocker), at
+// most half of it is held by locks, so every held lock leaves a connection for its transaction.
+type PlayerLocker struct {
+	db *sql.DB
+	// wait bounds how long Lock waits for a player
+	wait  time.Duration
+	local *lock.LocalLocker
+	// held has a slot per lock that may be held at once, nil when the pool is unbounded
+	held   chan struct{}
+	logger *logger.Logger
+}
+
+func NewPlayerLocker(db *sql.DB, wait time.Duration, log *logger.Logger) *PlayerLocker {
+	var held chan struct{}
+	if maxOpen := db.Stats().MaxOpenConnections; maxOpen > 0 {
+		held = make(chan struct{}, max(maxOpen/2, 1))
+	}
+	return &PlayerLocker{
+		db:     db,
+		wait:   wait,
+		local:  lock.NewLocalLocker(log),
+		held:   held,
+		logger: log,
+	}
+}
+
+// playerLockKey is the second key of the advisory lock of a player. Players sharing a key are only
+// serialised together.
+func playerLockKey(userID uuid.UUID) int32 {
+	return int32(binary.BigEndian.Uint32(userID[:4]) ^ binary.BigEndian.Uint32(userID[12:]))
+}
+
+// Lock holds a connection until the lock is released, advisory locks belong to a session. A player
+// not locked within the configured wait is reported as busy with model.ErrTransactionInProgress.
+func (l *PlayerLocker) Lock(ctx context.Context, userID uuid.UUID) (func(), error) {
+	waitCtx := ctx
+	if l.wait > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, l.wait)
+		defer cancel()
+	}
+
+	unlockLocal, err := l.local.Lock(waitCtx, userID)
+	if err != nil {
+		return nil, l.waitError(ctx, userID)
+	}
+	if l.held != nil {
+		select {
+		case l.held <- struct{}{}:
+		case <-waitCtx.Done():
+			unlockLocal()
+			return nil, l.waitError(ctx, userID)
+		}
+	}
+	release := func() {
+		if l.held != nil {
+			<-l.held
+		}
+		unlockLocal()
+	}
+
+	key := playerLockKey(userID)
+	conn, err := l.tryLock(waitCtx, key)
+	if err != nil {
+		release()
+		if waitCtx.Err() != nil {
+			return nil, l.waitError(ctx, userID)
+		}
+		return nil, err
+	}
+
+	return func() {
+		var unlocked bool
+		err := conn.QueryRowContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1, $2)`, playerLockClass, key).Scan(&unlocked)
+		if err != nil || !unlocked {
+			l.logger.Errorf("Failed to release player lock: user_id=%s, err=%v", userID.String(), err)
+			discard(conn)
+		} else {
+			conn.Close()
+		}
+		release()
+	}, nil
+}
+
+// tryLock polls the advisory lock of key until it is granted or ctx is done, and returns the
+// connection holding it. The connection goes back to the pool between attempts.
+func (l *PlayerLocker) tryLock(ctx context.Context, key int32) (*sql.Conn, error) {
+	poll := playerLockPoll
+	for {
+		conn, err := l.db.Conn(ctx)
+		if err != nil {
+			l.logger.Error("Failed to get a connection for the player lock: " + err.Error())
+			return nil, err
+		}
+		var locked bool
+		if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1, $2)`, playerLockClass, key).Scan(&locked); err != nil {
+			l.logger.Error("Failed to acquire player lock: " + err.Error())
+			// a lock granted while the query was canceled goes away with the session
+			discard(conn)
+			return nil, err
+		}
+		if locked {
+			return conn, nil
+		}
+		conn.Close()
+
+		select {
+		case <-time.After(poll):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		poll = min(poll*2, playerLockMaxPoll)
+	}
+}
+
+// waitError is the error of a lock not acquired: the error of ctx when the caller gave up, or a busy
+// player when the wait ran out.
+func (l *PlayerLocker) waitError(ctx context.Context, userID uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.logger.Warnf("Player lock not acquired within %s: user_id=%s", l.wait, userID.String())
+	return fmt.Errorf("%w: player locked for more than %s", model.ErrTransactionInProgress, l.wait)
+}
+
+// discard closes the session of conn instead of returning it to the pool.
+func discard(conn *sql.Conn) {
+	_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	conn.Close()
+}
@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/internal/core/port"
+	"kentech-project/pkg/logger"
+
+	"github.com/google/uuid"
+)
+
+// TestPlayerLockerAcrossReplicas locks a player with two lockers, as two replicas would.
+func TestPlayerLockerAcrossReplicas(t *testing.T) {
+	db := openTestDatabase(t)
+	first := NewPlayerLocker(db, time.Minute, logger.New())
+	second := NewPlayerLocker(db, 100*time.Millisecond, logger.New())
+	userID := uuid.New()
+
+	unlock, err := first.Lock(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+
+	if _, err := second.Lock(context.Background(), userID); !errors.Is(err, model.ErrTransactionInProgress) {
+		t.Fatalf("lock of a held player: err = %v, want %v", err, model.ErrTransactionInProgress)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := first.Lock(ctx, userID); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("lock of a held player by a caller giving up: err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	other, err := second.Lock(context.Background(), uuid.New())
+	if err != nil {
+		t.Fatalf("lock of another player: %v", err)
+	}
+	other()
+
+	unlock()
+	again, err := second.Lock(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("lock after release: %v", err)
+	}
+	again()
+}
+
+// TestPlayerLockerLeavesConnectionsForTransactions holds as many locks as a bounded pool allows and
+// runs a unit of work under each of them.
+func TestPlayerLockerLeavesConnectionsForTransactions(t *testing.T) {
+	db := openTestDatabase(t)
+	db.SetMaxOpenConns(4)
+	log := logger.New()
+	locks := NewPlayerLocker(db, 100*time.Millisecond, log)
+	uow := NewUnitOfWork(db, log)
+	ctx := context.Background()
+
+	var unlocks []func()
+	for range 2 {
+		unlock, err := locks.Lock(ctx, uuid.New())
+		if err != nil {
+			t.Fatalf("lock: %v", err)
+		}
+		unlocks = append(unlocks, unlock)
+	}
+	if _, err := locks.Lock(ctx, uuid.New()); !errors.Is(err, model.ErrTransactionInProgress) {
+		t.Fatalf("lock beyond half of the pool: err = %v, want %v", err, model.ErrTransactionInProgress)
+	}
+
+	txCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	for i := range unlocks {
+		err := uow.RunInTx(txCtx, func(ctx context.Context, repos port.Repositories) error {
+			_, err := repos.Users.GetByID(ctx, uuid.New())
+			if errors.Is(err, model.ErrUserNotFound) {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("unit of work under lock %d: %v", i+1, err)
+		}
+	}
+
+	unlocks[0]()
+	unlock, err := locks.Lock(ctx, uuid.New())
+	if err != nil {
+		t.Fatalf("lock after a release: %v", err)
+	}
+	unlock()
+	unlocks[1]()
+}
@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+)
+
+// RateRepository reads exchange rates from the exchange_rates table.
+type RateRepository struct {
+	db     dbtx
+	logger *logger.Logger
+}
+
+func NewRateRepository(db *sql.DB, log *logger.Logger) *RateRepository {
+	return &RateRepository{
+		db:     db,
+		logger: log,
+	}
+}
+
+func (r *RateRepository) GetRate(ctx context.Context, base, quote string) (*model.ExchangeRate, error) {
+	r.logger.Debugf("Fetching exchange rate: base=%s, quote=%s", base, quote)
+	query := `SELECT base_currency, quote_currency, rate, updated_at FROM exchange_rates WHERE base_currency = $1 AND quote_currency = $2`
+
+	exchangeRate := &model.ExchangeRate{}
+	var rate string
+	err := r.db.QueryRowContext(ctx, query, base, quote).Scan(
+		&exchangeRate.Base, &exchangeRate.Quote, &rate, &exchangeRate.UpdatedAt)
+	if err == sql.ErrNoRows {
+		r.logger.Debugf("Exchange rate not found: base=%s, quote=%s", base, quote)
+		return nil, model.ErrExchangeRateNotFound
+	}
+	if err != nil {
+		r.logger.Error("Failed to fetch exchange rate: " + err.Error())
+		return nil, err
+	}
+
+	exchangeRate.Rate, err = model.ParseRate(rate)
+	if err != nil {
+		r.logger.Errorf("Invalid exchange rate %s for base=%s, quote=%s", rate, base, quote)
+		return nil, err
+	}
+	return exchangeRate, nil
+}
@@ -0,0 +1,283 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const reconciliationRunColumns = `id, status, users_checked, discrepancies, error, started_at, finished_at`
+
+const reconciliationItemColumns = `id, run_id, user_id, wallet_user_id, currency, stored_balance, transactions_balance,
+	wallet_balance, wallet_error, issues, created_at`
+
+type ReconciliationRepository struct {
+	db     dbtx
+	logger *logger.Logger
+}
+
+func NewReconciliationRepository(db *sql.DB, log *logger.Logger) *ReconciliationRepository {
+	return &ReconciliationRepository{
+		db:     db,
+		logger: log,
+	}
+}
+
+func scanReconciliationRun(row rowScanner) (*model.ReconciliationRun, error) {
+	run := &model.ReconciliationRun{}
+	var runError sql.NullString
+	err := row.Scan(&run.ID, &run.Status, &run.UsersChecked, &run.Discrepancies, &runError, &run.StartedAt, &run.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	run.Error = runError.String
+	return run, nil
+}
+
+func scanReconciliationItem(row rowScanner) (*model.ReconciliationItem, error) {
+	item := &model.ReconciliationItem{}
+	storedBalance := &moneyColumn{dest: &item.StoredBalance}
+	transactionsBalance := &moneyColumn{dest: &item.TransactionsBalance}
+	var walletBalance, walletError sql.NullString
+	var issues []string
+	err := row.Scan(
+		&item.ID, &item.RunID, &item.UserID, &item.WalletUserID, &item.Currency, &storedBalance.raw,
+		&transactionsBalance.raw, &walletBalance, &walletError, pq.Array(&issues), &item.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := parseMoneyColumns(item.Currency, storedBalance, transactionsBalance); err != nil {
+		return nil, err
+	}
+	if walletBalance.Valid {
+		balance := &moneyColumn{raw: walletBalance.String, dest: new(model.Money)}
+		if err := parseMoneyColumns(item.Currency, balance); err != nil {
+			return nil, err
+		}
+		item.WalletBalance = balance.dest
+	}
+	item.WalletError = walletError.String
+	item.Issues = make([]model.ReconciliationIssue, len(issues))
+	for i, issue := range issues {
+		item.Issues[i] = model.ReconciliationIssue(issue)
+	}
+	return item, nil
+}
+
+func (r *ReconciliationRepository) CreateRun(ctx context.Context, run *model.ReconciliationRun) error {
+	r.logger.Debug("Creating reconciliation run")
+	query := `INSERT INTO reconciliation_runs (` + reconciliationRunColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	run.ID = uuid.New()
+	run.Status = model.ReconciliationStatusRunning
+	run.StartedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query,
+		run.ID, run.Status, run.UsersChecked, run.Discrepancies, nullString(run.Error), run.StartedAt, run.FinishedAt)
+	if err != nil {
+		// only one run can be running, see idx_reconciliation_runs_running
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			r.logger.Warn("Reconciliation run already in progress")
+			return model.ErrReconciliationInProgress
+		}
+		r.logger.Error("Failed to create reconciliation run: " + err.Error())
+		return err
+	}
+	r.logger.Infof("Reconciliation run created: id=%s", run.ID.String())
+	return nil
+}
+
+func (r *ReconciliationRepository) UpdateRun(ctx context.Context, run *model.ReconciliationRun) error {
+	r.logger.Debugf("Updating reconciliation run: id=%s, status=%s", run.ID.String(), run.Status)
+	query := `
+		UPDATE reconciliation_runs SET status = $2, users_checked = $3, discrepancies = $4, error = $5, finished_at = $6
+		WHERE id = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		run.ID, run.Status, run.UsersChecked, run.Discrepancies, nullString(run.Error), run.FinishedAt)
+	if err != nil {
+		r.logger.Error("Failed to update reconciliation run: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *ReconciliationRepository) AbandonRuns(ctx context.Context, before time.Time) (int, error) {
+	r.logger.Debugf("Abandoning reconciliation runs started before %s", before.Format(time.RFC3339))
+	query := `
+		UPDATE reconciliation_runs SET status = $1, error = $2, finished_at = $3
+		WHERE status = $4 AND started_at < $5
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		model.ReconciliationStatusFailed, "abandoned", time.Now(), model.ReconciliationStatusRunning, before)
+	if err != nil {
+		r.logger.Error("Failed to abandon reconciliation runs: " + err.Error())
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rows > 0 {
+		r.logger.Warnf("Abandoned %d reconciliation runs", rows)
+	}
+	return int(rows), nil
+}
+
+func (r *ReconciliationRepository) GetRun(ctx context.Context, id uuid.UUID) (*model.ReconciliationRun, error) {
+	r.logger.Debugf("Fetching reconciliation run: id=%s", id.String())
+	query := `SELECT ` + reconciliationRunColumns + ` FROM reconciliation_runs WHERE id = $1`
+
+	run, err := scanReconciliationRun(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		r.logger.Warnf("Reconciliation run not found: id=%s", id.String())
+		return nil, model.ErrReconciliationNotFound
+	}
+	if err != nil {
+		r.logger.Error("Failed to fetch reconciliation run: " + err.Error())
+		return nil, err
+	}
+	return run, nil
+}
+
+func (r *ReconciliationRepository) ListRuns(ctx context.Context, limit int) ([]*model.ReconciliationRun, error) {
+	r.logger.Debugf("Fetching reconciliation runs: limit=%d", limit)
+	query := `SELECT ` + reconciliationRunColumns + ` FROM reconciliation_runs ORDER BY started_at DESC LIMIT $1`
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		r.logger.Error("Failed to query reconciliation runs: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []*model.ReconciliationRun
+	for rows.Next() {
+		run, err := scanReconciliationRun(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan reconciliation run row: " + err.Error())
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	if rows.Err() != nil {
+		r.logger.Error("Row iteration error: " + rows.Err().Error())
+		return nil, rows.Err()
+	}
+	return runs, nil
+}
+
+func (r *ReconciliationRepository) AddItem(ctx context.Context, item *model.ReconciliationItem) error {
+	r.logger.Debugf("Adding reconciliation item: run_id=%s, user_id=%s", item.RunID.String(), item.UserID.String())
+	query := `INSERT INTO reconciliation_items (` + reconciliationItemColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+	item.ID = uuid.New()
+	item.CreatedAt = time.Now()
+	var walletBalance any
+	if item.WalletBalance != nil {
+		walletBalance = *item.WalletBalance
+	}
+	issues := make([]string, len(item.Issues))
+	for i, issue := range item.Issues {
+		issues[i] = string(issue)
+	}
+
+	_, err := r.db.ExecContext(ctx, query,
+		item.ID, item.RunID, item.UserID, item.WalletUserID, item.Currency, item.StoredBalance,
+		item.TransactionsBalance, walletBalance, nullString(item.WalletError), pq.Array(issues), item.CreatedAt)
+	if err != nil {
+		r.logger.Error("Failed to add reconciliation item: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *ReconciliationRepository) ListItems(ctx context.Context, runID uuid.UUID) ([]*model.ReconciliationItem, error) {
+	r.logger.Debugf("Fetching reconciliation items: run_id=%s", runID.String())
+	query := `SELECT ` + reconciliationItemColumns + ` FROM reconciliation_items WHERE run_id = $1 ORDER BY user_id`
+
+	rows, err := r.db.QueryContext(ctx, query, runID)
+	if err != nil {
+		r.logger.Error("Failed to query reconciliation items: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*model.ReconciliationItem
+	for rows.Next() {
+		item, err := scanReconciliationItem(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan reconciliation item row: " + err.Error())
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if rows.Err() != nil {
+		r.logger.Error("Row iteration error: " + rows.Err().Error())
+		return nil, rows.Err()
+	}
+	return items, nil
+}
+
+// ListPlayerBalances nets the transactions that moved money from the opening balance: completed
+// deposits and withdraws, the ones rolled back since, and the completed rollbacks, which reverse their
+// original transaction.
+func (r *ReconciliationRepository) ListPlayerBalances(ctx context.Context, after uuid.UUID, limit int) ([]*model.PlayerBalances, error) {
+	r.logger.Debugf("Fetching player balances: after=%s, limit=%d", after.String(), limit)
+	query := `
+		SELECT u.id, u.wallet_user_id, u.currency, u.balance,
+			COALESCE(u.opening_balance, 0) + COALESCE(SUM(CASE
+				WHEN t.type = 'deposit' THEN t.amount
+				WHEN t.type = 'withdraw' THEN -t.amount
+				WHEN t.type = 'rollback' AND o.type = 'withdraw' THEN t.amount
+				WHEN t.type = 'rollback' THEN -t.amount
+			END), 0)
+		FROM users u
+		LEFT JOIN transactions t ON t.user_id = u.id AND t.status IN ('completed', 'rolled_back')
+		LEFT JOIN transactions o ON o.id = t.original_transaction_id
+		WHERE u.id > $1
+		GROUP BY u.id
+		ORDER BY u.id
+		LIMIT $2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, after, limit)
+	if err != nil {
+		r.logger.Error("Failed to query player balances: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var balances []*model.PlayerBalances
+	for rows.Next() {
+		balance := &model.PlayerBalances{}
+		storedBalance := &moneyColumn{dest: &balance.StoredBalance}
+		transactionsBalance := &moneyColumn{dest: &balance.TransactionsBalance}
+		err := rows.Scan(&balance.UserID, &balance.WalletUserID, &balance.Currency, &storedBalance.raw, &transactionsBalance.raw)
+		if err != nil {
+			r.logger.Error("Failed to scan player balance row: " + err.Error())
+			return nil, err
+		}
+		if err := parseMoneyColumns(balance.Currency, storedBalance, transactionsBalance); err != nil {
+			r.logger.Error("Failed to parse player balances: " + err.Error())
+			return nil, err
+		}
+		balances = append(balances, balance)
+	}
+	if rows.Err() != nil {
+		r.logger.Error("Row iteration error: " + rows.Err().Error())
+		return nil, rows.Err()
+	}
+	return balances, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"kentech-project/internal/core/port"
+	"kentech-project/internal/core/port/porttest"
+	"kentech-project/migrations"
+	"kentech-project/pkg/database"
+	"kentech-project/pkg/logger"
+	"os"
+	"testing"
+)
+
+// openTestDatabase connects to the database of TEST_DATABASE_URL and migrates it. The test is skipped
+// when it is not set.
+func openTestDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := database.NewPostgresConnection(url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := NewMigrator(db, migrations.FS, logger.New())
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// newTestFactory returns repositories on the test database. Every repositories returned by the
+// factory start from empty tables, the database must not be used by anything else.
+func newTestFactory(t *testing.T) porttest.Factory {
+	db := openTestDatabase(t)
+	log := logger.New()
+	return func(t *testing.T) port.Repositories {
+		resetDatabase(t, db)
+		return port.Repositories{
+			Users:        NewUserRepository(db, log),
+			Transactions: NewTransactionRepository(db, log),
+		}
+	}
+}
+
+// resetDatabase empties the tables and registers the wallet accounts the conformance suites use.
+func resetDatabase(t *testing.T, db *sql.DB) {
+	t.Helper()
+	ctx := context.Background()
+	truncate := `
+		TRUNCATE reconciliation_items, reconciliation_runs, journal_lines, journal_entries, ledger_accounts,
+		bets, transactions, users, wallet_accounts CASCADE
+	`
+	if _, err := db.ExecContext(ctx, truncate); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	insert := `INSERT INTO wallet_accounts (wallet_user_id, currency) SELECT generate_series(1, $1::int), 'USD'`
+	if _, err := db.ExecContext(ctx, insert, porttest.MaxWalletUserID); err != nil {
+		t.Fatalf("register wallet accounts: %v", err)
+	}
+}
+
+func TestUserRepository(t *testing.T) {
+	porttest.TestUserRepository(t, newTestFactory(t))
+}
+
+func TestTransactionRepository(t *testing.T) {
+	porttest.TestTransactionRepository(t, newTestFactory(t))
+}
@@ -3,15 +3,22 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
 	"kentech-project/internal/core/domain/model"
 	"kentech-project/pkg/logger"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const transactionColumns = `id, user_id, type, amount, currency, status, reference, balance_before, balance_after,
+	game_amount, game_currency, exchange_rate, original_transaction_id, wallet_transaction_id, failure_reason,
+	recovery_attempts, version, created_at, updated_at`
+
 type TransactionRepository struct {
-	db     *sql.DB
+	db     dbtx
 	logger *logger.Logger
 }
 
@@ -22,41 +29,111 @@ func NewTransactionRepository(db *sql.DB, log *logger.Logger) *TransactionReposi
 	}
 }
 
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// moneyColumn is a NUMERIC column scanned as text, it is parsed into dest once the currency of
+// the row is known.
+type moneyColumn struct {
+	raw  string
+	dest *model.Money
+}
+
+func parseMoneyColumns(currency string, columns ...*moneyColumn) error {
+	for _, column := range columns {
+		money, err := model.ParseMoney(column.raw, currency)
+		if err != nil {
+			return err
+		}
+		*column.dest = money
+	}
+	return nil
+}
+
+func scanTransaction(row rowScanner) (*model.Transaction, error) {
+	transaction := &model.Transaction{}
+	amount := &moneyColumn{dest: &transaction.Amount}
+	gameAmount := &moneyColumn{dest: &transaction.GameAmount}
+	var balanceBefore, balanceAfter, exchangeRate, failureReason sql.NullString
+	err := row.Scan(
+		&transaction.ID, &transaction.UserID, &transaction.Type, &amount.raw, &transaction.Currency,
+		&transaction.Status, &transaction.Reference, &balanceBefore, &balanceAfter,
+		&gameAmount.raw, &transaction.GameCurrency, &exchangeRate, &transaction.OriginalTransactionID,
+		&transaction.WalletTransactionID, &failureReason, &transaction.RecoveryAttempts, &transaction.Version,
+		&transaction.CreatedAt, &transaction.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	transaction.FailureReason = failureReason.String
+	if err := parseMoneyColumns(transaction.Currency, amount); err != nil {
+		return nil, err
+	}
+	// balances are NULL for transactions recorded before they were stored
+	if balanceBefore.Valid {
+		transaction.BalanceBefore = new(model.Money)
+		column := &moneyColumn{raw: balanceBefore.String, dest: transaction.BalanceBefore}
+		if err := parseMoneyColumns(transaction.Currency, column); err != nil {
+			return nil, err
+		}
+	}
+	if balanceAfter.Valid {
+		transaction.BalanceAfter = new(model.Money)
+		column := &moneyColumn{raw: balanceAfter.String, dest: transaction.BalanceAfter}
+		if err := parseMoneyColumns(transaction.Currency, column); err != nil {
+			return nil, err
+		}
+	}
+	if err := parseMoneyColumns(transaction.GameCurrency, gameAmount); err != nil {
+		return nil, err
+	}
+	if exchangeRate.Valid {
+		rate, err := model.ParseRate(exchangeRate.String)
+		if err != nil {
+			return nil, err
+		}
+		transaction.ExchangeRate = &rate
+	}
+	return transaction, nil
+}
+
 func (r *TransactionRepository) Create(ctx context.Context, transaction *model.Transaction) error {
 	r.logger.Debug("Creating new transaction")
 	query := `
-		INSERT INTO transactions (id, user_id, type, amount, status, reference, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO transactions (` + transactionColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
 	`
 
 	transaction.ID = uuid.New()
 	transaction.CreatedAt = time.Now()
 	transaction.UpdatedAt = time.Now()
+	transaction.Version = 1
 
 	_, err := r.db.ExecContext(ctx, query,
-		transaction.ID, transaction.UserID, transaction.Type, transaction.Amount,
-		transaction.Status, transaction.Reference, transaction.CreatedAt, transaction.UpdatedAt)
+		transaction.ID, transaction.UserID, transaction.Type, transaction.Amount, transaction.Currency,
+		transaction.Status, transaction.Reference, transaction.BalanceBefore, transaction.BalanceAfter,
+		transaction.GameAmount, transaction.GameCurrency, transaction.ExchangeRate, transaction.OriginalTransactionID,
+		transaction.WalletTransactionID, nullString(transaction.FailureReason), transaction.RecoveryAttempts,
+		transaction.Version, transaction.CreatedAt, transaction.UpdatedAt)
 
 	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" &&
+			(pqErr.Constraint == "idx_transactions_user_type_reference" || pqErr.Constraint == "idx_transactions_rollback_original") {
+			r.logger.Warnf("Duplicate transaction: user_id=%s, type=%s, reference=%s", transaction.UserID.String(), transaction.Type, transaction.Reference)
+			return model.ErrDuplicateTransaction
+		}
 		r.logger.Error("Failed to create transaction: " + err.Error())
 		return err
 	}
-	r.logger.Infof("Transaction created: id=%s, user_id=%s, amount=%f", transaction.ID.String(), transaction.UserID.String(), transaction.Amount)
+	r.logger.Infof("Transaction created: id=%s, user_id=%s, amount=%s", transaction.ID.String(), transaction.UserID.String(), transaction.Amount)
 	return nil
 }
 
 func (r *TransactionRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Transaction, error) {
 	r.logger.Debugf("Fetching transaction by ID: %s", id.String())
-	query := `
-		SELECT id, user_id, type, amount, status, reference, created_at, updated_at
-		FROM transactions WHERE id = $1
-	`
-
-	transaction := &model.Transaction{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&transaction.ID, &transaction.UserID, &transaction.Type, &transaction.Amount,
-		&transaction.Status, &transaction.Reference, &transaction.CreatedAt, &transaction.UpdatedAt)
+	query := `SELECT ` + transactionColumns + ` FROM transactions WHERE id = $1`
 
+	transaction, err := scanTransaction(r.db.QueryRowContext(ctx, query, id))
 	if err == sql.ErrNoRows {
 		r.logger.Warnf("Transaction not found: id=%s", id.String())
 		return nil, model.ErrTransactionNotFound
@@ -69,12 +146,43 @@ func (r *TransactionRepository) GetByID(ctx context.Context, id uuid.UUID) (*mod
 	return transaction, nil
 }
 
+func (r *TransactionRepository) GetByReference(ctx context.Context, userID uuid.UUID, txType model.TransactionType, reference string) (*model.Transaction, error) {
+	r.logger.Debugf("Fetching transaction by reference: user_id=%s, type=%s, reference=%s", userID.String(), txType, reference)
+	query := `SELECT ` + transactionColumns + ` FROM transactions WHERE user_id = $1 AND type = $2 AND reference = $3`
+
+	transaction, err := scanTransaction(r.db.QueryRowContext(ctx, query, userID, txType, reference))
+	if err == sql.ErrNoRows {
+		r.logger.Debugf("Transaction not found: user_id=%s, type=%s, reference=%s", userID.String(), txType, reference)
+		return nil, model.ErrTransactionNotFound
+	}
+	if err != nil {
+		r.logger.Error("Failed to fetch transaction by reference: " + err.Error())
+		return nil, err
+	}
+	r.logger.Infof("Transaction fetched by reference: id=%s, reference=%s", transaction.ID.String(), reference)
+	return transaction, nil
+}
+
+func (r *TransactionRepository) GetRollback(ctx context.Context, originalID uuid.UUID) (*model.Transaction, error) {
+	r.logger.Debugf("Fetching rollback of transaction: %s", originalID.String())
+	query := `SELECT ` + transactionColumns + ` FROM transactions WHERE type = 'rollback' AND original_transaction_id = $1`
+
+	transaction, err := scanTransaction(r.db.QueryRowContext(ctx, query, originalID))
+	if err == sql.ErrNoRows {
+		r.logger.Debugf("Rollback not found: original_transaction_id=%s", originalID.String())
+		return nil, model.ErrTransactionNotFound
+	}
+	if err != nil {
+		r.logger.Error("Failed to fetch rollback: " + err.Error())
+		return nil, err
+	}
+	r.logger.Infof("Rollback fetched: id=%s, original_transaction_id=%s", transaction.ID.String(), originalID.String())
+	return transaction, nil
+}
+
 func (r *TransactionRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*model.Transaction, error) {
 	r.logger.Debugf("Fetching transactions for user_id: %s", userID.String())
-	query := `
-		SELECT id, user_id, type, amount, status, reference, created_at, updated_at
-		FROM transactions WHERE user_id = $1 ORDER BY created_at DESC
-	`
+	query := `SELECT ` + transactionColumns + ` FROM transactions WHERE user_id = $1 ORDER BY created_at DESC`
 
 	rows, err := r.db.QueryContext(ctx, query, userID)
 	if err != nil {
@@ -85,10 +193,7 @@ func (r *TransactionRepository) GetByUserID(ctx context.Context, userID uuid.UUI
 
 	var transactions []*model.Transaction
 	for rows.Next() {
-		transaction := &model.Transaction{}
-		err := rows.Scan(
-			&transaction.ID, &transaction.UserID, &transaction.Type, &transaction.Amount,
-			&transaction.Status, &transaction.Reference, &transaction.CreatedAt, &transaction.UpdatedAt)
+		transaction, err := scanTransaction(rows)
 		if err != nil {
 			r.logger.Error("Failed to scan transaction row: " + err.Error())
 			return nil, err
@@ -103,36 +208,141 @@ func (r *TransactionRepository) GetByUserID(ctx context.Context, userID uuid.UUI
 	return transactions, nil
 }
 
+func (r *TransactionRepository) List(ctx context.Context, filter model.TransactionFilter, after *model.TransactionCursor, limit int) ([]*model.Transaction, error) {
+	r.logger.Debugf("Listing transactions for user_id=%s: limit=%d", filter.UserID.String(), limit)
+	where, args := transactionFilterClause(filter)
+	if after != nil {
+		args = append(args, after.CreatedAt, after.ID)
+		where += fmt.Sprintf(" AND (created_at, id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+	args = append(args, limit)
+	query := `SELECT ` + transactionColumns + ` FROM transactions WHERE ` + where +
+		fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		r.logger.Error("Failed to query transactions: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []*model.Transaction
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan transaction row: " + err.Error())
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+	if rows.Err() != nil {
+		r.logger.Error("Row iteration error: " + rows.Err().Error())
+		return nil, rows.Err()
+	}
+	r.logger.Infof("Listed %d transactions for user_id=%s", len(transactions), filter.UserID.String())
+	return transactions, nil
+}
+
+// transactionFilterClause builds the WHERE clause selecting the transactions matching filter.
+func transactionFilterClause(filter model.TransactionFilter) (string, []any) {
+	conditions := []string{"user_id = $1"}
+	args := []any{filter.UserID}
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if len(filter.Types) > 0 {
+		types := make([]string, len(filter.Types))
+		for i, txType := range filter.Types {
+			types[i] = string(txType)
+		}
+		add("type = ANY($%d)", pq.Array(types))
+	}
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			statuses[i] = string(status)
+		}
+		add("status = ANY($%d)", pq.Array(statuses))
+	}
+	if filter.From != nil {
+		add("created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		add("created_at < $%d", *filter.To)
+	}
+	if filter.Reference != "" {
+		add("reference = $%d", filter.Reference)
+	}
+	if filter.MinAmount != nil {
+		add("amount >= $%d", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		add("amount <= $%d", *filter.MaxAmount)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+func (r *TransactionRepository) ListStalePending(ctx context.Context, before time.Time, maxAttempts, limit int) ([]*model.Transaction, error) {
+	r.logger.Debugf("Fetching stale pending transactions: before=%s, max_attempts=%d, limit=%d", before.Format(time.RFC3339), maxAttempts, limit)
+	query := `
+		SELECT ` + transactionColumns + ` FROM transactions
+		WHERE status = $1 AND updated_at < $2 AND recovery_attempts < $3
+		ORDER BY updated_at ASC LIMIT $4
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, model.TransactionStatusPending, before, maxAttempts, limit)
+	if err != nil {
+		r.logger.Error("Failed to query stale pending transactions: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []*model.Transaction
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan transaction row: " + err.Error())
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+	if rows.Err() != nil {
+		r.logger.Error("Row iteration error: " + rows.Err().Error())
+		return nil, rows.Err()
+	}
+	r.logger.Infof("Fetched %d stale pending transactions", len(transactions))
+	return transactions, nil
+}
+
 func (r *TransactionRepository) Update(ctx context.Context, transaction *model.Transaction) error {
-	r.logger.Debugf("Updating transaction: id=%s", transaction.ID.String())
+	r.logger.Debugf("Updating transaction: id=%s, version=%d", transaction.ID.String(), transaction.Version)
 	query := `
-		UPDATE transactions SET type = $2, amount = $3, status = $4,
-		reference = $5, updated_at = $6 WHERE id = $1
+		UPDATE transactions SET type = $2, amount = $3, currency = $4, status = $5,
+		reference = $6, balance_before = $7, balance_after = $8, game_amount = $9, game_currency = $10,
+		exchange_rate = $11, wallet_transaction_id = $12, failure_reason = $13, recovery_attempts = $14,
+		updated_at = $15, version = version + 1 WHERE id = $1 AND version = $16
 	`
 
 	transaction.UpdatedAt = time.Now()
 
-	_, err := r.db.ExecContext(ctx, query,
-		transaction.ID, transaction.Type, transaction.Amount, transaction.Status,
-		transaction.Reference, transaction.UpdatedAt)
+	result, err := r.db.ExecContext(ctx, query,
+		transaction.ID, transaction.Type, transaction.Amount, transaction.Currency, transaction.Status,
+		transaction.Reference, transaction.BalanceBefore, transaction.BalanceAfter, transaction.GameAmount,
+		transaction.GameCurrency, transaction.ExchangeRate, transaction.WalletTransactionID,
+		nullString(transaction.FailureReason), transaction.RecoveryAttempts, transaction.UpdatedAt,
+		transaction.Version)
 
 	if err != nil {
 		r.logger.Error("Failed to update transaction: " + err.Error())
 		return err
 	}
-	r.logger.Infof("Transaction updated: id=%s", transaction.ID.String())
-	return nil
-}
-
-func (r *TransactionRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status model.TransactionStatus) error {
-	r.logger.Debugf("Updating transaction status: id=%s, status=%s", id.String(), status)
-	query := `UPDATE transactions SET status = $2, updated_at = $3 WHERE id = $1`
-
-	_, err := r.db.ExecContext(ctx, query, id, status, time.Now())
-	if err != nil {
-		r.logger.Error("Failed to update transaction status: " + err.Error())
+	if err := checkVersion(result); err != nil {
+		r.logger.Warnf("Transaction not updated, it was modified concurrently: id=%s, version=%d", transaction.ID.String(), transaction.Version)
 		return err
 	}
-	r.logger.Infof("Transaction status updated: id=%s, status=%s", id.String(), status)
+	transaction.Version++
+	r.logger.Infof("Transaction updated: id=%s", transaction.ID.String())
 	return nil
 }
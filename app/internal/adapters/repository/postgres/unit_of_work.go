@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"kentech-project/internal/core/port"
+	"kentech-project/pkg/logger"
+)
+
+// dbtx is the subset of *sql.DB and *sql.Tx the repositories use, so the same repository code
+// runs either on the connection pool or inside a unit of work.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type UnitOfWork struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewUnitOfWork(db *sql.DB, log *logger.Logger) *UnitOfWork {
+	return &UnitOfWork{
+		db:     db,
+		logger: log,
+	}
+}
+
+func (u *UnitOfWork) RunInTx(ctx context.Context, fn func(ctx context.Context, repos port.Repositories) error) (err error) {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		u.logger.Error("Failed to begin DB transaction: " + err.Error())
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				u.logger.Error("Failed to roll back DB transaction: " + rbErr.Error())
+			}
+		}
+	}()
+
+	repos := port.Repositories{
+		Users:          &UserRepository{db: tx, logger: u.logger},
+		Transactions:   &TransactionRepository{db: tx, logger: u.logger},
+		Bets:           &BetRepository{db: tx, logger: u.logger},
+		WalletAccounts: &WalletAccountRepository{db: tx, logger: u.logger},
+		Ledger:         &LedgerRepository{db: tx, logger: u.logger},
+	}
+	if err = fn(ctx, repos); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		u.logger.Error("Failed to commit DB transaction: " + err.Error())
+		return err
+	}
+	return nil
+}
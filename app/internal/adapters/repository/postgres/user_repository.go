@@ -12,7 +12,7 @@ import (
 )
 
 type UserRepository struct {
-	db     *sql.DB
+	db     dbtx
 	logger *logger.Logger
 }
 
@@ -23,38 +23,27 @@ func NewUserRepository(db *sql.DB, log *logger.Logger) *UserRepository {
 	}
 }
 
-func mapCurrency(walletUserID int) string {
-	currencyMap := map[int]string{
-		34633089486: "USD",
-		34679664254: "EUR",
-		34616761765: "KES",
-		34673635133: "USD",
-	}
-	return currencyMap[walletUserID]
-}
-
 func (r *UserRepository) Create(ctx context.Context, user *model.User) error {
 	r.logger.Debug("Creating new user")
 
 	query := `
-		INSERT INTO users (id, wallet_user_id, username, email, password, balance, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO users (id, wallet_user_id, username, email, password, balance, currency, version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`
 
 	user.ID = uuid.New()
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
-	user.Balance = 0.0
-	user.Currency = mapCurrency(user.WalletUserID)
+	user.Balance = model.NewMoney(0, user.Currency)
+	user.Version = 1
 
 	_, err := r.db.ExecContext(ctx, query,
 		user.ID, user.WalletUserID, user.Username, user.Email, user.Password,
-		user.Balance, user.CreatedAt, user.UpdatedAt)
+		user.Balance, user.Currency, user.Version, user.CreatedAt, user.UpdatedAt)
 
 	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" && pqErr.Constraint == "users_wallet_user_id_key" {
-			r.logger.Warn("No more wallet user IDs available")
-			return model.ErrWalletUserIDExhausted
+		if uniqueErr := r.uniqueViolation(err, user); uniqueErr != nil {
+			return uniqueErr
 		}
 		r.logger.Error("Failed to create user: " + err.Error())
 		return err
@@ -63,18 +52,37 @@ func (r *UserRepository) Create(ctx context.Context, user *model.User) error {
 	return nil
 }
 
+// uniqueViolation maps the violation of a unique constraint of users to its domain error, it
+// returns nil for other errors.
+func (r *UserRepository) uniqueViolation(err error, user *model.User) error {
+	pqErr, ok := err.(*pq.Error)
+	if !ok || pqErr.Code != "23505" {
+		return nil
+	}
+	switch pqErr.Constraint {
+	case "users_wallet_user_id_key":
+		r.logger.Warn("No more wallet user IDs available")
+		return model.ErrWalletUserIDExhausted
+	case "users_username_key", "users_email_key":
+		r.logger.Warnf("User already exists: username=%s, email=%s", user.Username, user.Email)
+		return model.ErrUserAlreadyExists
+	}
+	return nil
+}
+
 func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
 	r.logger.Debugf("Fetching user by ID: %s", id.String())
 
 	query := `
-		SELECT id, wallet_user_id, username, email, password, balance, created_at, updated_at
+		SELECT id, wallet_user_id, username, email, password, balance, currency, balance_synced_at, version, created_at, updated_at
 		FROM users WHERE id = $1
 	`
 
 	user := &model.User{}
+	balance := &moneyColumn{dest: &user.Balance}
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID, &user.WalletUserID, &user.Username, &user.Email, &user.Password,
-		&user.Balance, &user.CreatedAt, &user.UpdatedAt)
+		&balance.raw, &user.Currency, &user.BalanceSyncedAt, &user.Version, &user.CreatedAt, &user.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		r.logger.Warnf("User not found: id=%s", id.String())
@@ -84,7 +92,10 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User
 		r.logger.Error("Failed to fetch user: " + err.Error())
 		return nil, err
 	}
-	user.Currency = mapCurrency(user.WalletUserID)
+	if err := parseMoneyColumns(user.Currency, balance); err != nil {
+		r.logger.Error("Failed to parse user balance: " + err.Error())
+		return nil, err
+	}
 	r.logger.Infof("User fetched: id=%s, username=%s", user.ID.String(), user.Username)
 	return user, nil
 }
@@ -93,14 +104,15 @@ func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*m
 	r.logger.Debugf("Fetching user by username: %s", username)
 
 	query := `
-		SELECT id, wallet_user_id, username, email, password, balance, created_at, updated_at
+		SELECT id, wallet_user_id, username, email, password, balance, currency, balance_synced_at, version, created_at, updated_at
 		FROM users WHERE username = $1
 	`
 
 	user := &model.User{}
+	balance := &moneyColumn{dest: &user.Balance}
 	err := r.db.QueryRowContext(ctx, query, username).Scan(
 		&user.ID, &user.WalletUserID, &user.Username, &user.Email, &user.Password,
-		&user.Balance, &user.CreatedAt, &user.UpdatedAt)
+		&balance.raw, &user.Currency, &user.BalanceSyncedAt, &user.Version, &user.CreatedAt, &user.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		r.logger.Warnf("User not found: username=%s", username)
@@ -110,7 +122,10 @@ func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*m
 		r.logger.Error("Failed to fetch user by username: " + err.Error())
 		return nil, err
 	}
-	user.Currency = mapCurrency(user.WalletUserID)
+	if err := parseMoneyColumns(user.Currency, balance); err != nil {
+		r.logger.Error("Failed to parse user balance: " + err.Error())
+		return nil, err
+	}
 	r.logger.Infof("User fetched by username: id=%s, username=%s", user.ID.String(), user.Username)
 	return user, nil
 }
@@ -119,13 +134,14 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*model.U
 	r.logger.Debugf("Fetching user by email: %s", email)
 
 	query := `
-		SELECT id, wallet_user_id, username, email, password, balance, created_at, updated_at
+		SELECT id, wallet_user_id, username, email, password, balance, currency, balance_synced_at, version, created_at, updated_at
 		FROM users WHERE email = $1
 	`
 	user := &model.User{}
+	balance := &moneyColumn{dest: &user.Balance}
 	err := r.db.QueryRowContext(ctx, query, email).Scan(
 		&user.ID, &user.WalletUserID, &user.Username, &user.Email, &user.Password,
-		&user.Balance, &user.CreatedAt, &user.UpdatedAt)
+		&balance.raw, &user.Currency, &user.BalanceSyncedAt, &user.Version, &user.CreatedAt, &user.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		r.logger.Warnf("User not found: email=%s", email)
@@ -135,41 +151,91 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*model.U
 		r.logger.Error("Failed to fetch user by email: " + err.Error())
 		return nil, err
 	}
-	user.Currency = mapCurrency(user.WalletUserID)
+	if err := parseMoneyColumns(user.Currency, balance); err != nil {
+		r.logger.Error("Failed to parse user balance: " + err.Error())
+		return nil, err
+	}
 	r.logger.Infof("User fetched by email: id=%s, email=%s", user.ID.String(), user.Email)
 	return user, nil
 }
 
 func (r *UserRepository) Update(ctx context.Context, user *model.User) error {
-	r.logger.Debugf("Updating user: id=%s", user.ID.String())
+	r.logger.Debugf("Updating user: id=%s, version=%d", user.ID.String(), user.Version)
 	query := `
 		UPDATE users SET wallet_user_id = $2, username = $3, email = $4, password = $5,
-		balance = $6, updated_at = $7 WHERE id = $1
+		balance = $6, currency = $7, updated_at = $8, version = version + 1 WHERE id = $1 AND version = $9
 	`
 
 	user.UpdatedAt = time.Now()
 
-	_, err := r.db.ExecContext(ctx, query,
+	result, err := r.db.ExecContext(ctx, query,
 		user.ID, user.WalletUserID, user.Username, user.Email, user.Password,
-		user.Balance, user.UpdatedAt)
+		user.Balance, user.Currency, user.UpdatedAt, user.Version)
 
 	if err != nil {
+		if uniqueErr := r.uniqueViolation(err, user); uniqueErr != nil {
+			return uniqueErr
+		}
 		r.logger.Error("Failed to update user: " + err.Error())
 		return err
 	}
+	if err := checkVersion(result); err != nil {
+		r.logger.Warnf("User not updated, it was modified concurrently: id=%s, version=%d", user.ID.String(), user.Version)
+		return err
+	}
+	user.Version++
 	r.logger.Infof("User updated: id=%s, username=%s", user.ID.String(), user.Username)
 	return nil
 }
 
-func (r *UserRepository) UpdateBalance(ctx context.Context, userID uuid.UUID, balance float64) error {
-	r.logger.Debugf("Updating user balance: id=%s, balance=%f", userID.String(), balance)
-	query := `UPDATE users SET balance = $2, updated_at = $3 WHERE id = $1`
+// checkVersion returns model.ErrConcurrentModification when a compare-and-swap update of a row
+// matched nothing.
+func checkVersion(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return model.ErrConcurrentModification
+	}
+	return nil
+}
+
+func (r *UserRepository) UpdateBalance(ctx context.Context, userID uuid.UUID, balance model.Money, syncedAt time.Time) error {
+	r.logger.Debugf("Updating user balance: id=%s, balance=%s", userID.String(), balance)
+	// a slow balance read must not overwrite the balance of a wallet operation that finished after it
+	query := `
+		UPDATE users SET balance = $2, balance_synced_at = $3, updated_at = $4, version = version + 1
+		WHERE id = $1 AND (balance_synced_at IS NULL OR balance_synced_at <= $3)
+	`
 
-	_, err := r.db.ExecContext(ctx, query, userID, balance, time.Now())
+	result, err := r.db.ExecContext(ctx, query, userID, balance, syncedAt, time.Now())
 	if err != nil {
 		r.logger.Error("Failed to update user balance: " + err.Error())
 		return err
 	}
-	r.logger.Infof("User balance updated: id=%s, balance=%f", userID.String(), balance)
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		r.logger.Debugf("User balance not updated, a more recent balance is stored: id=%s", userID.String())
+		return nil
+	}
+	r.logger.Infof("User balance updated: id=%s, balance=%s", userID.String(), balance)
+	return nil
+}
+
+func (r *UserRepository) SetOpeningBalance(ctx context.Context, userID uuid.UUID, balance model.Money) error {
+	r.logger.Debugf("Setting user opening balance: id=%s, balance=%s", userID.String(), balance)
+	query := `
+		UPDATE users SET opening_balance = $2, updated_at = $3, version = version + 1
+		WHERE id = $1 AND opening_balance IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, balance, time.Now())
+	if err != nil {
+		r.logger.Error("Failed to set user opening balance: " + err.Error())
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows > 0 {
+		r.logger.Infof("User opening balance set: id=%s, balance=%s", userID.String(), balance)
+	}
 	return nil
 }
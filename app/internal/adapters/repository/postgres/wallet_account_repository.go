@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+	"time"
+)
+
+const walletAccountColumns = `wallet_user_id, currency, assigned_at, created_at`
+
+type WalletAccountRepository struct {
+	db     dbtx
+	logger *logger.Logger
+}
+
+func NewWalletAccountRepository(db *sql.DB, log *logger.Logger) *WalletAccountRepository {
+	return &WalletAccountRepository{
+		db:     db,
+		logger: log,
+	}
+}
+
+func scanWalletAccount(row rowScanner) (*model.WalletAccount, error) {
+	account := &model.WalletAccount{}
+	if err := row.Scan(&account.WalletUserID, &account.Currency, &account.AssignedAt, &account.CreatedAt); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (r *WalletAccountRepository) Add(ctx context.Context, account *model.WalletAccount) error {
+	r.logger.Debugf("Adding wallet account: wallet_user_id=%d, currency=%s", account.WalletUserID, account.Currency)
+	query := `INSERT INTO wallet_accounts (` + walletAccountColumns + `) VALUES ($1, $2, $3, $4)`
+
+	account.CreatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query, account.WalletUserID, account.Currency, account.AssignedAt, account.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			r.logger.Warnf("Wallet account already registered: wallet_user_id=%d", account.WalletUserID)
+			return model.ErrWalletAccountExists
+		}
+		r.logger.Error("Failed to add wallet account: " + err.Error())
+		return err
+	}
+	r.logger.Infof("Wallet account added: wallet_user_id=%d, currency=%s", account.WalletUserID, account.Currency)
+	return nil
+}
+
+// AssignNext claims an account with SKIP LOCKED, so concurrent registrations never get the same
+// account. The claim is only final once the surrounding transaction commits.
+func (r *WalletAccountRepository) AssignNext(ctx context.Context, currency string) (*model.WalletAccount, error) {
+	r.logger.Debugf("Assigning wallet account: currency=%s", currency)
+	query := `
+		UPDATE wallet_accounts SET assigned_at = $2
+		WHERE wallet_user_id = (
+			SELECT wallet_user_id FROM wallet_accounts
+			WHERE assigned_at IS NULL AND ($1 = '' OR currency = $1)
+			ORDER BY created_at, wallet_user_id
+			LIMIT 1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + walletAccountColumns
+
+	account, err := scanWalletAccount(r.db.QueryRowContext(ctx, query, currency, time.Now()))
+	if err == sql.ErrNoRows {
+		r.logger.Warnf("No wallet account available: currency=%s", currency)
+		return nil, model.ErrWalletUserIDExhausted
+	}
+	if err != nil {
+		r.logger.Error("Failed to assign wallet account: " + err.Error())
+		return nil, err
+	}
+	r.logger.Infof("Wallet account assigned: wallet_user_id=%d, currency=%s", account.WalletUserID, account.Currency)
+	return account, nil
+}
+
+func (r *WalletAccountRepository) List(ctx context.Context) ([]*model.WalletAccount, error) {
+	r.logger.Debug("Fetching wallet accounts")
+	query := `SELECT ` + walletAccountColumns + ` FROM wallet_accounts ORDER BY created_at, wallet_user_id`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		r.logger.Error("Failed to query wallet accounts: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []*model.WalletAccount
+	for rows.Next() {
+		account, err := scanWalletAccount(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan wallet account row: " + err.Error())
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	if rows.Err() != nil {
+		r.logger.Error("Row iteration error: " + rows.Err().Error())
+		return nil, rows.Err()
+	}
+	r.logger.Infof("Fetched %d wallet accounts", len(accounts))
+	return accounts, nil
+}
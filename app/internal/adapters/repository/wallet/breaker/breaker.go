@@ -0,0 +1,183 @@
+package breaker
+
+import (
+	"fmt"
+	"kentech-project/internal/core/domain/model"
+	"sync"
+	"time"
+)
+
+type State string
+
+const (
+	StateClosed   State = "closed"
+	StateOpen     State = "open"
+	StateHalfOpen State = "half_open"
+)
+
+// Config of a CircuitBreaker. The failure rate is computed over the outcomes of the
+// last WindowSize calls, once at least MinRequests calls have been recorded.
+type Config struct {
+	WindowSize           int
+	MinRequests          int
+	FailureRateThreshold float64
+	// Cooldown is how long the breaker stays open before letting probe calls through.
+	Cooldown time.Duration
+	// HalfOpenMaxCalls is the number of probe calls allowed while half-open, all of
+	// them must succeed to close the breaker again.
+	HalfOpenMaxCalls int
+}
+
+// OpenError is returned instead of calling the wallet while the breaker is open.
+type OpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%s: circuit breaker is open, retry after %s", model.ErrWalletUnavailable.Error(), e.RetryAfter)
+}
+
+func (e *OpenError) Is(target error) bool {
+	return target == model.ErrWalletUnavailable
+}
+
+// Ticket is handed out by Allow and identifies the state the call was allowed in: outcomes of
+// calls allowed before the latest state change are ignored.
+type Ticket struct {
+	generation uint64
+}
+
+// CircuitBreaker is a count based closed/open/half-open circuit breaker.
+type CircuitBreaker struct {
+	cfg Config
+	now func() time.Time
+
+	mu               sync.Mutex
+	state            State
+	generation       uint64 // incremented on every state change
+	outcomes         []bool // ring buffer of the last calls, true for failures
+	next             int
+	recorded         int
+	failures         int
+	openedAt         time.Time
+	halfOpenInFlight int
+	halfOpenPassed   int
+}
+
+func NewCircuitBreaker(cfg Config) *CircuitBreaker {
+	if cfg.WindowSize < 1 {
+		cfg.WindowSize = 1
+	}
+	if cfg.MinRequests < 1 {
+		cfg.MinRequests = 1
+	}
+	if cfg.HalfOpenMaxCalls < 1 {
+		cfg.HalfOpenMaxCalls = 1
+	}
+	return &CircuitBreaker{
+		cfg:      cfg,
+		now:      time.Now,
+		state:    StateClosed,
+		outcomes: make([]bool, cfg.WindowSize),
+	}
+}
+
+func (b *CircuitBreaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.cfg.Cooldown {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// Allow reports whether a call may proceed. Every allowed call must be followed by Record or
+// Release with the returned ticket.
+func (b *CircuitBreaker) Allow() (Ticket, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen {
+		elapsed := b.now().Sub(b.openedAt)
+		if elapsed < b.cfg.Cooldown {
+			return Ticket{}, &OpenError{RetryAfter: b.cfg.Cooldown - elapsed}
+		}
+		b.state = StateHalfOpen
+		b.generation++
+		b.halfOpenInFlight = 0
+		b.halfOpenPassed = 0
+	}
+
+	if b.state == StateHalfOpen {
+		if b.halfOpenInFlight+b.halfOpenPassed >= b.cfg.HalfOpenMaxCalls {
+			return Ticket{}, &OpenError{RetryAfter: b.cfg.Cooldown}
+		}
+		b.halfOpenInFlight++
+	}
+	return Ticket{generation: b.generation}, nil
+}
+
+// Record registers the outcome of a call allowed by Allow. A call allowed before the latest state
+// change, like a slow call started while closed and ending after the cooldown, is not a probe of
+// the current state and its outcome is ignored.
+func (b *CircuitBreaker) Record(ticket Ticket, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ticket.generation != b.generation {
+		return
+	}
+	switch b.state {
+	case StateHalfOpen:
+		b.halfOpenInFlight--
+		if failed {
+			b.open()
+			return
+		}
+		b.halfOpenPassed++
+		if b.halfOpenPassed >= b.cfg.HalfOpenMaxCalls {
+			b.close()
+		}
+	case StateClosed:
+		if b.recorded == len(b.outcomes) && b.outcomes[b.next] {
+			b.failures--
+		}
+		b.outcomes[b.next] = failed
+		b.next = (b.next + 1) % len(b.outcomes)
+		if b.recorded < len(b.outcomes) {
+			b.recorded++
+		}
+		if failed {
+			b.failures++
+		}
+		if b.recorded >= b.cfg.MinRequests && float64(b.failures)/float64(b.recorded) >= b.cfg.FailureRateThreshold {
+			b.open()
+		}
+	}
+}
+
+// Release gives back a call slot without recording an outcome, e.g. when the caller gave up.
+func (b *CircuitBreaker) Release(ticket Ticket) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ticket.generation == b.generation && b.state == StateHalfOpen && b.halfOpenInFlight > 0 {
+		b.halfOpenInFlight--
+	}
+}
+
+func (b *CircuitBreaker) open() {
+	b.state = StateOpen
+	b.generation++
+	b.openedAt = b.now()
+}
+
+func (b *CircuitBreaker) close() {
+	b.state = StateClosed
+	b.generation++
+	b.next = 0
+	b.recorded = 0
+	b.failures = 0
+	for i := range b.outcomes {
+		b.outcomes[i] = false
+	}
+}
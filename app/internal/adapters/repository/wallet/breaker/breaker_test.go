@@ -0,0 +1,192 @@
+package breaker
+
+import (
+	"errors"
+	"kentech-project/internal/core/domain/model"
+	"testing"
+	"time"
+)
+
+// clock is a fake time source the tests move forward by hand.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time { return c.t }
+
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(cfg Config) (*CircuitBreaker, *clock) {
+	c := &clock{t: time.Unix(0, 0)}
+	b := NewCircuitBreaker(cfg)
+	b.now = c.now
+	return b, c
+}
+
+// call runs one call through the breaker, failing as told, and fails the test if it is refused.
+func call(t *testing.T, b *CircuitBreaker, failed bool) {
+	t.Helper()
+	ticket, err := b.Allow()
+	if err != nil {
+		t.Fatalf("allow: %v", err)
+	}
+	b.Record(ticket, failed)
+}
+
+func assertState(t *testing.T, b *CircuitBreaker, want State) {
+	t.Helper()
+	if got := b.State(); got != want {
+		t.Fatalf("state = %s, want %s", got, want)
+	}
+}
+
+func assertRefused(t *testing.T, b *CircuitBreaker, retryAfter time.Duration) {
+	t.Helper()
+	_, err := b.Allow()
+	var openErr *OpenError
+	if !errors.As(err, &openErr) || !errors.Is(err, model.ErrWalletUnavailable) {
+		t.Fatalf("allow: err = %v, want an open breaker error", err)
+	}
+	if openErr.RetryAfter != retryAfter {
+		t.Fatalf("retry after = %s, want %s", openErr.RetryAfter, retryAfter)
+	}
+}
+
+func TestOpensOnceMinRequestsAreRecorded(t *testing.T) {
+	b, _ := newTestBreaker(Config{WindowSize: 4, MinRequests: 3, FailureRateThreshold: 0.5, Cooldown: time.Minute})
+
+	call(t, b, true)
+	call(t, b, true)
+	// every call failed, but too few were made to judge
+	assertState(t, b, StateClosed)
+
+	call(t, b, false)
+	assertState(t, b, StateOpen)
+}
+
+func TestFailureRateOverTheWindow(t *testing.T) {
+	b, _ := newTestBreaker(Config{WindowSize: 4, MinRequests: 4, FailureRateThreshold: 0.75, Cooldown: time.Minute})
+
+	outcomes := []struct {
+		failed bool
+		want   State
+	}{
+		{true, StateClosed},  // F
+		{true, StateClosed},  // F F
+		{false, StateClosed}, // F F S
+		{false, StateClosed}, // F F S S: 2 of 4
+		{true, StateClosed},  // F S S F: the first failure left the window
+		{true, StateClosed},  // S S F F
+		{true, StateOpen},    // S F F F: 3 of 4
+	}
+	for i, outcome := range outcomes {
+		call(t, b, outcome.failed)
+		if got := b.State(); got != outcome.want {
+			t.Fatalf("after call %d: state = %s, want %s", i+1, got, outcome.want)
+		}
+	}
+}
+
+func TestOpenUntilCooldown(t *testing.T) {
+	b, c := newTestBreaker(Config{WindowSize: 2, MinRequests: 2, FailureRateThreshold: 0.5, Cooldown: time.Minute})
+	call(t, b, true)
+	call(t, b, false)
+	assertState(t, b, StateOpen)
+	assertRefused(t, b, time.Minute)
+
+	c.advance(40 * time.Second)
+	assertState(t, b, StateOpen)
+	assertRefused(t, b, 20*time.Second)
+
+	c.advance(20 * time.Second)
+	assertState(t, b, StateHalfOpen)
+	if _, err := b.Allow(); err != nil {
+		t.Fatalf("allow after cooldown: %v", err)
+	}
+}
+
+func TestHalfOpen(t *testing.T) {
+	cfg := Config{WindowSize: 2, MinRequests: 2, FailureRateThreshold: 0.5, Cooldown: time.Minute, HalfOpenMaxCalls: 2}
+	halfOpen := func(t *testing.T) (*CircuitBreaker, *clock) {
+		b, c := newTestBreaker(cfg)
+		call(t, b, true)
+		call(t, b, true)
+		c.advance(time.Minute)
+		assertState(t, b, StateHalfOpen)
+		return b, c
+	}
+
+	t.Run("limits probe calls", func(t *testing.T) {
+		b, _ := halfOpen(t)
+		var probe Ticket
+		for i := 0; i < cfg.HalfOpenMaxCalls; i++ {
+			ticket, err := b.Allow()
+			if err != nil {
+				t.Fatalf("probe %d: %v", i+1, err)
+			}
+			probe = ticket
+		}
+		assertRefused(t, b, time.Minute)
+
+		// a probe given up on frees its slot
+		b.Release(probe)
+		if _, err := b.Allow(); err != nil {
+			t.Fatalf("probe after release: %v", err)
+		}
+	})
+
+	t.Run("closes when every probe succeeds", func(t *testing.T) {
+		b, _ := halfOpen(t)
+		call(t, b, false)
+		assertState(t, b, StateHalfOpen)
+		call(t, b, false)
+		assertState(t, b, StateClosed)
+
+		// the window starts over, the failures that opened the breaker are gone
+		call(t, b, true)
+		assertState(t, b, StateClosed)
+	})
+
+	t.Run("opens again when a probe fails", func(t *testing.T) {
+		b, c := halfOpen(t)
+		call(t, b, false)
+		call(t, b, true)
+		assertState(t, b, StateOpen)
+		assertRefused(t, b, time.Minute)
+
+		c.advance(time.Minute)
+		assertState(t, b, StateHalfOpen)
+	})
+	t.Run("ignores calls allowed while closed", func(t *testing.T) {
+		b, c := newTestBreaker(cfg)
+		slow, err := b.Allow()
+		if err != nil {
+			t.Fatalf("allow slow call: %v", err)
+		}
+		call(t, b, true)
+		call(t, b, true)
+		c.advance(time.Minute)
+		probe, err := b.Allow()
+		if err != nil {
+			t.Fatalf("probe: %v", err)
+		}
+
+		// the slow call ends after the half-open transition, it is not a probe
+		b.Record(slow, false)
+		b.Record(slow, false)
+		assertState(t, b, StateHalfOpen)
+		b.Record(slow, true)
+		assertState(t, b, StateHalfOpen)
+		b.Release(slow)
+
+		// the probe slots are untouched by the slow call
+		second, err := b.Allow()
+		if err != nil {
+			t.Fatalf("second probe: %v", err)
+		}
+		assertRefused(t, b, time.Minute)
+		b.Record(probe, false)
+		b.Record(second, false)
+		assertState(t, b, StateClosed)
+	})
+}
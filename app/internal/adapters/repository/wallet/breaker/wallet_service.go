@@ -0,0 +1,91 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"kentech-project/internal/adapters/repository/wallet"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/internal/core/port"
+	"kentech-project/pkg/logger"
+	"net/http"
+)
+
+// WalletService wraps a port.WalletService with a circuit breaker, so calls fail fast with
+// an OpenError while the wallet is down instead of waiting for the HTTP timeout.
+type WalletService struct {
+	next    port.WalletService
+	breaker *CircuitBreaker
+	logger  *logger.Logger
+}
+
+func NewWalletService(next port.WalletService, cfg Config, log *logger.Logger) *WalletService {
+	return &WalletService{
+		next:    next,
+		breaker: NewCircuitBreaker(cfg),
+		logger:  log,
+	}
+}
+
+func (w *WalletService) State() State {
+	return w.breaker.State()
+}
+
+func (w *WalletService) ProcessDeposit(ctx context.Context, userID int, amount model.Money, betID int, reference string) (wallet.OperationResponse, error) {
+	ticket, err := w.allow()
+	if err != nil {
+		return wallet.OperationResponse{}, err
+	}
+	resp, err := w.next.ProcessDeposit(ctx, userID, amount, betID, reference)
+	w.record(ctx, ticket, err)
+	return resp, err
+}
+
+func (w *WalletService) ProcessWithdraw(ctx context.Context, userID int, amount model.Money, betID int, reference string) (wallet.OperationResponse, error) {
+	ticket, err := w.allow()
+	if err != nil {
+		return wallet.OperationResponse{}, err
+	}
+	resp, err := w.next.ProcessWithdraw(ctx, userID, amount, betID, reference)
+	w.record(ctx, ticket, err)
+	return resp, err
+}
+
+func (w *WalletService) GetBalance(ctx context.Context, userID int) (model.Money, error) {
+	ticket, err := w.allow()
+	if err != nil {
+		return model.Money{}, err
+	}
+	balance, err := w.next.GetBalance(ctx, userID)
+	w.record(ctx, ticket, err)
+	return balance, err
+}
+
+func (w *WalletService) allow() (Ticket, error) {
+	ticket, err := w.breaker.Allow()
+	if err != nil {
+		w.logger.Warn("Wallet call rejected: " + err.Error())
+		return Ticket{}, err
+	}
+	return ticket, nil
+}
+
+// record counts transport errors and 5xx responses as failures. Business errors (4xx) show the
+// wallet is up, and calls abandoned by the caller say nothing about the wallet at all.
+func (w *WalletService) record(ctx context.Context, ticket Ticket, err error) {
+	if err != nil && ctx.Err() != nil {
+		w.breaker.Release(ticket)
+		return
+	}
+
+	failed := err != nil
+	var walletErr *wallet.WalletError
+	if errors.As(err, &walletErr) && walletErr.StatusCode < http.StatusInternalServerError {
+		failed = false
+	}
+
+	before := w.breaker.State()
+	w.breaker.Record(ticket, failed)
+	if after := w.breaker.State(); after != before {
+		w.logger.Warnf("Wallet circuit breaker state changed: %s -> %s", before, after)
+	}
+}
@@ -0,0 +1,389 @@
+package fakewallet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DuplicateMode is how the wallet answers an operation repeating a reference it already applied.
+type DuplicateMode string
+
+const (
+	// DuplicateReplay answers with the response of the first operation without applying it again.
+	DuplicateReplay DuplicateMode = "replay"
+	// DuplicateApply applies the operation again, like a wallet without idempotency.
+	DuplicateApply DuplicateMode = "apply"
+)
+
+// Faults are injected at random into the requests not forced by Script. Rates are fractions of the
+// requests, 0 to 1, drawn from a generator seeded with Seed so a run can be repeated.
+type Faults struct {
+	// Latency is added to every response.
+	Latency time.Duration
+	// ErrorRate of the requests are answered with 500 without being applied.
+	ErrorRate float64
+	// TimeoutRate of the requests are never answered, they end when the client gives up.
+	TimeoutRate float64
+	// LostResponseRate of the operations are applied but answered with 500, as when the response of
+	// the wallet is lost.
+	LostResponseRate float64
+	Seed             int64
+}
+
+// Outcome forces the result of one request, see Server.Script.
+type Outcome struct {
+	// Status answers the request with an error of this status, 0 answers it normally.
+	Status int
+	// Delay before answering.
+	Delay time.Duration
+	// Hang never answers, the request ends when the client gives up.
+	Hang bool
+	// Applied applies an operation answered with an error Status.
+	Applied bool
+}
+
+// Request is a request received by the fake, recorded for assertions.
+type Request struct {
+	Method string
+	Path   string
+	Status int
+}
+
+type account struct {
+	balance model.Money
+}
+
+type operationRequest struct {
+	Currency     string `json:"currency"`
+	UserID       int    `json:"userId"`
+	Transactions []struct {
+		Amount    json.Number `json:"amount"`
+		BetID     int         `json:"betId"`
+		Reference string      `json:"reference"`
+	} `json:"transactions"`
+}
+
+// operationResponse sends the balance as a string, as WalletClient expects.
+type operationResponse struct {
+	Balance      string                         `json:"balance"`
+	Transactions []operationResponseTransaction `json:"transactions"`
+}
+
+type operationResponseTransaction struct {
+	ID        int    `json:"id"`
+	Reference string `json:"reference"`
+}
+
+type errorResponse struct {
+	Code string `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+// Server is an in-memory fake of the wallet API: balance, deposit and withdraw. It serves
+// the API on its own with cmd/fakewallet or in tests through httptest.NewServer. Accounts must be
+// seeded with SetBalance.
+type Server struct {
+	apiKey     string
+	duplicates DuplicateMode
+	logger     *logger.Logger
+
+	mu       sync.Mutex
+	accounts map[int]*account
+	// responses of the applied operations by reference, replayed to duplicates
+	responses map[string]operationResponse
+	nextID    int
+	faults    Faults
+	random    *rand.Rand
+	script    []Outcome
+	requests  []Request
+}
+
+// NewServer returns an empty wallet. Requests must carry apiKey in the x-api-key header, unless
+// it is empty.
+func NewServer(apiKey string, duplicates DuplicateMode, log *logger.Logger) *Server {
+	if duplicates == "" {
+		duplicates = DuplicateReplay
+	}
+	return &Server{
+		apiKey:     apiKey,
+		duplicates: duplicates,
+		logger:     log,
+		accounts:   make(map[int]*account),
+		responses:  make(map[string]operationResponse),
+		nextID:     1,
+		random:     rand.New(rand.NewSource(0)),
+	}
+}
+
+// SetBalance creates the account of a wallet user or replaces its balance.
+func (s *Server) SetBalance(userID int, balance model.Money) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts[userID] = &account{balance: balance}
+}
+
+// Balance returns the balance of a wallet user.
+func (s *Server) Balance(userID int) (model.Money, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, ok := s.accounts[userID]
+	if !ok {
+		return model.Money{}, false
+	}
+	return acc.balance, true
+}
+
+// SetFaults replaces the random faults and reseeds their generator.
+func (s *Server) SetFaults(faults Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = faults
+	s.random = rand.New(rand.NewSource(faults.Seed))
+}
+
+// Script queues the outcomes of the next requests, one per request in arrival order. Scripted
+// requests are not subject to the random faults.
+func (s *Server) Script(outcomes ...Outcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.script = append(s.script, outcomes...)
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.apiKey != "" && r.Header.Get("x-api-key") != s.apiKey {
+		s.record(r, http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid api key")
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/_fake/") {
+		status, body := s.control(r)
+		writeJSON(w, status, body)
+		return
+	}
+
+	// the connection closing is only noticed once the body is read, so a client giving up on a
+	// hanging request would go unnoticed
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(payload))
+
+	outcome := s.nextOutcome()
+	if outcome.Hang {
+		s.record(r, 0)
+		s.logger.Debugf("Fake wallet hanging on %s %s", r.Method, r.URL.Path)
+		<-r.Context().Done()
+		return
+	}
+	if outcome.Delay > 0 {
+		select {
+		case <-time.After(outcome.Delay):
+		case <-r.Context().Done():
+			s.record(r, 0)
+			return
+		}
+	}
+	if outcome.Status != 0 && !outcome.Applied {
+		s.record(r, outcome.Status)
+		writeError(w, outcome.Status, "INJECTED_FAULT", "injected fault")
+		return
+	}
+
+	status, body := s.handle(r)
+	if outcome.Status != 0 {
+		s.logger.Debugf("Fake wallet applied %s %s but answers %d", r.Method, r.URL.Path, outcome.Status)
+		status, body = outcome.Status, errorResponse{Code: "INJECTED_FAULT", Msg: "injected fault"}
+	}
+	s.record(r, status)
+	writeJSON(w, status, body)
+}
+
+// nextOutcome takes the next scripted outcome, or draws one from the random faults.
+func (s *Server) nextOutcome() Outcome {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.script) > 0 {
+		outcome := s.script[0]
+		s.script = s.script[1:]
+		return outcome
+	}
+
+	outcome := Outcome{Delay: s.faults.Latency}
+	switch draw := s.random.Float64(); {
+	case draw < s.faults.TimeoutRate:
+		outcome.Hang = true
+	case draw < s.faults.TimeoutRate+s.faults.ErrorRate:
+		outcome.Status = http.StatusInternalServerError
+	case draw < s.faults.TimeoutRate+s.faults.ErrorRate+s.faults.LostResponseRate:
+		outcome.Status = http.StatusInternalServerError
+		outcome.Applied = true
+	}
+	return outcome
+}
+
+func (s *Server) handle(r *http.Request) (int, any) {
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/v1/balance/"):
+		return s.balance(strings.TrimPrefix(r.URL.Path, "/api/v1/balance/"))
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/deposit":
+		return s.operate(r, 1)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/withdraw":
+		return s.operate(r, -1)
+	default:
+		return http.StatusNotFound, errorResponse{Code: "NOT_FOUND", Msg: "unknown endpoint"}
+	}
+}
+
+func (s *Server) balance(userIDParam string) (int, any) {
+	userID, err := strconv.Atoi(userIDParam)
+	if err != nil {
+		return http.StatusBadRequest, errorResponse{Code: "INVALID_USER", Msg: "invalid user id"}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, ok := s.accounts[userID]
+	if !ok {
+		return http.StatusBadRequest, errorResponse{Code: "USER_NOT_FOUND", Msg: "user not found"}
+	}
+	return http.StatusOK, struct {
+		Balance  model.Money `json:"balance"`
+		Currency string      `json:"currency"`
+	}{acc.balance, acc.balance.Currency()}
+}
+
+// operate applies a deposit (sign 1) or a withdraw (sign -1). All transactions of the request are
+// applied or none.
+func (s *Server) operate(r *http.Request, sign int64) (int, any) {
+	var req operationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Transactions) == 0 {
+		return http.StatusBadRequest, errorResponse{Code: "INVALID_REQUEST", Msg: "invalid request body"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, ok := s.accounts[req.UserID]
+	if !ok {
+		return http.StatusBadRequest, errorResponse{Code: "USER_NOT_FOUND", Msg: "user not found"}
+	}
+	if req.Currency != acc.balance.Currency() {
+		return http.StatusBadRequest, errorResponse{Code: "CURRENCY_MISMATCH", Msg: "currency does not match the wallet"}
+	}
+
+	if len(req.Transactions) == 1 && s.duplicates == DuplicateReplay {
+		if previous, ok := s.responses[req.Transactions[0].Reference]; ok {
+			return http.StatusCreated, previous
+		}
+	}
+
+	balance := acc.balance
+	for _, tx := range req.Transactions {
+		amount, err := model.ParseMoney(tx.Amount.String(), req.Currency)
+		if err != nil || amount.IsNegative() {
+			return http.StatusBadRequest, errorResponse{Code: "INVALID_AMOUNT", Msg: fmt.Sprintf("invalid amount %s", tx.Amount)}
+		}
+		if sign < 0 {
+			amount = amount.Neg()
+		}
+		balance, _ = balance.Add(amount)
+	}
+	if balance.IsNegative() {
+		return http.StatusBadRequest, errorResponse{Code: "INSUFFICIENT_FUNDS", Msg: "insufficient funds"}
+	}
+
+	acc.balance = balance
+	response := operationResponse{Balance: balance.String()}
+	for _, tx := range req.Transactions {
+		response.Transactions = append(response.Transactions, operationResponseTransaction{ID: s.nextID, Reference: tx.Reference})
+		s.nextID++
+	}
+	for _, tx := range req.Transactions {
+		s.responses[tx.Reference] = response
+	}
+	return http.StatusCreated, response
+}
+
+// control serves the endpoints changing the fake at runtime, for local development. They are not
+// subject to faults.
+func (s *Server) control(r *http.Request) (int, any) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/_fake/accounts":
+		var req struct {
+			UserID   int         `json:"userId"`
+			Balance  json.Number `json:"balance"`
+			Currency string      `json:"currency"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return http.StatusBadRequest, errorResponse{Code: "INVALID_REQUEST", Msg: "invalid request body"}
+		}
+		balance, err := model.ParseMoney(req.Balance.String(), req.Currency)
+		if err != nil {
+			return http.StatusBadRequest, errorResponse{Code: "INVALID_AMOUNT", Msg: err.Error()}
+		}
+		s.SetBalance(req.UserID, balance)
+		return http.StatusOK, struct{}{}
+	case r.Method == http.MethodPut && r.URL.Path == "/_fake/faults":
+		var faults struct {
+			Latency          string  `json:"latency"`
+			ErrorRate        float64 `json:"errorRate"`
+			TimeoutRate      float64 `json:"timeoutRate"`
+			LostResponseRate float64 `json:"lostResponseRate"`
+			Seed             int64   `json:"seed"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&faults); err != nil {
+			return http.StatusBadRequest, errorResponse{Code: "INVALID_REQUEST", Msg: "invalid request body"}
+		}
+		var latency time.Duration
+		if faults.Latency != "" {
+			var err error
+			if latency, err = time.ParseDuration(faults.Latency); err != nil {
+				return http.StatusBadRequest, errorResponse{Code: "INVALID_REQUEST", Msg: err.Error()}
+			}
+		}
+		s.SetFaults(Faults{
+			Latency:          latency,
+			ErrorRate:        faults.ErrorRate,
+			TimeoutRate:      faults.TimeoutRate,
+			LostResponseRate: faults.LostResponseRate,
+			Seed:             faults.Seed,
+		})
+		s.logger.Infof("Fake wallet faults set to %+v", faults)
+		return http.StatusOK, struct{}{}
+	default:
+		return http.StatusNotFound, errorResponse{Code: "NOT_FOUND", Msg: "unknown endpoint"}
+	}
+}
+
+func (s *Server) record(r *http.Request, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Status: status})
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	writeJSON(w, status, errorResponse{Code: code, Msg: msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,207 @@
+package fakewallet
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kentech-project/internal/adapters/repository/wallet"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+)
+
+const (
+	testAPIKey = "test-key"
+	testUserID = 34633089486
+)
+
+func newTestWallet(t *testing.T, duplicates DuplicateMode, maxAttempts int) (*Server, *wallet.WalletClient) {
+	t.Helper()
+	log := logger.New()
+	fake := NewServer(testAPIKey, duplicates, log)
+	fake.SetBalance(testUserID, model.NewMoney(10000, "USD"))
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	client := wallet.NewWalletClient(srv.URL, log, testAPIKey, wallet.RetryPolicy{
+		MaxAttempts:       maxAttempts,
+		InitialBackoff:    time.Millisecond,
+		MaxBackoff:        time.Millisecond,
+		Multiplier:        1,
+		AttemptTimeout:    200 * time.Millisecond,
+		RetryableStatuses: []int{500, 502, 503, 504},
+	})
+	return fake, client
+}
+
+func assertBalance(t *testing.T, fake *Server, want int64) {
+	t.Helper()
+	balance, ok := fake.Balance(testUserID)
+	if !ok {
+		t.Fatalf("account %d not found", testUserID)
+	}
+	if balance.MinorUnits() != want {
+		t.Fatalf("balance = %s, want %s", balance, model.NewMoney(want, "USD"))
+	}
+}
+
+func TestOperations(t *testing.T) {
+	fake, client := newTestWallet(t, DuplicateReplay, 1)
+	ctx := context.Background()
+
+	resp, err := client.ProcessWithdraw(ctx, testUserID, model.NewMoney(2550, "USD"), 1, "bet-1")
+	if err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	if resp.Balance != "74.50" || len(resp.Transactions) != 1 || resp.Transactions[0].Reference != "bet-1" {
+		t.Fatalf("unexpected withdraw response %+v", resp)
+	}
+
+	if _, err := client.ProcessDeposit(ctx, testUserID, model.NewMoney(1000, "USD"), 1, "win-1"); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	balance, err := client.GetBalance(ctx, testUserID)
+	if err != nil {
+		t.Fatalf("balance: %v", err)
+	}
+	if balance.MinorUnits() != 8450 || balance.Currency() != "USD" {
+		t.Fatalf("balance = %s %s, want 84.50 USD", balance, balance.Currency())
+	}
+	assertBalance(t, fake, 8450)
+}
+
+func TestRejections(t *testing.T) {
+	_, client := newTestWallet(t, DuplicateReplay, 1)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		userID int
+		amount model.Money
+	}{
+		{"insufficient funds", testUserID, model.NewMoney(10001, "USD")},
+		{"currency mismatch", testUserID, model.NewMoney(100, "EUR")},
+		{"unknown user", 1, model.NewMoney(100, "USD")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.ProcessWithdraw(ctx, tt.userID, tt.amount, 1, "bet-"+tt.name)
+			var walletErr *wallet.WalletError
+			if !errors.As(err, &walletErr) || walletErr.StatusCode != http.StatusBadRequest {
+				t.Fatalf("err = %v, want a 400 wallet error", err)
+			}
+		})
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	fake := NewServer(testAPIKey, DuplicateReplay, logger.New())
+	fake.SetBalance(testUserID, model.NewMoney(10000, "USD"))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/balance/34633089486", nil)
+	req.Header.Set("x-api-key", "wrong-key")
+	rec := httptest.NewRecorder()
+	fake.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	tests := []struct {
+		mode        DuplicateMode
+		wantBalance int64
+	}{
+		{DuplicateReplay, 9000},
+		{DuplicateApply, 8000},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			fake, client := newTestWallet(t, tt.mode, 1)
+			ctx := context.Background()
+
+			first, err := client.ProcessWithdraw(ctx, testUserID, model.NewMoney(1000, "USD"), 1, "bet-1")
+			if err != nil {
+				t.Fatalf("withdraw: %v", err)
+			}
+			second, err := client.ProcessWithdraw(ctx, testUserID, model.NewMoney(1000, "USD"), 1, "bet-1")
+			if err != nil {
+				t.Fatalf("duplicate withdraw: %v", err)
+			}
+			if tt.mode == DuplicateReplay && second.Transactions[0].ID != first.Transactions[0].ID {
+				t.Fatalf("replayed id = %d, want %d", second.Transactions[0].ID, first.Transactions[0].ID)
+			}
+			assertBalance(t, fake, tt.wantBalance)
+		})
+	}
+}
+
+func TestScriptedFaults(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("error is retried", func(t *testing.T) {
+		fake, client := newTestWallet(t, DuplicateReplay, 3)
+		fake.Script(Outcome{Status: http.StatusServiceUnavailable})
+
+		if _, err := client.ProcessWithdraw(ctx, testUserID, model.NewMoney(1000, "USD"), 1, "bet-1"); err != nil {
+			t.Fatalf("withdraw: %v", err)
+		}
+		assertBalance(t, fake, 9000)
+		if requests := fake.Requests(); len(requests) != 2 || requests[0].Status != http.StatusServiceUnavailable {
+			t.Fatalf("requests = %+v, want a 503 then a success", requests)
+		}
+	})
+
+	t.Run("lost response is applied once", func(t *testing.T) {
+		fake, client := newTestWallet(t, DuplicateReplay, 3)
+		fake.Script(Outcome{Status: http.StatusInternalServerError, Applied: true})
+
+		if _, err := client.ProcessWithdraw(ctx, testUserID, model.NewMoney(1000, "USD"), 1, "bet-1"); err != nil {
+			t.Fatalf("withdraw: %v", err)
+		}
+		assertBalance(t, fake, 9000)
+	})
+
+	t.Run("timeout is retried", func(t *testing.T) {
+		fake, client := newTestWallet(t, DuplicateReplay, 2)
+		fake.Script(Outcome{Hang: true})
+
+		if _, err := client.ProcessDeposit(ctx, testUserID, model.NewMoney(1000, "USD"), 1, "win-1"); err != nil {
+			t.Fatalf("deposit: %v", err)
+		}
+		assertBalance(t, fake, 11000)
+	})
+
+	t.Run("exhausted retries", func(t *testing.T) {
+		fake, client := newTestWallet(t, DuplicateReplay, 2)
+		fake.Script(Outcome{Status: http.StatusBadGateway}, Outcome{Status: http.StatusBadGateway})
+
+		_, err := client.ProcessWithdraw(ctx, testUserID, model.NewMoney(1000, "USD"), 1, "bet-1")
+		var walletErr *wallet.WalletError
+		if !errors.As(err, &walletErr) || walletErr.StatusCode != http.StatusBadGateway {
+			t.Fatalf("err = %v, want a 502 wallet error", err)
+		}
+		assertBalance(t, fake, 10000)
+	})
+}
+
+func TestRandomFaultsAreRepeatable(t *testing.T) {
+	outcomes := func() []Outcome {
+		fake := NewServer("", DuplicateReplay, logger.New())
+		fake.SetFaults(Faults{ErrorRate: 0.3, TimeoutRate: 0.1, LostResponseRate: 0.2, Seed: 42})
+		var drawn []Outcome
+		for i := 0; i < 50; i++ {
+			drawn = append(drawn, fake.nextOutcome())
+		}
+		return drawn
+	}
+	first, second := outcomes(), outcomes()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("outcome %d = %+v then %+v", i, first[i], second[i])
+		}
+	}
+}
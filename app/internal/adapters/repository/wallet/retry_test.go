@@ -0,0 +1,248 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+)
+
+// testWallet answers every request with the next status of its script, repeating the last one.
+type testWallet struct {
+	attempts atomic.Int32
+	statuses []int
+	// hang makes the given attempts (1 for the first) wait until the request is abandoned
+	hang map[int32]bool
+}
+
+func (w *testWallet) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	attempt := w.attempts.Add(1)
+	// the server only notices the client going away once the body is read
+	io.Copy(io.Discard, r.Body)
+	if w.hang[attempt] {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		return
+	}
+	status := w.statuses[min(int(attempt), len(w.statuses))-1]
+	rw.WriteHeader(status)
+	if status == http.StatusOK {
+		rw.Write([]byte(`{"balance": "10.00", "currency": "USD", "transactions": []}`))
+	}
+}
+
+func newRetryClient(t *testing.T, wallet *testWallet, policy RetryPolicy) *WalletClient {
+	t.Helper()
+	srv := httptest.NewServer(wallet)
+	t.Cleanup(srv.Close)
+	return NewWalletClient(srv.URL, logger.New(), "test-key", policy)
+}
+
+func fastPolicy(maxAttempts int) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:       maxAttempts,
+		InitialBackoff:    time.Millisecond,
+		MaxBackoff:        time.Millisecond,
+		Multiplier:        1,
+		AttemptTimeout:    time.Second,
+		RetryableStatuses: []int{500, 502, 503, 504},
+	}
+}
+
+func TestRetryOnlyWithReference(t *testing.T) {
+	ctx := context.Background()
+	amount := model.NewMoney(1000, "USD")
+	tests := []struct {
+		name string
+		call func(client *WalletClient) error
+		want int32
+	}{
+		{"withdraw with reference", func(c *WalletClient) error {
+			_, err := c.ProcessWithdraw(ctx, 1, amount, 1, "ref-1")
+			return err
+		}, 3},
+		{"withdraw without reference", func(c *WalletClient) error {
+			_, err := c.ProcessWithdraw(ctx, 1, amount, 1, "")
+			return err
+		}, 1},
+		{"deposit without reference", func(c *WalletClient) error {
+			_, err := c.ProcessDeposit(ctx, 1, amount, 1, "")
+			return err
+		}, 1},
+		{"deposit with reference", func(c *WalletClient) error {
+			_, err := c.ProcessDeposit(ctx, 1, amount, 1, "ref-1")
+			return err
+		}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wallet := &testWallet{statuses: []int{http.StatusServiceUnavailable}}
+			client := newRetryClient(t, wallet, fastPolicy(3))
+
+			var walletErr *WalletError
+			if err := tt.call(client); !errors.As(err, &walletErr) || walletErr.StatusCode != http.StatusServiceUnavailable {
+				t.Fatalf("err = %v, want a 503 wallet error", err)
+			}
+			if got := wallet.attempts.Load(); got != tt.want {
+				t.Fatalf("attempts = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryableStatuses(t *testing.T) {
+	tests := []struct {
+		statuses   []int
+		wantStatus int
+		want       int32
+	}{
+		{[]int{500}, 500, 3},
+		{[]int{502}, 502, 3},
+		{[]int{503, 503, 200}, 200, 3},
+		{[]int{504, 200}, 200, 2},
+		{[]int{200}, 200, 1},
+		{[]int{400}, 400, 1},
+		{[]int{409}, 409, 1},
+		{[]int{429}, 429, 1},
+		{[]int{503, 400}, 400, 2},
+	}
+	for _, tt := range tests {
+		wallet := &testWallet{statuses: tt.statuses}
+		client := newRetryClient(t, wallet, fastPolicy(3))
+
+		_, err := client.ProcessWithdraw(context.Background(), 1, model.NewMoney(1000, "USD"), 1, "ref-1")
+		status := http.StatusOK
+		var walletErr *WalletError
+		if errors.As(err, &walletErr) {
+			status = walletErr.StatusCode
+		} else if err != nil {
+			t.Fatalf("statuses %v: err = %v", tt.statuses, err)
+		}
+		if status != tt.wantStatus || wallet.attempts.Load() != tt.want {
+			t.Errorf("statuses %v: status %d after %d attempts, want %d after %d", tt.statuses, status, wallet.attempts.Load(), tt.wantStatus, tt.want)
+		}
+	}
+}
+
+func TestRejectedOnlyOnFirstSend(t *testing.T) {
+	tests := []struct {
+		statuses []int
+		rejected bool
+	}{
+		{[]int{400}, true},
+		{[]int{503, 400}, false},
+		{[]int{500}, false},
+	}
+	for _, tt := range tests {
+		wallet := &testWallet{statuses: tt.statuses}
+		client := newRetryClient(t, wallet, fastPolicy(3))
+
+		_, err := client.ProcessWithdraw(context.Background(), 1, model.NewMoney(1000, "USD"), 1, "ref-1")
+		var walletErr *WalletError
+		if !errors.As(err, &walletErr) {
+			t.Fatalf("statuses %v: err = %v, want a wallet error", tt.statuses, err)
+		}
+		if walletErr.Rejected() != tt.rejected {
+			t.Errorf("statuses %v: rejected = %v, want %v", tt.statuses, walletErr.Rejected(), tt.rejected)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, Multiplier: 2}
+	tests := []struct {
+		retry int
+		want  time.Duration
+	}{
+		{1, 10 * time.Millisecond},
+		{2, 20 * time.Millisecond},
+		{3, 40 * time.Millisecond},
+		{4, 50 * time.Millisecond},
+		{10, 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := policy.backoff(tt.retry); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.retry, got, tt.want)
+		}
+	}
+
+	// jitter takes up to its fraction off the capped backoff
+	policy.Jitter = 0.5
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		got := policy.backoff(10)
+		if got < 25*time.Millisecond || got > 50*time.Millisecond {
+			t.Fatalf("backoff(10) with jitter = %s, want between 25ms and 50ms", got)
+		}
+		seen[got] = true
+	}
+	if len(seen) < 2 {
+		t.Fatalf("backoff with jitter always returned %v", seen)
+	}
+}
+
+func TestAttemptTimeout(t *testing.T) {
+	wallet := &testWallet{statuses: []int{http.StatusOK}, hang: map[int32]bool{1: true}}
+	policy := fastPolicy(2)
+	policy.AttemptTimeout = 50 * time.Millisecond
+	client := newRetryClient(t, wallet, policy)
+
+	start := time.Now()
+	if _, err := client.ProcessWithdraw(context.Background(), 1, model.NewMoney(1000, "USD"), 1, "ref-1"); err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("withdraw took %s, the hanging attempt was not cut off", elapsed)
+	}
+	if got := wallet.attempts.Load(); got != 2 {
+		t.Fatalf("attempts = %d, want 2", got)
+	}
+}
+
+func TestRetryStopsWhenContextEnds(t *testing.T) {
+	t.Run("during backoff", func(t *testing.T) {
+		wallet := &testWallet{statuses: []int{http.StatusServiceUnavailable}}
+		policy := fastPolicy(10)
+		policy.InitialBackoff = time.Minute
+		policy.MaxBackoff = time.Minute
+		client := newRetryClient(t, wallet, policy)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := client.ProcessWithdraw(ctx, 1, model.NewMoney(1000, "USD"), 1, "ref-1")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("withdraw took %s, the backoff did not stop", elapsed)
+		}
+		if got := wallet.attempts.Load(); got != 1 {
+			t.Fatalf("attempts = %d, want 1", got)
+		}
+	})
+
+	t.Run("during an attempt", func(t *testing.T) {
+		wallet := &testWallet{statuses: []int{http.StatusOK}, hang: map[int32]bool{1: true, 2: true}}
+		client := newRetryClient(t, wallet, fastPolicy(10))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		_, err := client.ProcessWithdraw(ctx, 1, model.NewMoney(1000, "USD"), 1, "ref-1")
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want %v", err, context.Canceled)
+		}
+		if got := wallet.attempts.Load(); got != 1 {
+			t.Fatalf("attempts = %d, want 1", got)
+		}
+	})
+}
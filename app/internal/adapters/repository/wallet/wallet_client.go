@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"kentech-project/internal/core/domain/model"
 	"kentech-project/pkg/logger"
 	"net/http"
 	"time"
@@ -16,10 +17,11 @@ import (
 )
 
 type WalletClient struct {
-	baseURL    string
-	httpClient *http.Client
-	logger     *logger.Logger
-	apiKey     string
+	baseURL     string
+	httpClient  *http.Client
+	logger      *logger.Logger
+	apiKey      string
+	retryPolicy RetryPolicy
 }
 
 type DepositRequest struct {
@@ -29,9 +31,9 @@ type DepositRequest struct {
 }
 
 type DepositRequestTransaction struct {
-	Amount    float64 `json:"amount"`
-	BetID     int     `json:"betId"`
-	Reference string  `json:"reference"`
+	Amount    model.Money `json:"amount"`
+	BetID     int         `json:"betId"`
+	Reference string      `json:"reference"`
 }
 
 type OperationResponse struct {
@@ -44,78 +46,97 @@ type OperationResponseTransaction struct {
 	Reference string `json:"reference"`
 }
 
+type BalanceResponse struct {
+	Balance  json.Number `json:"balance"`
+	Currency string      `json:"currency"`
+}
+
 type WalletError struct {
 	Message    string `json:"message"`
 	StatusCode int    `json:"-"`
+	// Retried is set when the response answered a resend of the operation, so an earlier attempt
+	// may have been applied by the wallet before this one was refused.
+	Retried bool `json:"-"`
 }
 
-func NewWalletClient(baseURL string, log *logger.Logger, apiKey string) *WalletClient {
+func NewWalletClient(baseURL string, log *logger.Logger, apiKey string, retryPolicy RetryPolicy) *WalletClient {
+	if retryPolicy.MaxAttempts < 1 {
+		retryPolicy.MaxAttempts = 1
+	}
+	if retryPolicy.AttemptTimeout <= 0 {
+		retryPolicy.AttemptTimeout = 30 * time.Second
+	}
 	return &WalletClient{
-		baseURL:    baseURL,
-		httpClient: &http.Client{Timeout: 30 * time.Second},
-		logger:     log,
-		apiKey:     apiKey,
+		baseURL:     baseURL,
+		httpClient:  &http.Client{},
+		logger:      log,
+		apiKey:      apiKey,
+		retryPolicy: retryPolicy,
 	}
 }
 
-func (w *WalletClient) ProcessDeposit(ctx context.Context, userID int, amount float64, currency string, betID int, reference string) (OperationResponse, error) {
+func (w *WalletClient) ProcessDeposit(ctx context.Context, userID int, amount model.Money, betID int, reference string) (OperationResponse, error) {
 	ctx, span := otel.Tracer("").Start(ctx, "WalletClient.ProcessDeposit", trace.WithAttributes(
 		attribute.String("wallet.endpoint", "/api/v1/deposit"),
 		attribute.Int("wallet.user_id", userID),
-		attribute.Float64("wallet.amount", amount),
+		attribute.String("wallet.amount", amount.String()),
+		attribute.String("wallet.currency", amount.Currency()),
 	))
 	defer span.End()
-	return w.makeRequest(ctx, "/api/v1/deposit", userID, amount, currency, betID, reference)
+	return w.makeRequest(ctx, "/api/v1/deposit", userID, amount, betID, reference)
 }
 
-func (w *WalletClient) ProcessWithdraw(ctx context.Context, userID int, amount float64, currency string, betID int, reference string) (OperationResponse, error) {
+func (w *WalletClient) ProcessWithdraw(ctx context.Context, userID int, amount model.Money, betID int, reference string) (OperationResponse, error) {
 	ctx, span := otel.Tracer("").Start(ctx, "WalletClient.ProcessWithdraw", trace.WithAttributes(
 		attribute.String("wallet.endpoint", "/api/v1/withdraw"),
 		attribute.Int("wallet.user_id", userID),
-		attribute.Float64("wallet.amount", amount),
+		attribute.String("wallet.amount", amount.String()),
+		attribute.String("wallet.currency", amount.Currency()),
 	))
 	defer span.End()
-	return w.makeRequest(ctx, "/api/v1/withdraw", userID, amount, currency, betID, reference)
+	return w.makeRequest(ctx, "/api/v1/withdraw", userID, amount, betID, reference)
 }
 
-func (w *WalletClient) CancelTransaction(ctx context.Context, reference string) error {
-	ctx, span := otel.Tracer("").Start(ctx, "WalletClient.CancelTransaction", trace.WithAttributes(
-		attribute.String("wallet.endpoint", "/cancel/"+reference),
-		attribute.String("wallet.reference", reference),
+func (w *WalletClient) GetBalance(ctx context.Context, userID int) (model.Money, error) {
+	endpoint := fmt.Sprintf("/api/v1/balance/%d", userID)
+	ctx, span := otel.Tracer("").Start(ctx, "WalletClient.GetBalance", trace.WithAttributes(
+		attribute.String("wallet.endpoint", endpoint),
+		attribute.Int("wallet.user_id", userID),
 	))
 	defer span.End()
-	url := fmt.Sprintf("%s/cancel/%s", w.baseURL, reference)
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	// reading the balance has no side effect, it can always be retried
+	statusCode, bodyBytes, _, err := w.do(ctx, http.MethodGet, w.baseURL+endpoint, nil, true)
 	if err != nil {
-		return err
+		return model.Money{}, err
 	}
+	bodyString := string(bodyBytes)
 
-	req.Header.Set("X-API-KEY", w.apiKey)
-
-	resp, err := w.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			w.logger.Errorf("Failed to close response body", "error", err)
-		} else {
-			w.logger.Debug("Response body closed successfully")
+	if statusCode < 200 || statusCode > 299 {
+		w.logger.Errorf("Wallet service returned error: status=%d, body=%s", statusCode, bodyString)
+		return model.Money{}, &WalletError{
+			StatusCode: statusCode,
+			Message:    bodyString,
 		}
-	}(resp.Body)
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("wallet service returned status: %d", resp.StatusCode)
+	var response BalanceResponse
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		w.logger.Errorf("Failed to decode wallet balance response: %v, body=%s", err, bodyString)
+		return model.Money{}, err
 	}
 
-	return nil
+	balance, err := model.ParseMoney(response.Balance.String(), response.Currency)
+	if err != nil {
+		w.logger.Errorf("Failed to parse wallet balance %q %s: %v", response.Balance, response.Currency, err)
+		return model.Money{}, err
+	}
+	return balance, nil
 }
 
-func (w *WalletClient) makeRequest(ctx context.Context, endpoint string, userID int, amount float64, currency string, betID int, reference string) (OperationResponse, error) {
+func (w *WalletClient) makeRequest(ctx context.Context, endpoint string, userID int, amount model.Money, betID int, reference string) (OperationResponse, error) {
 	request := DepositRequest{
-		Currency: currency,
+		Currency: amount.Currency(),
 		UserID:   userID,
 		Transactions: []DepositRequestTransaction{
 			{
@@ -132,51 +153,136 @@ func (w *WalletClient) makeRequest(ctx context.Context, endpoint string, userID
 	}
 
 	url := fmt.Sprintf("%s%s", w.baseURL, endpoint)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	// every attempt resends the same reference, so retries are only safe when there is one
+	statusCode, bodyBytes, attempts, err := w.do(ctx, http.MethodPost, url, jsonData, reference != "")
 	if err != nil {
 		return OperationResponse{}, err
 	}
+	bodyString := string(bodyBytes)
+
+	if statusCode < 200 || statusCode > 299 {
+		w.logger.Errorf("Wallet service returned error: status=%d, attempts=%d, body=%s", statusCode, attempts, bodyString)
+		return OperationResponse{}, &WalletError{
+			StatusCode: statusCode,
+			Message:    bodyString,
+			Retried:    attempts > 1,
+		}
+	}
+
+	var response OperationResponse
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		w.logger.Errorf("Failed to decode wallet response: %v, body=%s", err, bodyString)
+		return OperationResponse{}, err
+	}
+
+	return response, nil
+}
 
-	req.Header.Set("Content-Type", "application/json")
+// do sends the request following the retry policy and returns the status and body of the last
+// attempt, and the number of attempts made. Retries are recorded as events on the current span and
+// as log fields.
+func (w *WalletClient) do(ctx context.Context, method, url string, body []byte, retryable bool) (int, []byte, int, error) {
+	span := trace.SpanFromContext(ctx)
+	maxAttempts := w.retryPolicy.MaxAttempts
+	if !retryable {
+		maxAttempts = 1
+	}
+
+	var statusCode, attempts int
+	var bodyBytes []byte
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if attempt > 1 {
+			delay := w.retryPolicy.backoff(attempt - 1)
+			reason := fmt.Sprintf("status %d", statusCode)
+			if err != nil {
+				reason = err.Error()
+			}
+			span.AddEvent("wallet.retry", trace.WithAttributes(
+				attribute.Int("wallet.attempt", attempt),
+				attribute.String("wallet.retry_reason", reason),
+				attribute.Int64("wallet.backoff_ms", delay.Milliseconds()),
+			))
+			w.logger.Warnw("Retrying wallet request",
+				"url", url,
+				"attempt", attempt,
+				"max_attempts", maxAttempts,
+				"reason", reason,
+				"backoff", delay.String(),
+			)
+			if sleepErr := sleep(ctx, delay); sleepErr != nil {
+				if err == nil {
+					err = sleepErr
+				}
+				break
+			}
+		}
+
+		attempts = attempt
+		statusCode, bodyBytes, err = w.attempt(ctx, method, url, body)
+		if err != nil {
+			w.logger.Errorf("Wallet service request failed: %v", err)
+			if isRetryableError(ctx, err) {
+				continue
+			}
+			return 0, nil, attempts, err
+		}
+		if !w.retryPolicy.isRetryableStatus(statusCode) {
+			break
+		}
+	}
+	span.SetAttributes(attribute.Int("wallet.status_code", statusCode))
+
+	if err != nil {
+		return 0, nil, attempts, err
+	}
+	return statusCode, bodyBytes, attempts, nil
+}
+
+func (w *WalletClient) attempt(ctx context.Context, method, url string, body []byte) (int, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, w.retryPolicy.AttemptTimeout)
+	defer cancel()
+
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 	req.Header.Set("X-API-KEY", w.apiKey)
 
 	resp, err := w.httpClient.Do(req)
 	if err != nil {
-		w.logger.Errorf("Wallet service request failed", "error", err)
-		return OperationResponse{}, err
+		return 0, nil, err
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			w.logger.Errorf("Failed to close response body", "error", err)
+			w.logger.Errorf("Failed to close response body: %v", err)
 		} else {
 			w.logger.Debug("Response body closed successfully")
 		}
 	}(resp.Body)
 
-	bodyBytes, _ := io.ReadAll(resp.Body)
-	bodyString := string(bodyBytes)
-
-	if resp.StatusCode != http.StatusOK {
-		w.logger.Errorf("Wallet service returned error",
-			"status", resp.StatusCode,
-			"body", bodyString,
-		)
-		return OperationResponse{}, &WalletError{
-			StatusCode: resp.StatusCode,
-			Message:    bodyString,
-		}
-	}
-
-	var response OperationResponse
-	if err := json.Unmarshal(bodyBytes, &response); err != nil {
-		w.logger.Errorf("Failed to decode wallet response", "error", err, "body", bodyString)
-		return OperationResponse{}, err
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
 	}
-
-	return response, nil
+	return resp.StatusCode, bodyBytes, nil
 }
 
 func (e *WalletError) Error() string {
 	return fmt.Sprintf("wallet error: %s", e.Message)
 }
+
+// Rejected reports whether the wallet certainly did not apply the operation: it refused it with a
+// 4xx on the first send. A 4xx answering a resend may refuse a reference an earlier attempt applied.
+func (e *WalletError) Rejected() bool {
+	return e.StatusCode >= 400 && e.StatusCode < 500 && !e.Retried
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type BetStatus string
+
+const (
+	BetStatusOpen     BetStatus = "OPEN"
+	BetStatusWon      BetStatus = "WON"
+	BetStatusLost     BetStatus = "LOST"
+	BetStatusCanceled BetStatus = "CANCELED"
+)
+
+// Bet links the withdraw placing a stake with the deposit settling it.
+// ProviderBetID is the provider transaction id of the placing withdraw, which providers
+// send back as provider_withdrawn_id when settling. WalletBetID is the numeric betId
+// the wallet expects on both operations.
+type Bet struct {
+	ID                    uuid.UUID  `json:"id"`
+	UserID                uuid.UUID  `json:"user_id"`
+	WalletBetID           int        `json:"wallet_bet_id"`
+	ProviderBetID         string     `json:"provider_bet_id"`
+	WithdrawTransactionID uuid.UUID  `json:"withdraw_transaction_id"`
+	DepositTransactionID  *uuid.UUID `json:"deposit_transaction_id,omitempty"`
+	Stake                 Money      `json:"stake"`
+	Payout                Money      `json:"payout"`
+	Currency              string     `json:"currency"`
+	Status                BetStatus  `json:"status"`
+	PlacedAt              time.Time  `json:"placed_at"`
+	SettledAt             *time.Time `json:"settled_at,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
@@ -3,13 +3,36 @@ package model
 import "errors"
 
 var (
-	ErrUserNotFound          = errors.New("user not found")
-	ErrInvalidCredentials    = errors.New("invalid credentials")
-	ErrUserAlreadyExists     = errors.New("user already exists")
-	ErrWalletUserIDExhausted = errors.New("no more wallet user IDs available")
-	ErrInsufficientBalance   = errors.New("insufficient balance")
-	ErrTransactionNotFound   = errors.New("transaction not found")
-	ErrInvalidAmount         = errors.New("invalid amount")
-	ErrTransactionNotPending = errors.New("transaction is not in pending status")
-	ErrUnauthorized          = errors.New("unauthorized")
+	ErrUserNotFound             = errors.New("user not found")
+	ErrInvalidCredentials       = errors.New("invalid credentials")
+	ErrUserAlreadyExists        = errors.New("user already exists")
+	ErrWalletUserIDExhausted    = errors.New("no more wallet user IDs available")
+	ErrWalletAccountExists      = errors.New("wallet account already registered")
+	ErrInvalidWalletAccount     = errors.New("invalid wallet account")
+	ErrInsufficientBalance      = errors.New("insufficient balance")
+	ErrTransactionNotFound      = errors.New("transaction not found")
+	ErrInvalidAmount            = errors.New("invalid amount")
+	ErrTransactionNotCancelable = errors.New("transaction cannot be canceled or rolled back")
+	ErrUnauthorized             = errors.New("unauthorized")
+	ErrMissingReference         = errors.New("provider transaction id is required")
+	ErrDuplicateTransaction     = errors.New("transaction with this provider transaction id already exists")
+	ErrIdempotencyConflict      = errors.New("provider transaction id already used with a different amount or currency")
+	ErrTransactionInProgress    = errors.New("transaction with this provider transaction id is still being processed")
+	ErrBetNotFound              = errors.New("bet not found")
+	ErrBetAlreadySettled        = errors.New("bet is already settled or canceled")
+	ErrWalletUnavailable        = errors.New("wallet service unavailable")
+	ErrTransactionCanceled      = errors.New("transaction with this provider transaction id was canceled")
+	ErrAmbiguousReference       = errors.New("provider transaction id was used by both a withdraw and a deposit, the type is required")
+	ErrInvalidTransactionType   = errors.New("transaction type must be withdraw or deposit")
+	ErrAmountPrecision          = errors.New("amount has more decimals than the currency allows")
+	ErrUnknownCurrency          = errors.New("unknown currency")
+	ErrCurrencyMismatch         = errors.New("currencies do not match")
+	ErrInvalidExchangeRate      = errors.New("invalid exchange rate")
+	ErrExchangeRateNotFound     = errors.New("no exchange rate between the currencies")
+	ErrReconciliationNotFound   = errors.New("reconciliation run not found")
+	ErrReconciliationInProgress = errors.New("a reconciliation run is already in progress")
+	ErrUnbalancedEntry          = errors.New("journal entry debits and credits do not balance")
+	ErrInvalidCursor            = errors.New("invalid cursor")
+	ErrInvalidFilter            = errors.New("invalid filter")
+	ErrConcurrentModification   = errors.New("record was modified concurrently")
 )
@@ -0,0 +1,91 @@
+package model
+
+import (
+	"database/sql/driver"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// rateDecimals is the precision rates are stored and applied with.
+const rateDecimals = 10
+
+// Rate is an exact exchange rate: one unit of the base currency is worth Rate units of the quote currency.
+type Rate struct {
+	r *big.Rat
+}
+
+// ParseRate parses a positive decimal rate such as "140.25".
+func ParseRate(rate string) (Rate, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(rate))
+	if !ok || r.Sign() <= 0 {
+		return Rate{}, ErrInvalidExchangeRate
+	}
+	return NewRate(r), nil
+}
+
+// NewRate rounds r to the precision rates are stored with.
+func NewRate(r *big.Rat) Rate {
+	rounded, _ := new(big.Rat).SetString(r.FloatString(rateDecimals))
+	return Rate{r: rounded}
+}
+
+// Rat returns a copy of the rate as a fraction.
+func (r Rate) Rat() *big.Rat {
+	if r.r == nil {
+		return new(big.Rat)
+	}
+	return new(big.Rat).Set(r.r)
+}
+
+// Inverse returns the rate converting the quote currency back into the base currency.
+func (r Rate) Inverse() Rate {
+	return NewRate(new(big.Rat).Inv(r.r))
+}
+
+func (r Rate) String() string {
+	s := r.Rat().FloatString(rateDecimals)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r Rate) Value() (driver.Value, error) {
+	return r.String(), nil
+}
+
+// ExchangeRate is the rate converting Base into Quote.
+type ExchangeRate struct {
+	Base      string    `json:"base"`
+	Quote     string    `json:"quote"`
+	Rate      Rate      `json:"rate"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Convert converts m into currency at rate, rounding to the nearest minor unit of currency
+// with halves rounded away from zero.
+func (m Money) Convert(rate Rate, currency string) (Money, error) {
+	toExponent, err := CurrencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	fromExponent := currencyExponents[m.currency]
+
+	value := new(big.Rat).SetInt64(m.minor)
+	value.Mul(value, rate.Rat())
+	value.Mul(value, new(big.Rat).SetInt(pow10(toExponent)))
+	value.Quo(value, new(big.Rat).SetInt(pow10(fromExponent)))
+
+	minor, ok := new(big.Int).SetString(value.FloatString(0), 10)
+	if !ok || !minor.IsInt64() {
+		return Money{}, ErrInvalidAmount
+	}
+	return Money{minor: minor.Int64(), currency: currency}, nil
+}
+
+func pow10(exponent int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+}
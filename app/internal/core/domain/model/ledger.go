@@ -0,0 +1,83 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LedgerAccountType string
+
+const (
+	// LedgerAccountPlayer holds the funds of a player in one currency
+	LedgerAccountPlayer LedgerAccountType = "player"
+	// LedgerAccountHouse is the counterpart of the bets: stakes are credited to it, wins debited from it
+	LedgerAccountHouse LedgerAccountType = "house"
+	// LedgerAccountAdjustment is the counterpart of balance changes made in the wallet outside of our
+	// transactions, e.g. funds present before the first transaction or a wallet reset
+	LedgerAccountAdjustment LedgerAccountType = "adjustment"
+)
+
+// LedgerAccount is an account of the ledger. Balances are credits minus debits, so a player account
+// grows with credits. Only player accounts keep a running balance: the house and adjustment accounts
+// are shared by every player, their balance is the sum of their journal lines.
+type LedgerAccount struct {
+	ID        uuid.UUID         `json:"id"`
+	UserID    *uuid.UUID        `json:"user_id,omitempty"` // nil for the house and adjustment accounts
+	Type      LedgerAccountType `json:"type"`
+	Currency  string            `json:"currency"`
+	Balance   Money             `json:"balance"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// JournalEntry is an append-only record of money moving between ledger accounts. The debits and
+// credits of its lines always balance.
+type JournalEntry struct {
+	ID uuid.UUID `json:"id"`
+	// TransactionID is the transaction the entry records, nil for adjustments
+	TransactionID *uuid.UUID     `json:"transaction_id,omitempty"`
+	Description   string         `json:"description"`
+	Lines         []*JournalLine `json:"lines"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+type JournalLine struct {
+	AccountID uuid.UUID `json:"account_id"`
+	Debit     Money     `json:"debit"`
+	Credit    Money     `json:"credit"`
+	// BalanceAfter is the balance of a player account once the line is posted, nil on the lines of
+	// system accounts
+	BalanceAfter *Money `json:"balance_after,omitempty"`
+}
+
+// Validate checks that the lines are in a single currency, not negative and that debits equal credits.
+func (e *JournalEntry) Validate() error {
+	if len(e.Lines) < 2 {
+		return ErrUnbalancedEntry
+	}
+	currency := e.Lines[0].Debit.Currency()
+	var debits, credits int64
+	for _, line := range e.Lines {
+		if line.Debit.Currency() != currency || line.Credit.Currency() != currency {
+			return ErrCurrencyMismatch
+		}
+		if line.Debit.IsNegative() || line.Credit.IsNegative() {
+			return ErrInvalidAmount
+		}
+		debits += line.Debit.MinorUnits()
+		credits += line.Credit.MinorUnits()
+	}
+	if debits != credits || debits == 0 {
+		return ErrUnbalancedEntry
+	}
+	return nil
+}
+
+// Transfer returns the two lines moving amount from the debited account to the credited account.
+func Transfer(debited, credited uuid.UUID, amount Money) []*JournalLine {
+	zero := NewMoney(0, amount.Currency())
+	return []*JournalLine{
+		{AccountID: debited, Debit: amount, Credit: zero},
+		{AccountID: credited, Debit: zero, Credit: amount},
+	}
+}
@@ -0,0 +1,219 @@
+package model
+
+import (
+	"database/sql/driver"
+	"strconv"
+	"strings"
+)
+
+// currencyExponents holds the ISO 4217 minor unit exponent of the supported currencies,
+// e.g. 2 for USD (cents) and 0 for JPY.
+var currencyExponents = map[string]int{
+	"AUD": 2,
+	"BHD": 3,
+	"BRL": 2,
+	"CAD": 2,
+	"CHF": 2,
+	"CLP": 0,
+	"CNY": 2,
+	"DKK": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"INR": 2,
+	"ISK": 0,
+	"JOD": 3,
+	"JPY": 0,
+	"KES": 2,
+	"KRW": 0,
+	"KWD": 3,
+	"MXN": 2,
+	"NGN": 2,
+	"NOK": 2,
+	"OMR": 3,
+	"PLN": 2,
+	"SEK": 2,
+	"TND": 3,
+	"TRY": 2,
+	"TZS": 2,
+	"UGX": 0,
+	"USD": 2,
+	"VND": 0,
+	"ZAR": 2,
+}
+
+// CurrencyExponent returns the number of decimals allowed by an ISO 4217 currency.
+func CurrencyExponent(currency string) (int, error) {
+	exponent, ok := currencyExponents[currency]
+	if !ok {
+		return 0, ErrUnknownCurrency
+	}
+	return exponent, nil
+}
+
+// Money is an amount in minor units of a currency, e.g. 1050 in USD is 10.50 USD. It is encoded
+// as an exact decimal, in JSON as a number literal and in SQL as a NUMERIC value.
+type Money struct {
+	minor    int64
+	currency string
+}
+
+func NewMoney(minor int64, currency string) Money {
+	return Money{minor: minor, currency: currency}
+}
+
+// ParseMoney parses a decimal amount such as "10.5" or "-3.25" in the given currency. Amounts with
+// more significant decimals than the currency allows are rejected, trailing zeros are accepted.
+func ParseMoney(amount string, currency string) (Money, error) {
+	exponent, err := CurrencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	digits := strings.TrimSpace(amount)
+	negative := strings.HasPrefix(digits, "-")
+	digits = strings.TrimPrefix(digits, "-")
+
+	integer, fraction, _ := strings.Cut(digits, ".")
+	if integer == "" || !isDigits(integer) || !isDigits(fraction) {
+		return Money{}, ErrInvalidAmount
+	}
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > exponent {
+		return Money{}, ErrAmountPrecision
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	minor, err := strconv.ParseInt(integer+fraction, 10, 64)
+	if err != nil {
+		return Money{}, ErrInvalidAmount
+	}
+	if negative {
+		minor = -minor
+	}
+	return Money{minor: minor, currency: currency}, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// MinorUnits returns the amount in minor units of its currency.
+func (m Money) MinorUnits() int64 {
+	return m.minor
+}
+
+func (m Money) Currency() string {
+	return m.currency
+}
+
+func (m Money) IsZero() bool {
+	return m.minor == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.minor < 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.minor > 0
+}
+
+// Cmp compares two amounts of the same currency, returning -1, 0 or +1.
+func (m Money) Cmp(other Money) (int, error) {
+	if m.currency != other.currency {
+		return 0, ErrCurrencyMismatch
+	}
+	switch {
+	case m.minor < other.minor:
+		return -1, nil
+	case m.minor > other.minor:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// Add returns the sum of two amounts of the same currency, or ErrInvalidAmount when it does not fit
+// in minor units.
+func (m Money) Add(other Money) (Money, error) {
+	if m.currency != other.currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	sum := m.minor + other.minor
+	if (other.minor > 0 && sum < m.minor) || (other.minor < 0 && sum > m.minor) {
+		return Money{}, ErrInvalidAmount
+	}
+	return Money{minor: sum, currency: m.currency}, nil
+}
+
+// Sub returns m minus other, both of the same currency, or ErrInvalidAmount when it does not fit
+// in minor units.
+func (m Money) Sub(other Money) (Money, error) {
+	if m.currency != other.currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	difference := m.minor - other.minor
+	if (other.minor < 0 && difference < m.minor) || (other.minor > 0 && difference > m.minor) {
+		return Money{}, ErrInvalidAmount
+	}
+	return Money{minor: difference, currency: m.currency}, nil
+}
+
+func (m Money) Neg() Money {
+	return Money{minor: -m.minor, currency: m.currency}
+}
+
+func (m Money) Abs() Money {
+	if m.minor < 0 {
+		return m.Neg()
+	}
+	return m
+}
+
+// String formats the amount with the exponent of its currency, e.g. "10.50". An amount of an unknown
+// currency has no decimal form, it is shown in minor units and flagged, e.g. "1050 XYZ (unknown currency)".
+func (m Money) String() string {
+	s, err := m.format()
+	if err != nil {
+		return strconv.FormatInt(m.minor, 10) + " " + m.currency + " (unknown currency)"
+	}
+	return s
+}
+
+// format formats the amount with the exponent of its currency, it fails with ErrUnknownCurrency
+// rather than guessing the exponent.
+func (m Money) format() (string, error) {
+	exponent, err := CurrencyExponent(m.currency)
+	if err != nil {
+		return "", err
+	}
+	digits := strconv.FormatInt(m.minor, 10)
+	sign := ""
+	if m.minor < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	if exponent == 0 {
+		return sign + digits, nil
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:], nil
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	s, err := m.format()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.format()
+}
@@ -0,0 +1,135 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     Money
+		wantErr  error
+	}{
+		{"10.5", "USD", NewMoney(1050, "USD"), nil},
+		{"10.50", "USD", NewMoney(1050, "USD"), nil},
+		{"10.500", "USD", NewMoney(1050, "USD"), nil},
+		{"0.01", "USD", NewMoney(1, "USD"), nil},
+		{" 7 ", "USD", NewMoney(700, "USD"), nil},
+		{"-3.25", "USD", NewMoney(-325, "USD"), nil},
+		{"-0.01", "USD", NewMoney(-1, "USD"), nil},
+		{"10.505", "USD", Money{}, ErrAmountPrecision},
+		{"0.001", "EUR", Money{}, ErrAmountPrecision},
+		{"1500", "JPY", NewMoney(1500, "JPY"), nil},
+		{"1500.0", "JPY", NewMoney(1500, "JPY"), nil},
+		{"1500.5", "JPY", Money{}, ErrAmountPrecision},
+		{"1.234", "KWD", NewMoney(1234, "KWD"), nil},
+		{"1.2", "KWD", NewMoney(1200, "KWD"), nil},
+		{"1.2345", "KWD", Money{}, ErrAmountPrecision},
+		{"10", "XYZ", Money{}, ErrUnknownCurrency},
+		{"10", "", Money{}, ErrUnknownCurrency},
+		{"", "USD", Money{}, ErrInvalidAmount},
+		{".5", "USD", Money{}, ErrInvalidAmount},
+		{"-", "USD", Money{}, ErrInvalidAmount},
+		{"--1", "USD", Money{}, ErrInvalidAmount},
+		{"+1", "USD", Money{}, ErrInvalidAmount},
+		{"1e3", "USD", Money{}, ErrInvalidAmount},
+		{"1,50", "USD", Money{}, ErrInvalidAmount},
+		{"92233720368547758.08", "USD", Money{}, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.amount, tt.currency)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("ParseMoney(%q, %q): err = %v, want %v", tt.amount, tt.currency, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q, %q) = %d %s, want %d %s", tt.amount, tt.currency, got.MinorUnits(), got.Currency(), tt.want.MinorUnits(), tt.want.Currency())
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{NewMoney(1050, "USD"), "10.50"},
+		{NewMoney(5, "USD"), "0.05"},
+		{NewMoney(0, "USD"), "0.00"},
+		{NewMoney(-325, "USD"), "-3.25"},
+		{NewMoney(-5, "USD"), "-0.05"},
+		{NewMoney(1500, "JPY"), "1500"},
+		{NewMoney(-1500, "JPY"), "-1500"},
+		{NewMoney(1234, "KWD"), "1.234"},
+		{NewMoney(7, "KWD"), "0.007"},
+		{NewMoney(1050, "XYZ"), "1050 XYZ (unknown currency)"},
+	}
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("String() of %d %s = %q, want %q", tt.money.MinorUnits(), tt.money.Currency(), got, tt.want)
+		}
+	}
+}
+
+func TestMoneyEncodingFailsForUnknownCurrency(t *testing.T) {
+	money := NewMoney(1050, "XYZ")
+	if _, err := money.MarshalJSON(); !errors.Is(err, ErrUnknownCurrency) {
+		t.Errorf("MarshalJSON: err = %v, want %v", err, ErrUnknownCurrency)
+	}
+	if _, err := money.Value(); !errors.Is(err, ErrUnknownCurrency) {
+		t.Errorf("Value: err = %v, want %v", err, ErrUnknownCurrency)
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      func(Money, Money) (Money, error)
+		a, b    Money
+		want    Money
+		wantErr error
+	}{
+		{"add", Money.Add, NewMoney(1050, "USD"), NewMoney(-50, "USD"), NewMoney(1000, "USD"), nil},
+		{"add currencies", Money.Add, NewMoney(1, "USD"), NewMoney(1, "EUR"), Money{}, ErrCurrencyMismatch},
+		{"add overflow", Money.Add, NewMoney(math.MaxInt64, "USD"), NewMoney(1, "USD"), Money{}, ErrInvalidAmount},
+		{"add underflow", Money.Add, NewMoney(math.MinInt64, "USD"), NewMoney(-1, "USD"), Money{}, ErrInvalidAmount},
+		{"add up to the limit", Money.Add, NewMoney(math.MaxInt64-1, "USD"), NewMoney(1, "USD"), NewMoney(math.MaxInt64, "USD"), nil},
+		{"sub", Money.Sub, NewMoney(1050, "USD"), NewMoney(2000, "USD"), NewMoney(-950, "USD"), nil},
+		{"sub currencies", Money.Sub, NewMoney(1, "USD"), NewMoney(1, "EUR"), Money{}, ErrCurrencyMismatch},
+		{"sub overflow", Money.Sub, NewMoney(math.MaxInt64, "USD"), NewMoney(-1, "USD"), Money{}, ErrInvalidAmount},
+		{"sub underflow", Money.Sub, NewMoney(math.MinInt64, "USD"), NewMoney(1, "USD"), Money{}, ErrInvalidAmount},
+		{"sub the minimum", Money.Sub, NewMoney(0, "USD"), NewMoney(math.MinInt64, "USD"), Money{}, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		got, err := tt.op(tt.a, tt.b)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %d %s, want %d %s", tt.name, got.MinorUnits(), got.Currency(), tt.want.MinorUnits(), tt.want.Currency())
+		}
+	}
+}
+
+func TestMoneyCmp(t *testing.T) {
+	tests := []struct {
+		a, b    Money
+		want    int
+		wantErr error
+	}{
+		{NewMoney(1, "USD"), NewMoney(2, "USD"), -1, nil},
+		{NewMoney(2, "USD"), NewMoney(2, "USD"), 0, nil},
+		{NewMoney(3, "USD"), NewMoney(2, "USD"), 1, nil},
+		{NewMoney(2, "USD"), NewMoney(2, "EUR"), 0, ErrCurrencyMismatch},
+	}
+	for _, tt := range tests {
+		got, err := tt.a.Cmp(tt.b)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("Cmp(%s %s, %s %s) = %d, %v, want %d, %v", tt.a, tt.a.Currency(), tt.b, tt.b.Currency(), got, err, tt.want, tt.wantErr)
+		}
+	}
+}
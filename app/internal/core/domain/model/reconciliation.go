@@ -0,0 +1,67 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ReconciliationStatus string
+
+const (
+	ReconciliationStatusRunning   ReconciliationStatus = "running"
+	ReconciliationStatusCompleted ReconciliationStatus = "completed"
+	ReconciliationStatusFailed    ReconciliationStatus = "failed"
+)
+
+type ReconciliationIssue string
+
+const (
+	// ReconciliationIssueWalletMismatch is a stored balance different from the wallet balance
+	ReconciliationIssueWalletMismatch ReconciliationIssue = "wallet_mismatch"
+	// ReconciliationIssueTransactionsMismatch is a stored balance different from the opening balance plus the completed transactions
+	ReconciliationIssueTransactionsMismatch ReconciliationIssue = "transactions_mismatch"
+	// ReconciliationIssueWalletError is a wallet balance that could not be read
+	ReconciliationIssueWalletError ReconciliationIssue = "wallet_error"
+)
+
+// ReconciliationRun is one comparison of every player balance with their transactions and the wallet.
+type ReconciliationRun struct {
+	ID            uuid.UUID            `json:"id"`
+	Status        ReconciliationStatus `json:"status"`
+	UsersChecked  int                  `json:"users_checked"`
+	Discrepancies int                  `json:"discrepancies"`
+	Error         string               `json:"error,omitempty"`
+	StartedAt     time.Time            `json:"started_at"`
+	FinishedAt    *time.Time           `json:"finished_at,omitempty"`
+}
+
+// ReconciliationItem is a player whose balances did not match during a run.
+type ReconciliationItem struct {
+	ID           uuid.UUID `json:"id"`
+	RunID        uuid.UUID `json:"run_id"`
+	UserID       uuid.UUID `json:"user_id"`
+	WalletUserID int       `json:"wallet_user_id"`
+	Currency     string    `json:"currency"`
+	// StoredBalance is users.balance, TransactionsBalance the net amount of the completed transactions
+	StoredBalance       Money                 `json:"stored_balance"`
+	TransactionsBalance Money                 `json:"transactions_balance"`
+	WalletBalance       *Money                `json:"wallet_balance,omitempty"`
+	WalletError         string                `json:"wallet_error,omitempty"`
+	Issues              []ReconciliationIssue `json:"issues"`
+	CreatedAt           time.Time             `json:"created_at"`
+}
+
+// PlayerBalances are the balances of a player known locally, compared with the wallet by a run.
+type PlayerBalances struct {
+	UserID              uuid.UUID
+	WalletUserID        int
+	Currency            string
+	StoredBalance       Money
+	TransactionsBalance Money
+}
+
+type ReconciliationReport struct {
+	Run   *ReconciliationRun    `json:"run"`
+	Items []*ReconciliationItem `json:"items"`
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,39 +12,79 @@ type TransactionType string
 const (
 	TransactionTypeDeposit  TransactionType = "deposit"
 	TransactionTypeWithdraw TransactionType = "withdraw"
+	// TransactionTypeRollback is the compensating transaction reversing a completed withdraw or deposit
+	TransactionTypeRollback TransactionType = "rollback"
 )
 
 type TransactionStatus string
 
 const (
-	TransactionStatusPending   TransactionStatus = "pending"
-	TransactionStatusCompleted TransactionStatus = "completed"
-	TransactionStatusCanceled  TransactionStatus = "canceled"
-	TransactionStatusFailed    TransactionStatus = "failed"
+	TransactionStatusPending    TransactionStatus = "pending"
+	TransactionStatusCompleted  TransactionStatus = "completed"
+	TransactionStatusCanceled   TransactionStatus = "canceled"
+	TransactionStatusFailed     TransactionStatus = "failed"
+	TransactionStatusRolledBack TransactionStatus = "rolled_back"
 )
 
 type Transaction struct {
 	ID        uuid.UUID         `json:"id"`
 	UserID    uuid.UUID         `json:"user_id"`
 	Type      TransactionType   `json:"type"`
-	Amount    float64           `json:"amount"`
+	Amount    Money             `json:"amount"`
+	Currency  string            `json:"currency"`
 	Status    TransactionStatus `json:"status"`
 	Reference string            `json:"reference,omitempty"`
-	CreatedAt time.Time         `json:"created_at"`
-	UpdatedAt time.Time         `json:"updated_at"`
+	// BalanceBefore and BalanceAfter are the player balance around the transaction, equal when no
+	// money moved. They are nil for transactions recorded before balances were stored.
+	BalanceBefore *Money `json:"balance_before,omitempty"`
+	BalanceAfter  *Money `json:"balance_after,omitempty"`
+	// GameAmount is the amount in the currency the game is played in, Amount is its conversion
+	// into the wallet currency at ExchangeRate. ExchangeRate is nil when no conversion was needed.
+	GameAmount   Money  `json:"game_amount"`
+	GameCurrency string `json:"game_currency"`
+	ExchangeRate *Rate  `json:"exchange_rate,omitempty"`
+	// OriginalTransactionID links a rollback transaction to the transaction it reverses
+	OriginalTransactionID *uuid.UUID `json:"original_transaction_id,omitempty"`
+	// WalletTransactionID is the ID the wallet gave to the operation, nil until it completed
+	WalletTransactionID *int `json:"wallet_transaction_id,omitempty"`
+	// FailureReason explains why a failed transaction did not happen
+	FailureReason string `json:"failure_reason,omitempty"`
+	// RecoveryAttempts counts how often the recovery worker re-drove a stuck pending transaction
+	RecoveryAttempts int `json:"-"`
+	// Version is incremented by every write, an update only applies to the version it was read at
+	Version   int       `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TransactionDetails is a transaction with the bet it placed or settled and the transactions linking
+// it to its rollback.
+type TransactionDetails struct {
+	*Transaction
+	Bet *Bet `json:"bet,omitempty"`
+	// OriginalTransaction is the transaction reversed by a rollback
+	OriginalTransaction *Transaction `json:"original_transaction,omitempty"`
+	// Rollback is the rollback reversing the transaction, if it was rolled back
+	Rollback *Transaction `json:"rollback,omitempty"`
 }
 
 type TransactionRequest struct {
-	Currency              string  `json:"currency"`
-	Amount                float64 `json:"amount"`
-	ProviderTransactionID string  `json:"provider_transaction_id"`
-	ProviderWithdrawnID   string  `json:"provider_withdrawn_id,omitempty"` // Only for deposit
+	Currency string `json:"currency"`
+	// Amount keeps the decimal as sent, it is parsed into Money with the precision of Currency
+	Amount                json.Number `json:"amount"`
+	ProviderTransactionID string      `json:"provider_transaction_id"`
+	ProviderWithdrawnID   string      `json:"provider_withdrawn_id,omitempty"` // Only for deposit
+}
+
+type CancelRequest struct {
+	ProviderTransactionID string          `json:"provider_transaction_id"`
+	Type                  TransactionType `json:"type,omitempty"` // withdraw or deposit, required when both used the provider transaction id
 }
 
 type TransactionResponse struct {
-	TransactionID         string  `json:"transaction_id"`
-	ProviderTransactionID string  `json:"provider_transaction_id"`
-	OldBalance            float64 `json:"old_balance"`
-	NewBalance            float64 `json:"new_balance"`
-	Status                string  `json:"status"` // WON/LOST for deposit, COMPLETED for withdraw
+	TransactionID         string `json:"transaction_id"`
+	ProviderTransactionID string `json:"provider_transaction_id"`
+	OldBalance            *Money `json:"old_balance,omitempty"`
+	NewBalance            *Money `json:"new_balance,omitempty"`
+	Status                string `json:"status"` // WON/LOST for deposit, COMPLETED for withdraw, ROLLED_BACK for rollback, CANCELED
 }
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TransactionHistoryRequest is a page of the transaction history as requested by a client. Amounts
+// are decimals in the currency of the player, empty fields do not filter.
+type TransactionHistoryRequest struct {
+	Types     []TransactionType
+	Statuses  []TransactionStatus
+	From      *time.Time
+	To        *time.Time
+	Reference string
+	MinAmount string
+	MaxAmount string
+	Cursor    string
+	Limit     int
+}
+
+// TransactionFilter selects the transactions of a user. From is inclusive and To exclusive.
+type TransactionFilter struct {
+	UserID    uuid.UUID
+	Types     []TransactionType
+	Statuses  []TransactionStatus
+	From      *time.Time
+	To        *time.Time
+	Reference string
+	MinAmount *Money
+	MaxAmount *Money
+}
+
+// TransactionCursor is the position of a transaction in the history, ordered by creation time and ID.
+type TransactionCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// String encodes the cursor as an opaque token.
+func (c TransactionCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()))
+}
+
+func ParseTransactionCursor(s string) (*TransactionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	cursor := &TransactionCursor{}
+	if cursor.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.ID, err = uuid.Parse(id); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+type TransactionPage struct {
+	Transactions []*Transaction `json:"transactions"`
+	// NextCursor fetches the next page, empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func (t TransactionType) Valid() bool {
+	switch t {
+	case TransactionTypeDeposit, TransactionTypeWithdraw, TransactionTypeRollback:
+		return true
+	}
+	return false
+}
+
+func (s TransactionStatus) Valid() bool {
+	switch s {
+	case TransactionStatusPending, TransactionStatusCompleted, TransactionStatusCanceled,
+		TransactionStatusFailed, TransactionStatusRolledBack:
+		return true
+	}
+	return false
+}
+
+// TransactionTotal sums the exported transactions of one type, status and currency. Totals are kept
+// apart by status, so failed or canceled transactions never add to the money that moved.
+type TransactionTotal struct {
+	Type     TransactionType   `json:"type"`
+	Status   TransactionStatus `json:"status"`
+	Currency string            `json:"currency"`
+	Count    int               `json:"count"`
+	Amount   Money             `json:"amount"`
+}
+
+// TransactionSummary closes a transaction export.
+type TransactionSummary struct {
+	Count  int                 `json:"count"`
+	Totals []*TransactionTotal `json:"totals"`
+}
+
+// Add counts t in the summary.
+func (s *TransactionSummary) Add(t *Transaction) error {
+	s.Count++
+	for _, total := range s.Totals {
+		if total.Type == t.Type && total.Status == t.Status && total.Currency == t.Amount.Currency() {
+			amount, err := total.Amount.Add(t.Amount)
+			if err != nil {
+				return err
+			}
+			total.Count++
+			total.Amount = amount
+			return nil
+		}
+	}
+	s.Totals = append(s.Totals, &TransactionTotal{Type: t.Type, Status: t.Status, Currency: t.Amount.Currency(), Count: 1, Amount: t.Amount})
+	return nil
+}
@@ -0,0 +1,38 @@
+package model
+
+import "testing"
+
+func TestTransactionSummaryKeepsStatusesApart(t *testing.T) {
+	transactions := []*Transaction{
+		{Type: TransactionTypeWithdraw, Status: TransactionStatusCompleted, Amount: NewMoney(1000, "USD")},
+		{Type: TransactionTypeWithdraw, Status: TransactionStatusCompleted, Amount: NewMoney(500, "USD")},
+		{Type: TransactionTypeWithdraw, Status: TransactionStatusFailed, Amount: NewMoney(2500, "USD")},
+		{Type: TransactionTypeDeposit, Status: TransactionStatusCompleted, Amount: NewMoney(700, "USD")},
+		{Type: TransactionTypeWithdraw, Status: TransactionStatusCompleted, Amount: NewMoney(300, "EUR")},
+	}
+
+	summary := &TransactionSummary{}
+	for _, transaction := range transactions {
+		if err := summary.Add(transaction); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+
+	want := []TransactionTotal{
+		{Type: TransactionTypeWithdraw, Status: TransactionStatusCompleted, Currency: "USD", Count: 2, Amount: NewMoney(1500, "USD")},
+		{Type: TransactionTypeWithdraw, Status: TransactionStatusFailed, Currency: "USD", Count: 1, Amount: NewMoney(2500, "USD")},
+		{Type: TransactionTypeDeposit, Status: TransactionStatusCompleted, Currency: "USD", Count: 1, Amount: NewMoney(700, "USD")},
+		{Type: TransactionTypeWithdraw, Status: TransactionStatusCompleted, Currency: "EUR", Count: 1, Amount: NewMoney(300, "EUR")},
+	}
+	if summary.Count != len(transactions) {
+		t.Errorf("count = %d, want %d", summary.Count, len(transactions))
+	}
+	if len(summary.Totals) != len(want) {
+		t.Fatalf("totals = %d, want %d", len(summary.Totals), len(want))
+	}
+	for i, total := range summary.Totals {
+		if *total != want[i] {
+			t.Errorf("total %d = %+v, want %+v", i, *total, want[i])
+		}
+	}
+}
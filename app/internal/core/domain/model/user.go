@@ -11,16 +11,45 @@ type User struct {
 	Username     string    `json:"username"`
 	Email        string    `json:"email"`
 	Password     string    `json:"-"` // Don't include in JSON responses
-	Balance      float64   `json:"balance"`
+	Balance      Money     `json:"balance"`
 	Currency     string    `json:"currency"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	// BalanceSyncedAt is when Balance was last read from the wallet, nil if it never was
+	BalanceSyncedAt *time.Time `json:"balance_synced_at,omitempty"`
+	// Version is incremented by every write, an update only applies to the version it was read at
+	Version   int       `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type BalanceSource string
+
+const (
+	// BalanceSourceWallet is a balance just read from the wallet
+	BalanceSourceWallet BalanceSource = "wallet"
+	// BalanceSourceCache is the stored balance, read from the wallet within the cache TTL
+	BalanceSourceCache BalanceSource = "cache"
+	// BalanceSourceLocal is the stored balance, without checking how old it is
+	BalanceSourceLocal BalanceSource = "local"
+	// BalanceSourceLedger is a past balance rebuilt from the ledger
+	BalanceSourceLedger BalanceSource = "ledger"
+)
+
+type BalanceResponse struct {
+	Balance  Money         `json:"balance"`
+	Currency string        `json:"currency"`
+	Source   BalanceSource `json:"source"`
+	SyncedAt *time.Time    `json:"synced_at,omitempty"`
+	// Stale is set when the wallet should have been asked but could not be reached
+	Stale bool `json:"stale"`
+	// At is the time a balance rebuilt from the ledger was reached
+	At *time.Time `json:"at,omitempty"`
 }
 
 type CreateUserRequest struct {
 	Username string `json:"username"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Currency string `json:"currency,omitempty"` // wallet currency, any available account when empty
 }
 
 type LoginRequest struct {
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// WalletAccount is an account of the external wallet that can be assigned to a player. The wallet
+// does not create accounts, so they are provisioned by admins and handed out on registration.
+type WalletAccount struct {
+	WalletUserID int        `json:"wallet_user_id"`
+	Currency     string     `json:"currency"`
+	AssignedAt   *time.Time `json:"assigned_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type ImportWalletAccountsRequest struct {
+	Accounts []WalletAccountRequest `json:"accounts"`
+}
+
+type WalletAccountRequest struct {
+	WalletUserID int    `json:"wallet_user_id"`
+	Currency     string `json:"currency"`
+}
+
+type ImportWalletAccountsResponse struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"` // accounts that were already registered
+}
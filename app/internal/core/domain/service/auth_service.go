@@ -7,37 +7,35 @@ import (
 	"kentech-project/internal/core/port"
 	"kentech-project/pkg/logger"
 	"kentech-project/pkg/security"
-	"sync"
 )
 
-var walletIDMutex sync.Mutex
-var walletIDIndex int
-
-// as the provided wallet does not support creating new users,
-// we will use existing user IDs for testing purposes
-var walletUserIDs = []int{
-	34633089486, // USD
-	34679664254, // EUR
-	34616761765, // KES
-	34673635133, // USD
-}
-
 type AuthService struct {
 	userRepo   port.UserRepository
 	jwtService *auth.JWTService
+	uow        port.UnitOfWork
 	logger     *logger.Logger
 }
 
-func NewAuthService(userRepo port.UserRepository, jwtService *auth.JWTService, log *logger.Logger) *AuthService {
+func NewAuthService(userRepo port.UserRepository, jwtService *auth.JWTService, uow port.UnitOfWork, log *logger.Logger) *AuthService {
 	return &AuthService{
 		userRepo:   userRepo,
 		jwtService: jwtService,
+		uow:        uow,
 		logger:     log,
 	}
 }
 
+// Register creates a player and assigns them an available wallet account, in the requested currency
+// when one is given. The wallet does not create accounts, they are provisioned by admins beforehand.
 func (s *AuthService) Register(ctx context.Context, req model.CreateUserRequest) (*model.User, error) {
-	s.logger.Debugf("Register called: username=%s, email=%s", req.Username, req.Email)
+	s.logger.Debugf("Register called: username=%s, email=%s, currency=%s", req.Username, req.Email, req.Currency)
+
+	if req.Currency != "" {
+		if _, err := model.CurrencyExponent(req.Currency); err != nil {
+			s.logger.Warnf("Register failed: unknown currency %s", req.Currency)
+			return nil, err
+		}
+	}
 
 	if _, err := s.userRepo.GetByUsername(ctx, req.Username); err == nil {
 		s.logger.Warnf("Register failed: username already exists: %s", req.Username)
@@ -55,19 +53,23 @@ func (s *AuthService) Register(ctx context.Context, req model.CreateUserRequest)
 		return nil, err
 	}
 
-	walletIDMutex.Lock()
-	assignedWalletID := walletUserIDs[walletIDIndex%len(walletUserIDs)]
-	walletIDIndex++
-	walletIDMutex.Unlock()
-
 	user := &model.User{
-		Username:     req.Username,
-		Email:        req.Email,
-		Password:     hashedPassword,
-		WalletUserID: assignedWalletID,
+		Username: req.Username,
+		Email:    req.Email,
+		Password: hashedPassword,
 	}
 
-	if err := s.userRepo.Create(ctx, user); err != nil {
+	// the account is only taken when the user is created, a failed registration releases it
+	err = s.uow.RunInTx(ctx, func(ctx context.Context, repos port.Repositories) error {
+		account, err := repos.WalletAccounts.AssignNext(ctx, req.Currency)
+		if err != nil {
+			return err
+		}
+		user.WalletUserID = account.WalletUserID
+		user.Currency = account.Currency
+		return repos.Users.Create(ctx, user)
+	})
+	if err != nil {
 		s.logger.Error("Register failed: user creation error: " + err.Error())
 		return nil, err
 	}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/internal/core/port"
+	"kentech-project/pkg/logger"
+	"math/big"
+	"strconv"
+)
+
+// ExchangeService converts bet amounts from the currency a game is played in into the currency of
+// the player's wallet.
+type ExchangeService struct {
+	rates  port.RateProvider
+	spread *big.Rat
+	logger *logger.Logger
+}
+
+// NewExchangeService builds the converter. The spread is the fraction taken on every conversion,
+// e.g. 0.01 for 1%. Without a rate provider only same currency transactions are accepted.
+func NewExchangeService(rates port.RateProvider, spread float64, log *logger.Logger) *ExchangeService {
+	s, ok := new(big.Rat).SetString(strconv.FormatFloat(spread, 'f', -1, 64))
+	if !ok || s.Sign() < 0 || s.Cmp(big.NewRat(1, 1)) >= 0 {
+		log.Warnf("Invalid FX spread %v, using no spread", spread)
+		s = new(big.Rat)
+	}
+	return &ExchangeService{
+		rates:  rates,
+		spread: s,
+		logger: log,
+	}
+}
+
+// Convert converts amount into currency for a transaction of the given type and returns the rate
+// applied, nil when no conversion was needed. The spread works against the player: a withdraw is
+// converted at a higher rate and a deposit at a lower one.
+func (s *ExchangeService) Convert(ctx context.Context, amount model.Money, currency string, txType model.TransactionType) (model.Money, *model.Rate, error) {
+	if amount.Currency() == currency {
+		return amount, nil, nil
+	}
+	if s.rates == nil {
+		s.logger.Warnf("FX conversion from %s to %s requested but no rate provider is configured", amount.Currency(), currency)
+		return model.Money{}, nil, model.ErrCurrencyMismatch
+	}
+
+	rate, err := s.rate(ctx, amount.Currency(), currency)
+	if err != nil {
+		return model.Money{}, nil, err
+	}
+
+	adjustment := big.NewRat(1, 1)
+	if txType == model.TransactionTypeWithdraw {
+		adjustment.Add(adjustment, s.spread)
+	} else {
+		adjustment.Sub(adjustment, s.spread)
+	}
+	applied := model.NewRate(new(big.Rat).Mul(rate.Rat(), adjustment))
+
+	converted, err := amount.Convert(applied, currency)
+	if err != nil {
+		return model.Money{}, nil, err
+	}
+	s.logger.Infof("Converted %s %s to %s %s at rate %s", amount, amount.Currency(), converted, currency, applied)
+	return converted, &applied, nil
+}
+
+// rate looks up the rate from base to quote, falling back to the inverse of the rate from quote to base.
+func (s *ExchangeService) rate(ctx context.Context, base, quote string) (model.Rate, error) {
+	exchangeRate, err := s.rates.GetRate(ctx, base, quote)
+	if err == nil {
+		return exchangeRate.Rate, nil
+	}
+	if !errors.Is(err, model.ErrExchangeRateNotFound) {
+		s.logger.Error("Failed to fetch exchange rate: " + err.Error())
+		return model.Rate{}, err
+	}
+
+	exchangeRate, err = s.rates.GetRate(ctx, quote, base)
+	if err != nil {
+		if errors.Is(err, model.ErrExchangeRateNotFound) {
+			s.logger.Warnf("No exchange rate between %s and %s", base, quote)
+		}
+		return model.Rate{}, err
+	}
+	return exchangeRate.Rate.Inverse(), nil
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/internal/core/port"
+)
+
+// postToLedger records a completed transaction in the ledger: a win credits the player from the house
+// and a stake debits the player to the house, rollbacks reverse their original transaction. When the
+// wallet balance is not the ledger balance plus the transaction, the wallet changed outside of our
+// transactions and the difference is first posted as an adjustment, so the ledger always ends on the
+// wallet balance.
+func postToLedger(ctx context.Context, ledger port.LedgerRepository, transaction *model.Transaction, original *model.Transaction, walletBalance model.Money) error {
+	// only the player account is locked, the system accounts are shared by every player and Post does
+	// not update their rows
+	player, err := ledger.Account(ctx, &transaction.UserID, model.LedgerAccountPlayer, transaction.Currency)
+	if err != nil {
+		return err
+	}
+
+	movement := balanceMovement(transaction, original)
+	expected, err := player.Balance.Add(movement)
+	if err != nil {
+		return err
+	}
+	drift, err := walletBalance.Sub(expected)
+	if err != nil {
+		return err
+	}
+
+	if !drift.IsZero() {
+		adjustment, err := ledger.Account(ctx, nil, model.LedgerAccountAdjustment, transaction.Currency)
+		if err != nil {
+			return err
+		}
+		entry := &model.JournalEntry{
+			Description: fmt.Sprintf("wallet balance adjustment before %s %s", transaction.Type, transaction.ID.String()),
+			Lines:       model.Transfer(adjustment.ID, player.ID, drift),
+		}
+		if drift.IsNegative() {
+			entry.Lines = model.Transfer(player.ID, adjustment.ID, drift.Abs())
+		}
+		if err := ledger.Post(ctx, entry); err != nil {
+			return err
+		}
+	}
+
+	if movement.IsZero() {
+		// a lost bet settles without moving money
+		return nil
+	}
+	house, err := ledger.Account(ctx, nil, model.LedgerAccountHouse, transaction.Currency)
+	if err != nil {
+		return err
+	}
+	entry := &model.JournalEntry{
+		TransactionID: &transaction.ID,
+		Description:   fmt.Sprintf("%s %s", transaction.Type, transaction.Reference),
+		Lines:         model.Transfer(house.ID, player.ID, movement),
+	}
+	if movement.IsNegative() {
+		entry.Lines = model.Transfer(player.ID, house.ID, movement.Abs())
+	}
+	return ledger.Post(ctx, entry)
+}
@@ -2,24 +2,64 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"kentech-project/internal/core/domain/model"
 	"kentech-project/pkg/logger"
+	"time"
 
 	"github.com/google/uuid"
 	"kentech-project/internal/core/port"
 )
 
+type BalanceMode string
+
+const (
+	// BalanceModeLive reads the balance from the wallet on every request.
+	BalanceModeLive BalanceMode = "live"
+	// BalanceModeCached reads the balance from the wallet once the stored one is older than the TTL.
+	BalanceModeCached BalanceMode = "cached"
+	// BalanceModeLocal never calls the wallet and serves the stored balance.
+	BalanceModeLocal BalanceMode = "local"
+)
+
+// BalancePolicy controls how fresh the balance served to players is. The wallet is authoritative,
+// the balance stored on the user is a copy updated by every wallet operation and balance read.
+type BalancePolicy struct {
+	Mode BalanceMode
+	// TTL is how long a balance read from the wallet is served from the database in cached mode.
+	TTL time.Duration
+	// FallbackLocal serves the stored balance, flagged as stale, when the wallet cannot be reached.
+	// Without it the read fails.
+	FallbackLocal bool
+}
+
+// exportPageSize is the number of transactions an export reads at once.
+const exportPageSize = 500
+
 type PlayerService struct {
-	userRepo port.UserRepository
-	txRepo   port.TransactionRepository
-	logger   *logger.Logger
+	userRepo      port.UserRepository
+	txRepo        port.TransactionRepository
+	ledgerRepo    port.LedgerRepository
+	walletService port.WalletService
+	policy        BalancePolicy
+	logger        *logger.Logger
 }
 
-func NewPlayerService(userRepo port.UserRepository, txRepo port.TransactionRepository, log *logger.Logger) *PlayerService {
+func NewPlayerService(userRepo port.UserRepository, txRepo port.TransactionRepository, ledgerRepo port.LedgerRepository, walletService port.WalletService, policy BalancePolicy, log *logger.Logger) *PlayerService {
+	switch policy.Mode {
+	case BalanceModeLive, BalanceModeCached, BalanceModeLocal:
+	default:
+		log.Warnf("Invalid balance mode %q, using %s", policy.Mode, BalanceModeCached)
+		policy.Mode = BalanceModeCached
+	}
 	return &PlayerService{
-		userRepo: userRepo,
-		txRepo:   txRepo,
-		logger:   log,
+		userRepo:      userRepo,
+		txRepo:        txRepo,
+		ledgerRepo:    ledgerRepo,
+		walletService: walletService,
+		policy:        policy,
+		logger:        log,
 	}
 }
 
@@ -31,30 +71,246 @@ func (s *PlayerService) GetProfile(ctx context.Context, userID uuid.UUID) (*mode
 		s.logger.Warnf("GetProfile failed for user_id=%s: %s", userID.String(), err.Error())
 		return nil, err
 	}
+	if _, _, err := s.refreshBalance(ctx, user); err != nil {
+		s.logger.Warnf("GetProfile failed for user_id=%s: %s", userID.String(), err.Error())
+		return nil, err
+	}
 	s.logger.Infof("GetProfile successful: user_id=%s", userID.String())
 	return user, nil
 }
 
-func (s *PlayerService) GetTransactionHistory(ctx context.Context, userID uuid.UUID) ([]*model.Transaction, error) {
-	s.logger.Debugf("GetTransactionHistory called: user_id=%s", userID.String())
+// GetTransactionHistory returns a page of the transactions of a user, newest first.
+func (s *PlayerService) GetTransactionHistory(ctx context.Context, userID uuid.UUID, req model.TransactionHistoryRequest) (*model.TransactionPage, error) {
+	s.logger.Debugf("GetTransactionHistory called: user_id=%s, limit=%d", userID.String(), req.Limit)
 
-	transactions, err := s.txRepo.GetByUserID(ctx, userID)
+	filter, after, err := s.historyQuery(ctx, userID, req)
 	if err != nil {
 		s.logger.Warnf("GetTransactionHistory failed for user_id=%s: %s", userID.String(), err.Error())
 		return nil, err
 	}
-	s.logger.Infof("GetTransactionHistory successful: user_id=%s, count=%d", userID.String(), len(transactions))
-	return transactions, nil
+	page, err := s.transactionPage(ctx, filter, after, req.Limit)
+	if err != nil {
+		s.logger.Warnf("GetTransactionHistory failed for user_id=%s: %s", userID.String(), err.Error())
+		return nil, err
+	}
+	s.logger.Infof("GetTransactionHistory successful: user_id=%s, count=%d", userID.String(), len(page.Transactions))
+	return page, nil
+}
+
+// ExportTransactions passes every transaction of a user matching the history filters of req to write,
+// newest first, and returns their totals. Transactions are read a page at a time, so an export never
+// holds the whole history; the limit of req is ignored.
+func (s *PlayerService) ExportTransactions(ctx context.Context, userID uuid.UUID, req model.TransactionHistoryRequest, write func(*model.Transaction) error) (*model.TransactionSummary, error) {
+	s.logger.Debugf("ExportTransactions called: user_id=%s", userID.String())
+
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		s.logger.Warnf("ExportTransactions failed for user_id=%s: %s", userID.String(), err.Error())
+		return nil, err
+	}
+	req.Limit = exportPageSize
+	filter, after, err := s.historyQuery(ctx, userID, req)
+	if err != nil {
+		s.logger.Warnf("ExportTransactions failed for user_id=%s: %s", userID.String(), err.Error())
+		return nil, err
+	}
+	summary := &model.TransactionSummary{Totals: make([]*model.TransactionTotal, 0)}
+	for {
+		page, err := s.transactionPage(ctx, filter, after, req.Limit)
+		if err != nil {
+			s.logger.Warnf("ExportTransactions failed for user_id=%s: %s", userID.String(), err.Error())
+			return nil, err
+		}
+		for _, transaction := range page.Transactions {
+			if err := summary.Add(transaction); err != nil {
+				return nil, err
+			}
+			if err := write(transaction); err != nil {
+				s.logger.Warnf("ExportTransactions failed for user_id=%s: %s", userID.String(), err.Error())
+				return nil, err
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		last := page.Transactions[len(page.Transactions)-1]
+		after = &model.TransactionCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+	s.logger.Infof("ExportTransactions successful: user_id=%s, count=%d", userID.String(), summary.Count)
+	return summary, nil
+}
+
+// historyQuery validates a history request into the filter and the position the page starts after.
+func (s *PlayerService) historyQuery(ctx context.Context, userID uuid.UUID, req model.TransactionHistoryRequest) (model.TransactionFilter, *model.TransactionCursor, error) {
+	filter, err := s.transactionFilter(ctx, userID, req)
+	if err != nil {
+		return filter, nil, err
+	}
+	if req.Cursor == "" {
+		return filter, nil, nil
+	}
+	after, err := model.ParseTransactionCursor(req.Cursor)
+	return filter, after, err
+}
+
+// transactionPage fetches up to limit transactions after the cursor.
+func (s *PlayerService) transactionPage(ctx context.Context, filter model.TransactionFilter, after *model.TransactionCursor, limit int) (*model.TransactionPage, error) {
+	// one more transaction than requested tells whether there is a next page
+	transactions, err := s.txRepo.List(ctx, filter, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &model.TransactionPage{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		last := page.Transactions[limit-1]
+		page.NextCursor = model.TransactionCursor{CreatedAt: last.CreatedAt, ID: last.ID}.String()
+	}
+	if page.Transactions == nil {
+		page.Transactions = make([]*model.Transaction, 0)
+	}
+	return page, nil
+}
+
+// transactionFilter validates a history request, amounts are parsed in the currency of the user.
+func (s *PlayerService) transactionFilter(ctx context.Context, userID uuid.UUID, req model.TransactionHistoryRequest) (model.TransactionFilter, error) {
+	filter := model.TransactionFilter{
+		UserID:    userID,
+		Types:     req.Types,
+		Statuses:  req.Statuses,
+		From:      req.From,
+		To:        req.To,
+		Reference: req.Reference,
+	}
+	if req.Limit < 1 {
+		return filter, model.ErrInvalidFilter
+	}
+	for _, txType := range req.Types {
+		if !txType.Valid() {
+			return filter, model.ErrInvalidFilter
+		}
+	}
+	for _, status := range req.Statuses {
+		if !status.Valid() {
+			return filter, model.ErrInvalidFilter
+		}
+	}
+	if req.From != nil && req.To != nil && !req.From.Before(*req.To) {
+		return filter, model.ErrInvalidFilter
+	}
+	if req.MinAmount == "" && req.MaxAmount == "" {
+		return filter, nil
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return filter, err
+	}
+	if req.MinAmount != "" {
+		amount, err := model.ParseMoney(req.MinAmount, user.Currency)
+		if err != nil {
+			return filter, err
+		}
+		filter.MinAmount = &amount
+	}
+	if req.MaxAmount != "" {
+		amount, err := model.ParseMoney(req.MaxAmount, user.Currency)
+		if err != nil {
+			return filter, err
+		}
+		filter.MaxAmount = &amount
+	}
+	return filter, nil
 }
 
-func (s *PlayerService) GetBalance(ctx context.Context, userID uuid.UUID) (float64, error) {
+func (s *PlayerService) GetBalance(ctx context.Context, userID uuid.UUID) (*model.BalanceResponse, error) {
 	s.logger.Debugf("GetBalance called: user_id=%s", userID.String())
 
 	user, err := s.userRepo.GetByID(ctx, userID)
 	if err != nil {
 		s.logger.Warnf("GetBalance failed for user_id=%s: %s", userID.String(), err.Error())
-		return 0, err
+		return nil, err
+	}
+	source, stale, err := s.refreshBalance(ctx, user)
+	if err != nil {
+		s.logger.Warnf("GetBalance failed for user_id=%s: %s", userID.String(), err.Error())
+		return nil, err
+	}
+	s.logger.Infof("GetBalance successful: user_id=%s, balance=%s, source=%s", userID.String(), user.Balance, source)
+	return &model.BalanceResponse{
+		Balance:  user.Balance,
+		Currency: user.Balance.Currency(),
+		Source:   source,
+		SyncedAt: user.BalanceSyncedAt,
+		Stale:    stale,
+	}, nil
+}
+
+// GetBalanceAt rebuilds the balance the player had at the given time from the ledger.
+func (s *PlayerService) GetBalanceAt(ctx context.Context, userID uuid.UUID, at time.Time) (*model.BalanceResponse, error) {
+	s.logger.Debugf("GetBalanceAt called: user_id=%s, at=%s", userID.String(), at.Format(time.RFC3339))
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		s.logger.Warnf("GetBalanceAt failed for user_id=%s: %s", userID.String(), err.Error())
+		return nil, err
+	}
+	balance, err := s.ledgerRepo.BalanceAt(ctx, userID, user.Currency, at)
+	if err != nil {
+		s.logger.Warnf("GetBalanceAt failed for user_id=%s: %s", userID.String(), err.Error())
+		return nil, err
+	}
+	s.logger.Infof("GetBalanceAt successful: user_id=%s, balance=%s", userID.String(), balance)
+	return &model.BalanceResponse{
+		Balance:  balance,
+		Currency: balance.Currency(),
+		Source:   model.BalanceSourceLedger,
+		At:       &at,
+	}, nil
+}
+
+// refreshBalance brings user.Balance up to date with the wallet as required by the balance policy,
+// and reports where the balance comes from and whether it is stale because the wallet is down.
+func (s *PlayerService) refreshBalance(ctx context.Context, user *model.User) (model.BalanceSource, bool, error) {
+	switch s.policy.Mode {
+	case BalanceModeLocal:
+		return model.BalanceSourceLocal, false, nil
+	case BalanceModeCached:
+		if user.BalanceSyncedAt != nil && time.Since(*user.BalanceSyncedAt) < s.policy.TTL {
+			return model.BalanceSourceCache, false, nil
+		}
+	}
+
+	syncedAt := time.Now()
+	balance, err := s.walletService.GetBalance(ctx, user.WalletUserID)
+	if err == nil && balance.Currency() != user.Currency {
+		s.logger.Errorf("Wallet balance currency %s does not match currency %s of user_id=%s", balance.Currency(), user.Currency, user.ID.String())
+		err = model.ErrCurrencyMismatch
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", false, err
+		}
+		if !s.policy.FallbackLocal {
+			if !errors.Is(err, model.ErrWalletUnavailable) {
+				err = fmt.Errorf("%w: %w", model.ErrWalletUnavailable, err)
+			}
+			return "", false, err
+		}
+		s.logger.Warnf("Wallet balance unavailable for user_id=%s, serving stored balance: %s", user.ID.String(), err.Error())
+		return model.BalanceSourceLocal, true, nil
+	}
+
+	// the wallet answer is served even if storing it fails, the next read will try again
+	if err := s.userRepo.UpdateBalance(ctx, user.ID, balance, syncedAt); err != nil {
+		s.logger.Error("Failed to store wallet balance: " + err.Error())
+	}
+	if user.BalanceSyncedAt == nil {
+		// the first wallet read is the balance the player came with
+		if err := s.userRepo.SetOpeningBalance(ctx, user.ID, balance); err != nil {
+			s.logger.Error("Failed to store opening balance: " + err.Error())
+		}
 	}
-	s.logger.Infof("GetBalance successful: user_id=%s, balance=%f", userID.String(), user.Balance)
-	return user.Balance, nil
+	user.Balance = balance
+	user.BalanceSyncedAt = &syncedAt
+	return model.BalanceSourceWallet, false, nil
 }
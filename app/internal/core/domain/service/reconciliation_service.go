@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/internal/core/port"
+	"kentech-project/pkg/logger"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReconciliationConfig of a ReconciliationService.
+type ReconciliationConfig struct {
+	// Interval between two scheduled runs.
+	Interval time.Duration
+	// BatchSize is the number of players loaded at once.
+	BatchSize int
+	// Timeout bounds a run. A run still marked running for longer was left behind by a stopped
+	// process and is abandoned when the next run begins.
+	Timeout time.Duration
+}
+
+// ReconciliationService compares the balance stored for every player with the net amount of their
+// completed transactions and with the live wallet balance, and records the players that differ.
+type ReconciliationService struct {
+	reconRepo     port.ReconciliationRepository
+	walletService port.WalletService
+	cfg           ReconciliationConfig
+	logger        *logger.Logger
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+func NewReconciliationService(reconRepo port.ReconciliationRepository, walletService port.WalletService, cfg ReconciliationConfig, log *logger.Logger) *ReconciliationService {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 24 * time.Hour
+	}
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 1
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Hour
+	}
+	return &ReconciliationService{
+		reconRepo:     reconRepo,
+		walletService: walletService,
+		cfg:           cfg,
+		logger:        log,
+	}
+}
+
+// Run reconciles every player and returns the finished run.
+func (s *ReconciliationService) Run(ctx context.Context) (*model.ReconciliationRun, error) {
+	run, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return run, s.execute(ctx, run)
+}
+
+// Trigger starts a run in the background and returns it while it is running.
+func (s *ReconciliationService) Trigger(ctx context.Context) (*model.ReconciliationRun, error) {
+	run, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	started := *run
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		_ = s.execute(context.WithoutCancel(ctx), run)
+	}()
+	return &started, nil
+}
+
+// Report returns a run with its discrepancies.
+func (s *ReconciliationService) Report(ctx context.Context, runID uuid.UUID) (*model.ReconciliationReport, error) {
+	s.logger.Debugf("Reconciliation report called: run_id=%s", runID.String())
+
+	run, err := s.reconRepo.GetRun(ctx, runID)
+	if err != nil {
+		s.logger.Warnf("Reconciliation report failed for run_id=%s: %s", runID.String(), err.Error())
+		return nil, err
+	}
+	items, err := s.reconRepo.ListItems(ctx, runID)
+	if err != nil {
+		s.logger.Warnf("Reconciliation report failed for run_id=%s: %s", runID.String(), err.Error())
+		return nil, err
+	}
+	if items == nil {
+		items = make([]*model.ReconciliationItem, 0)
+	}
+	return &model.ReconciliationReport{Run: run, Items: items}, nil
+}
+
+func (s *ReconciliationService) ListRuns(ctx context.Context, limit int) ([]*model.ReconciliationRun, error) {
+	s.logger.Debugf("List reconciliation runs called: limit=%d", limit)
+
+	runs, err := s.reconRepo.ListRuns(ctx, limit)
+	if err != nil {
+		s.logger.Warnf("List reconciliation runs failed: %s", err.Error())
+		return nil, err
+	}
+	return runs, nil
+}
+
+// Start runs a reconciliation every interval in the background until Stop is called or ctx is done.
+func (s *ReconciliationService) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		s.logger.Infof("Reconciliation job started: interval=%s", s.cfg.Interval)
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				s.logger.Info("Reconciliation job stopped")
+				return
+			case <-ticker.C:
+				if _, err := s.Run(ctx); errors.Is(err, model.ErrReconciliationInProgress) {
+					s.logger.Info("Scheduled reconciliation skipped, a run is already in progress")
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the scheduled job and waits for the runs in progress to finish, or for ctx to expire.
+func (s *ReconciliationService) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// begin records a new run, once the runs left behind by stopped processes are abandoned.
+func (s *ReconciliationService) begin(ctx context.Context) (*model.ReconciliationRun, error) {
+	if _, err := s.reconRepo.AbandonRuns(ctx, time.Now().Add(-s.cfg.Timeout)); err != nil {
+		s.logger.Error("Reconciliation failed: " + err.Error())
+		return nil, err
+	}
+	run := &model.ReconciliationRun{}
+	if err := s.reconRepo.CreateRun(ctx, run); err != nil {
+		return nil, err
+	}
+	s.logger.Infof("Reconciliation started: run_id=%s", run.ID.String())
+	return run, nil
+}
+
+// execute reconciles every player in batches and records the outcome of the run.
+func (s *ReconciliationService) execute(ctx context.Context, run *model.ReconciliationRun) error {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+
+	err := s.reconcile(ctx, run)
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Status = model.ReconciliationStatusCompleted
+	if err != nil {
+		run.Status = model.ReconciliationStatusFailed
+		run.Error = err.Error()
+		s.logger.Error("Reconciliation failed: " + err.Error())
+	}
+
+	// the outcome is recorded even when the run was interrupted
+	if updateErr := s.reconRepo.UpdateRun(context.WithoutCancel(ctx), run); updateErr != nil {
+		s.logger.Error("Failed to record reconciliation run: " + updateErr.Error())
+		if err == nil {
+			err = updateErr
+		}
+	}
+	if err == nil {
+		s.logger.Infof("Reconciliation completed: run_id=%s, users_checked=%d, discrepancies=%d", run.ID.String(), run.UsersChecked, run.Discrepancies)
+	}
+	return err
+}
+
+func (s *ReconciliationService) reconcile(ctx context.Context, run *model.ReconciliationRun) error {
+	after := uuid.Nil
+	for {
+		balances, err := s.reconRepo.ListPlayerBalances(ctx, after, s.cfg.BatchSize)
+		if err != nil {
+			return err
+		}
+		for _, balance := range balances {
+			item, err := s.check(ctx, balance)
+			if err != nil {
+				return err
+			}
+			run.UsersChecked++
+			if item == nil {
+				continue
+			}
+			item.RunID = run.ID
+			if err := s.reconRepo.AddItem(ctx, item); err != nil {
+				return err
+			}
+			run.Discrepancies++
+		}
+		if len(balances) < s.cfg.BatchSize {
+			return nil
+		}
+		after = balances[len(balances)-1].UserID
+	}
+}
+
+// check compares the balances of a player, returning the discrepancy found or nil when they match.
+// An unavailable wallet fails the whole run, there is nothing to compare against.
+func (s *ReconciliationService) check(ctx context.Context, balance *model.PlayerBalances) (*model.ReconciliationItem, error) {
+	item := &model.ReconciliationItem{
+		UserID:              balance.UserID,
+		WalletUserID:        balance.WalletUserID,
+		Currency:            balance.Currency,
+		StoredBalance:       balance.StoredBalance,
+		TransactionsBalance: balance.TransactionsBalance,
+	}
+
+	if cmp, err := balance.StoredBalance.Cmp(balance.TransactionsBalance); err != nil || cmp != 0 {
+		item.Issues = append(item.Issues, model.ReconciliationIssueTransactionsMismatch)
+	}
+
+	walletBalance, err := s.walletService.GetBalance(ctx, balance.WalletUserID)
+	switch {
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case errors.Is(err, model.ErrWalletUnavailable):
+		return nil, err
+	case err != nil:
+		s.logger.Warnf("Reconciliation could not read wallet balance of user_id=%s: %s", balance.UserID.String(), err.Error())
+		item.WalletError = err.Error()
+		item.Issues = append(item.Issues, model.ReconciliationIssueWalletError)
+	default:
+		item.WalletBalance = &walletBalance
+		if cmp, err := balance.StoredBalance.Cmp(walletBalance); err != nil || cmp != 0 {
+			item.Issues = append(item.Issues, model.ReconciliationIssueWalletMismatch)
+		}
+	}
+
+	if len(item.Issues) == 0 {
+		return nil, nil
+	}
+	s.logger.Warnf("Reconciliation discrepancy for user_id=%s: %v", balance.UserID.String(), item.Issues)
+	return item, nil
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"kentech-project/internal/adapters/repository/memory"
+	"kentech-project/internal/adapters/repository/wallet"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// stubWallet answers balance reads from a map and does not support operations.
+type stubWallet struct {
+	mu       sync.Mutex
+	balances map[int]model.Money
+}
+
+func (w *stubWallet) setBalance(userID int, balance model.Money) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.balances[userID] = balance
+}
+
+func (w *stubWallet) GetBalance(ctx context.Context, userID int) (model.Money, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.balances[userID], nil
+}
+
+func (w *stubWallet) ProcessDeposit(ctx context.Context, userID int, amount model.Money, betID int, reference string) (wallet.OperationResponse, error) {
+	panic("not supported")
+}
+
+func (w *stubWallet) ProcessWithdraw(ctx context.Context, userID int, amount model.Money, betID int, reference string) (wallet.OperationResponse, error) {
+	panic("not supported")
+}
+
+func usd(t *testing.T, amount string) model.Money {
+	t.Helper()
+	money, err := model.ParseMoney(amount, "USD")
+	if err != nil {
+		t.Fatalf("parse %s: %v", amount, err)
+	}
+	return money
+}
+
+type reconciliationFixture struct {
+	store   *memory.Store
+	wallet  *stubWallet
+	players *PlayerService
+	recon   *ReconciliationService
+}
+
+func newReconciliationFixture() *reconciliationFixture {
+	log := logger.New()
+	store := memory.NewStore(log)
+	stub := &stubWallet{balances: make(map[int]model.Money)}
+	return &reconciliationFixture{
+		store:   store,
+		wallet:  stub,
+		players: NewPlayerService(store.Users, store.Transactions, store.Ledger, stub, BalancePolicy{Mode: BalanceModeLive}, log),
+		recon:   NewReconciliationService(store.Reconciliations, stub, ReconciliationConfig{BatchSize: 10}, log),
+	}
+}
+
+// fundedPlayer registers a player who comes with balance on the wallet, and reads it once.
+func (f *reconciliationFixture) fundedPlayer(t *testing.T, walletUserID int, balance string) *model.User {
+	t.Helper()
+	ctx := context.Background()
+	user := &model.User{WalletUserID: walletUserID, Username: "player" + balance, Email: balance + "@example.com", Password: "x", Currency: "USD"}
+	if err := f.store.Users.Create(ctx, user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	f.wallet.setBalance(walletUserID, usd(t, balance))
+	f.sync(t, user)
+	return user
+}
+
+func (f *reconciliationFixture) sync(t *testing.T, user *model.User) {
+	t.Helper()
+	if _, err := f.players.GetBalance(context.Background(), user.ID); err != nil {
+		t.Fatalf("get balance: %v", err)
+	}
+}
+
+// withdraw records a completed withdraw of amount and the balance the wallet left.
+func (f *reconciliationFixture) withdraw(t *testing.T, user *model.User, amount, balanceAfter string) {
+	t.Helper()
+	ctx := context.Background()
+	balance := usd(t, balanceAfter)
+	transaction := &model.Transaction{
+		UserID:       user.ID,
+		Type:         model.TransactionTypeWithdraw,
+		Amount:       usd(t, amount),
+		Currency:     "USD",
+		Status:       model.TransactionStatusCompleted,
+		Reference:    "withdraw-" + amount,
+		BalanceAfter: &balance,
+		GameAmount:   usd(t, amount),
+		GameCurrency: "USD",
+	}
+	if err := f.store.Transactions.Create(ctx, transaction); err != nil {
+		t.Fatalf("create transaction: %v", err)
+	}
+	f.wallet.setBalance(user.WalletUserID, balance)
+	f.sync(t, user)
+}
+
+func (f *reconciliationFixture) issues(t *testing.T) map[int][]model.ReconciliationIssue {
+	t.Helper()
+	ctx := context.Background()
+	run, err := f.recon.Run(ctx)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	report, err := f.recon.Report(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	issues := make(map[int][]model.ReconciliationIssue)
+	for _, item := range report.Items {
+		issues[item.WalletUserID] = item.Issues
+	}
+	return issues
+}
+
+func TestReconciliationFundedPlayerAgrees(t *testing.T) {
+	f := newReconciliationFixture()
+	user := f.fundedPlayer(t, 1, "100.00")
+	f.withdraw(t, user, "30.00", "70.00")
+
+	if issues := f.issues(t); len(issues) != 0 {
+		t.Fatalf("issues = %v, want none", issues)
+	}
+}
+
+func TestReconciliationReportsDrift(t *testing.T) {
+	f := newReconciliationFixture()
+	agreeing := f.fundedPlayer(t, 1, "100.00")
+	f.withdraw(t, agreeing, "30.00", "70.00")
+
+	// the wallet balance moved outside of our transactions and was synced since
+	synced := f.fundedPlayer(t, 2, "50.00")
+	f.withdraw(t, synced, "10.00", "40.00")
+	f.wallet.setBalance(synced.WalletUserID, usd(t, "45.00"))
+	f.sync(t, synced)
+
+	// the wallet balance moved outside of our transactions and was not synced yet
+	unsynced := f.fundedPlayer(t, 3, "20.00")
+	f.wallet.setBalance(unsynced.WalletUserID, usd(t, "25.00"))
+
+	issues := f.issues(t)
+	want := map[int][]model.ReconciliationIssue{
+		2: {model.ReconciliationIssueTransactionsMismatch},
+		3: {model.ReconciliationIssueWalletMismatch},
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("issues = %v, want %v", issues, want)
+	}
+	for walletUserID, wantIssues := range want {
+		if !slices.Equal(issues[walletUserID], wantIssues) {
+			t.Errorf("issues of wallet user %d = %v, want %v", walletUserID, issues[walletUserID], wantIssues)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/internal/core/port"
+	"kentech-project/pkg/logger"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RecoveryConfig of a RecoveryWorker.
+type RecoveryConfig struct {
+	// Interval between two scans.
+	Interval time.Duration
+	// StaleAfter is how long a transaction must have been pending before it is recovered, so
+	// requests still in flight are left alone.
+	StaleAfter time.Duration
+	// BatchSize is the maximum number of transactions recovered per scan.
+	BatchSize int
+	// MaxAttempts is how many times a transaction is re-driven before the worker gives up on it
+	// and leaves it pending for manual review.
+	MaxAttempts int
+}
+
+// RecoveryMetrics counts what the recovery worker did since it started.
+type RecoveryMetrics struct {
+	Scans     int64 `json:"scans"`
+	Recovered int64 `json:"recovered"`
+	Errors    int64 `json:"errors"`
+	GaveUp    int64 `json:"gave_up"`
+}
+
+// RecoveryWorker finalises transactions stuck in pending. A transaction row is written as pending
+// before the wallet is called, so it acts as the outbox entry of the wallet operation: if the
+// process dies before the outcome is recorded, the worker finds the row and re-drives the call.
+type RecoveryWorker struct {
+	txService *TransactionService
+	txRepo    port.TransactionRepository
+	cfg       RecoveryConfig
+	logger    *logger.Logger
+
+	scans     atomic.Int64
+	recovered atomic.Int64
+	errors    atomic.Int64
+	gaveUp    atomic.Int64
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewRecoveryWorker(txService *TransactionService, txRepo port.TransactionRepository, cfg RecoveryConfig, log *logger.Logger) *RecoveryWorker {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 1
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	return &RecoveryWorker{
+		txService: txService,
+		txRepo:    txRepo,
+		cfg:       cfg,
+		logger:    log,
+	}
+}
+
+// Start runs the worker in the background until Stop is called or ctx is done.
+func (w *RecoveryWorker) Start(ctx context.Context) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	w.cancel = cancel
+	w.done = make(chan struct{})
+
+	go func() {
+		defer close(w.done)
+		w.logger.Infof("Recovery worker started: interval=%s, stale_after=%s", w.cfg.Interval, w.cfg.StaleAfter)
+		ticker := time.NewTicker(w.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			w.RunOnce(ctx)
+			select {
+			case <-ctx.Done():
+				w.logger.Info("Recovery worker stopped")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the worker and waits for the scan in progress to finish, or for ctx to expire.
+func (w *RecoveryWorker) Stop(ctx context.Context) error {
+	w.mu.Lock()
+	cancel, done := w.cancel, w.done
+	w.cancel = nil
+	w.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RunOnce recovers one batch of stale pending transactions.
+func (w *RecoveryWorker) RunOnce(ctx context.Context) {
+	w.scans.Add(1)
+	before := time.Now().Add(-w.cfg.StaleAfter)
+	transactions, err := w.txRepo.ListStalePending(ctx, before, w.cfg.MaxAttempts, w.cfg.BatchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			w.errors.Add(1)
+			w.logger.Error("Recovery scan failed: " + err.Error())
+		}
+		return
+	}
+
+	for _, transaction := range transactions {
+		if ctx.Err() != nil {
+			return
+		}
+		w.recover(ctx, transaction)
+	}
+}
+
+func (w *RecoveryWorker) recover(ctx context.Context, transaction *model.Transaction) {
+	w.logger.Infof("Recovering pending transaction_id=%s, attempt=%d", transaction.ID.String(), transaction.RecoveryAttempts+1)
+	err := w.txService.RecoverTransaction(ctx, transaction)
+	if err == nil {
+		w.recovered.Add(1)
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	w.errors.Add(1)
+	if err := w.countAttempt(ctx, transaction); err != nil {
+		w.logger.Error("Failed to record recovery attempt: " + err.Error())
+		return
+	}
+	if transaction.Status == model.TransactionStatusPending && transaction.RecoveryAttempts >= w.cfg.MaxAttempts {
+		w.gaveUp.Add(1)
+		w.logger.Errorf("Recovery gave up on transaction_id=%s after %d attempts, manual review required", transaction.ID.String(), transaction.RecoveryAttempts)
+	}
+}
+
+// countAttempt records a failed recovery attempt. The transaction is read again when it was modified
+// concurrently, the attempt is not counted once it is no longer pending.
+func (w *RecoveryWorker) countAttempt(ctx context.Context, transaction *model.Transaction) error {
+	for retry := 0; ; retry++ {
+		transaction.RecoveryAttempts++
+		err := w.txRepo.Update(ctx, transaction)
+		if !errors.Is(err, model.ErrConcurrentModification) || retry == maxConflictRetries {
+			return err
+		}
+
+		current, err := w.txRepo.GetByID(ctx, transaction.ID)
+		if err != nil {
+			return err
+		}
+		*transaction = *current
+		if transaction.Status != model.TransactionStatusPending {
+			w.logger.Infof("Recovery attempt not recorded, transaction_id=%s is already %s", transaction.ID.String(), transaction.Status)
+			return nil
+		}
+	}
+}
+
+func (w *RecoveryWorker) Metrics() RecoveryMetrics {
+	return RecoveryMetrics{
+		Scans:     w.scans.Load(),
+		Recovered: w.recovered.Load(),
+		Errors:    w.errors.Load(),
+		GaveUp:    w.gaveUp.Load(),
+	}
+}
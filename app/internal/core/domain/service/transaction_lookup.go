@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"kentech-project/internal/core/domain/model"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// GetTransaction returns a transaction of the user with its bet and rollback.
+func (s *TransactionService) GetTransaction(ctx context.Context, userID uuid.UUID, transactionID uuid.UUID) (*model.TransactionDetails, error) {
+	s.logger.Debugf("GetTransaction called: user_id=%s, transaction_id=%s", userID.String(), transactionID.String())
+	ctx, span := otel.Tracer("").Start(ctx, "TransactionService.GetTransaction", trace.WithAttributes(
+		attribute.String("user_id", userID.String()),
+		attribute.String("transaction_id", transactionID.String()),
+	))
+	defer span.End()
+
+	transaction, err := s.txRepo.GetByID(ctx, transactionID)
+	if err != nil {
+		s.logger.Warnf("GetTransaction failed for transaction_id=%s: %s", transactionID.String(), err.Error())
+		return nil, err
+	}
+
+	if transaction.UserID != userID {
+		s.logger.Warnf("GetTransaction failed: unauthorized user_id=%s for transaction_id=%s", userID.String(), transactionID.String())
+		return nil, model.ErrUnauthorized
+	}
+
+	return s.transactionDetails(ctx, transaction)
+}
+
+// GetTransactionByReference returns the transaction the user made with a provider transaction ID.
+// Without a type the withdraw or deposit made with the reference is returned, like a cancel resolves it,
+// and the rollback type returns the rollback of that transaction.
+func (s *TransactionService) GetTransactionByReference(ctx context.Context, userID uuid.UUID, txType model.TransactionType, providerTxID string) (*model.TransactionDetails, error) {
+	s.logger.Debugf("GetTransactionByReference called: user_id=%s, type=%s, providerTxID=%s", userID.String(), txType, providerTxID)
+	ctx, span := otel.Tracer("").Start(ctx, "TransactionService.GetTransactionByReference", trace.WithAttributes(
+		attribute.String("user_id", userID.String()),
+		attribute.String("type", string(txType)),
+		attribute.String("provider_tx_id", providerTxID),
+	))
+	defer span.End()
+
+	if providerTxID == "" {
+		s.logger.Warnf("GetTransactionByReference failed: missing provider transaction id for user_id=%s", userID.String())
+		return nil, model.ErrMissingReference
+	}
+
+	var transaction *model.Transaction
+	var err error
+	switch txType {
+	case "":
+		transaction, err = s.findByReference(ctx, userID, "", providerTxID)
+	case model.TransactionTypeRollback:
+		transaction, err = s.findByReference(ctx, userID, "", providerTxID)
+		if err == nil {
+			transaction, err = s.txRepo.GetRollback(ctx, transaction.ID)
+		}
+	default:
+		transaction, err = s.txRepo.GetByReference(ctx, userID, txType, providerTxID)
+	}
+	if err != nil {
+		s.logger.Warnf("GetTransactionByReference failed for providerTxID=%s: %s", providerTxID, err.Error())
+		return nil, err
+	}
+
+	return s.transactionDetails(ctx, transaction)
+}
+
+// transactionDetails loads the bet and the rollback links of a transaction. A rollback is linked to
+// the transaction it reverses by OriginalTransactionID.
+func (s *TransactionService) transactionDetails(ctx context.Context, transaction *model.Transaction) (*model.TransactionDetails, error) {
+	details := &model.TransactionDetails{Transaction: transaction}
+
+	betTransactionID := transaction.ID
+	if transaction.OriginalTransactionID != nil {
+		original, err := s.txRepo.GetByID(ctx, *transaction.OriginalTransactionID)
+		if err != nil {
+			s.logger.Error("Failed to fetch original transaction: " + err.Error())
+			return nil, err
+		}
+		details.OriginalTransaction = original
+		betTransactionID = original.ID
+	} else if transaction.Type != model.TransactionTypeRollback {
+		rollback, err := s.txRepo.GetRollback(ctx, transaction.ID)
+		switch {
+		case err == nil:
+			details.Rollback = rollback
+		case !errors.Is(err, model.ErrTransactionNotFound):
+			s.logger.Error("Failed to fetch rollback transaction: " + err.Error())
+			return nil, err
+		}
+	}
+
+	bet, err := s.betRepo.GetByTransactionID(ctx, betTransactionID)
+	switch {
+	case err == nil:
+		details.Bet = bet
+	case !errors.Is(err, model.ErrBetNotFound):
+		s.logger.Error("Failed to fetch bet: " + err.Error())
+		return nil, err
+	}
+
+	s.logger.Infof("Transaction details fetched: transaction_id=%s", transaction.ID.String())
+	return details, nil
+}
@@ -2,10 +2,12 @@ package service
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"kentech-project/internal/core/domain/model"
 	"kentech-project/pkg/logger"
-	"strconv"
+	"time"
+
+	"kentech-project/internal/adapters/repository/wallet"
 
 	"github.com/google/uuid"
 	"go.opentelemetry.io/otel"
@@ -14,43 +16,65 @@ import (
 	"kentech-project/internal/core/port"
 )
 
+// maxConflictRetries bounds how often an update is repeated over a concurrently modified row.
+const maxConflictRetries = 3
+
 type TransactionService struct {
 	userRepo      port.UserRepository
 	txRepo        port.TransactionRepository
+	betRepo       port.BetRepository
 	walletService port.WalletService
-	db            *sql.DB
+	exchange      *ExchangeService
+	uow           port.UnitOfWork
+	locks         port.PlayerLocker
 	logger        *logger.Logger
 }
 
 func NewTransactionService(userRepo port.UserRepository,
 	txRepo port.TransactionRepository,
+	betRepo port.BetRepository,
 	walletService port.WalletService,
-	db *sql.DB,
+	exchange *ExchangeService,
+	uow port.UnitOfWork,
+	locks port.PlayerLocker,
 	log *logger.Logger) *TransactionService {
 	return &TransactionService{
 		userRepo:      userRepo,
 		txRepo:        txRepo,
+		betRepo:       betRepo,
 		walletService: walletService,
-		db:            db,
+		exchange:      exchange,
+		uow:           uow,
+		locks:         locks,
 		logger:        log,
 	}
 }
 
-func (s *TransactionService) Deposit(ctx context.Context, userID uuid.UUID, currency string, amount float64, providerTxID, providerWithdrawnID string) (*model.TransactionResponse, error) {
-	s.logger.Debugf("Deposit called: user_id=%s, amount=%f, currency=%s, providerTxID=%s, providerWithdrawnID=%s", userID.String(), amount, currency, providerTxID, providerWithdrawnID)
+func (s *TransactionService) Deposit(ctx context.Context, userID uuid.UUID, amount model.Money, providerTxID, providerWithdrawnID string) (*model.TransactionResponse, error) {
+	s.logger.Debugf("Deposit called: user_id=%s, amount=%s, currency=%s, providerTxID=%s, providerWithdrawnID=%s", userID.String(), amount, amount.Currency(), providerTxID, providerWithdrawnID)
 
 	ctx, span := otel.Tracer("").Start(ctx, "TransactionService.Deposit", trace.WithAttributes(
 		attribute.String("user_id", userID.String()),
-		attribute.Float64("amount", amount),
-		attribute.String("currency", currency),
+		attribute.String("amount", amount.String()),
+		attribute.String("currency", amount.Currency()),
 		attribute.String("provider_tx_id", providerTxID),
 	))
 	defer span.End()
 
-	if amount < 0 {
-		s.logger.Warnf("Deposit failed: invalid amount %f for user_id=%s", amount, userID.String())
+	if amount.IsNegative() {
+		s.logger.Warnf("Deposit failed: invalid amount %s for user_id=%s", amount, userID.String())
 		return nil, model.ErrInvalidAmount
 	}
+	if providerTxID == "" {
+		s.logger.Warnf("Deposit failed: missing provider transaction id for user_id=%s", userID.String())
+		return nil, model.ErrMissingReference
+	}
+
+	unlock, err := s.lockPlayer(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	s.logger.Debugf("Fetching user by ID: %s", userID.String())
 	user, err := s.userRepo.GetByID(ctx, userID)
@@ -59,254 +83,868 @@ func (s *TransactionService) Deposit(ctx context.Context, userID uuid.UUID, curr
 		return nil, err
 	}
 
-	oldBalance := user.Balance
-	s.logger.Debugf("User found. Old balance: %f", oldBalance)
+	previous, replay, err := s.checkIdempotency(ctx, userID, model.TransactionTypeDeposit, providerTxID, amount)
+	if err != nil {
+		s.logger.Warnf("Deposit failed: idempotency check for providerTxID=%s: %s", providerTxID, err.Error())
+		return nil, err
+	}
+	if replay != nil {
+		s.logger.Infof("Deposit replayed: user_id=%s, transaction_id=%s, providerTxID=%s", userID.String(), replay.TransactionID, providerTxID)
+		return replay, nil
+	}
 
-	transaction := &model.Transaction{
-		UserID:    userID,
-		Type:      model.TransactionTypeDeposit,
-		Amount:    amount,
-		Status:    model.TransactionStatusPending,
-		Reference: providerTxID,
+	s.logger.Debugf("Fetching bet by provider withdrawn ID: %s", providerWithdrawnID)
+	bet, err := s.betRepo.GetByProviderBetID(ctx, userID, providerWithdrawnID)
+	if err != nil {
+		s.logger.Warnf("Deposit failed: no bet for providerWithdrawnID=%s: %s", providerWithdrawnID, err.Error())
+		return nil, err
 	}
+	if bet.Status != model.BetStatusOpen {
+		s.logger.Warnf("Deposit failed: bet_id=%s is already %s", bet.ID.String(), bet.Status)
+		return nil, model.ErrBetAlreadySettled
+	}
+	if bet.DepositTransactionID != nil && (previous == nil || *bet.DepositTransactionID != previous.ID) {
+		s.logger.Warnf("Deposit failed: bet_id=%s is being settled by transaction_id=%s", bet.ID.String(), bet.DepositTransactionID.String())
+		return nil, model.ErrTransactionInProgress
+	}
+
+	walletAmount, rate, err := s.convert(ctx, previous, amount, user.Currency, model.TransactionTypeDeposit)
+	if err != nil {
+		s.logger.Warnf("Deposit failed: cannot convert %s to account currency %s: %s", amount.Currency(), user.Currency, err.Error())
+		return nil, err
+	}
+
+	oldBalance := user.Balance
+	s.logger.Debugf("User found. Old balance: %s", oldBalance)
+
 	s.logger.Debug("Creating deposit transaction record")
-	if err := s.txRepo.Create(ctx, transaction); err != nil {
+	var transaction *model.Transaction
+	err = s.uow.RunInTx(ctx, func(ctx context.Context, repos port.Repositories) error {
+		var err error
+		transaction, err = s.startTransaction(ctx, repos.Transactions, previous, &model.Transaction{
+			UserID:        userID,
+			Type:          model.TransactionTypeDeposit,
+			Amount:        walletAmount,
+			Currency:      walletAmount.Currency(),
+			Reference:     providerTxID,
+			BalanceBefore: &oldBalance,
+			GameAmount:    amount,
+			GameCurrency:  amount.Currency(),
+			ExchangeRate:  rate,
+		})
+		if err != nil {
+			return err
+		}
+
+		// claim the bet, so a pending deposit can be found from its bet and no other deposit settles it meanwhile
+		bet.DepositTransactionID = &transaction.ID
+		return repos.Bets.Update(ctx, bet)
+	})
+	if err != nil {
 		s.logger.Error("Deposit failed: transaction creation error: " + err.Error())
 		return nil, err
 	}
 
 	s.logger.Info("Calling wallet service for deposit")
+	if err := s.execute(ctx, transaction, bet, nil, user); err != nil {
+		return nil, err
+	}
+
+	response := transactionResponse(transaction)
+	s.logger.Infof("Deposit successful: user_id=%s, transaction_id=%s, status=%s", userID.String(), transaction.ID.String(), response.Status)
+
+	return response, nil
+}
+
+func (s *TransactionService) Withdraw(ctx context.Context, userID uuid.UUID, amount model.Money, providerTxID string) (*model.TransactionResponse, error) {
+	s.logger.Debugf("Withdraw called: user_id=%s, amount=%s, currency=%s, providerTxID=%s", userID.String(), amount, amount.Currency(), providerTxID)
 
-	walletUserID, err := s.getWalletUserID(ctx, userID)
+	ctx, span := otel.Tracer("").Start(ctx, "TransactionService.Withdraw", trace.WithAttributes(
+		attribute.String("user_id", userID.String()),
+		attribute.String("amount", amount.String()),
+		attribute.String("currency", amount.Currency()),
+		attribute.String("provider_tx_id", providerTxID),
+	))
+	defer span.End()
+
+	if !amount.IsPositive() {
+		s.logger.Warnf("Withdraw failed: invalid amount %s for user_id=%s", amount, userID.String())
+		return nil, model.ErrInvalidAmount
+	}
+	if providerTxID == "" {
+		s.logger.Warnf("Withdraw failed: missing provider transaction id for user_id=%s", userID.String())
+		return nil, model.ErrMissingReference
+	}
+
+	// the balance checked below stays the balance of the player until the withdraw is recorded
+	unlock, err := s.lockPlayer(ctx, userID)
 	if err != nil {
-		s.logger.Error("Failed to get wallet user ID: " + err.Error())
 		return nil, err
 	}
-	walletResp, err := s.walletService.ProcessDeposit(ctx, walletUserID, amount, currency, 0, providerTxID)
+	defer unlock()
+
+	s.logger.Debugf("Fetching user by ID: %s", userID.String())
+	user, err := s.userRepo.GetByID(ctx, userID)
 	if err != nil {
-		s.logger.Error("Wallet service deposit failed: " + err.Error())
-		err2 := s.txRepo.UpdateStatus(ctx, transaction.ID, model.TransactionStatusFailed)
-		if err2 != nil {
-			s.logger.Error("Failed to update transaction status to failed: " + err.Error())
-			return nil, err2
-		}
+		s.logger.Error("Withdraw failed: user not found or repo error: " + err.Error())
 		return nil, err
 	}
 
-	newBalance, err := strconv.ParseFloat(walletResp.Balance, 64)
+	previous, replay, err := s.checkIdempotency(ctx, userID, model.TransactionTypeWithdraw, providerTxID, amount)
 	if err != nil {
-		s.logger.Error("Failed to parse wallet balance: " + err.Error())
+		s.logger.Warnf("Withdraw failed: idempotency check for providerTxID=%s: %s", providerTxID, err.Error())
 		return nil, err
 	}
+	if replay != nil {
+		s.logger.Infof("Withdraw replayed: user_id=%s, transaction_id=%s, providerTxID=%s", userID.String(), replay.TransactionID, providerTxID)
+		return replay, nil
+	}
 
-	tx, err := s.db.BeginTx(ctx, nil)
+	walletAmount, rate, err := s.convert(ctx, previous, amount, user.Currency, model.TransactionTypeWithdraw)
 	if err != nil {
-		s.logger.Error("Failed to begin DB transaction: " + err.Error())
+		s.logger.Warnf("Withdraw failed: cannot convert %s to account currency %s: %s", amount.Currency(), user.Currency, err.Error())
 		return nil, err
 	}
-	defer func(tx *sql.Tx) { _ = tx.Rollback() }(tx)
+	if !walletAmount.IsPositive() {
+		s.logger.Warnf("Withdraw failed: amount %s %s converts to nothing in %s", amount, amount.Currency(), user.Currency)
+		return nil, model.ErrInvalidAmount
+	}
 
-	transaction.Status = model.TransactionStatusCompleted
-	s.logger.Debug("Updating transaction status to completed")
-	if err := s.txRepo.Update(ctx, transaction); err != nil {
-		s.logger.Error("Failed to update transaction status: " + err.Error())
+	oldBalance := user.Balance
+	s.logger.Debugf("User found. Old balance: %s", oldBalance)
+	cmp, err := oldBalance.Cmp(walletAmount)
+	if err != nil {
 		return nil, err
 	}
+	if cmp < 0 {
+		s.logger.Warnf("Withdraw failed: insufficient balance for user_id=%s, requested=%s, available=%s", userID.String(), walletAmount, oldBalance)
+		return nil, model.ErrInsufficientBalance
+	}
 
-	s.logger.Debugf("Updating user balance to: %f", newBalance)
-	if err := s.userRepo.UpdateBalance(ctx, userID, newBalance); err != nil {
-		s.logger.Error("Failed to update user balance: " + err.Error())
+	s.logger.Debug("Creating withdraw transaction record")
+	var transaction *model.Transaction
+	var bet *model.Bet
+	err = s.uow.RunInTx(ctx, func(ctx context.Context, repos port.Repositories) error {
+		var err error
+		transaction, err = s.startTransaction(ctx, repos.Transactions, previous, &model.Transaction{
+			UserID:        userID,
+			Type:          model.TransactionTypeWithdraw,
+			Amount:        walletAmount,
+			Currency:      walletAmount.Currency(),
+			Reference:     providerTxID,
+			BalanceBefore: &oldBalance,
+			GameAmount:    amount,
+			GameCurrency:  amount.Currency(),
+			ExchangeRate:  rate,
+		})
+		if err != nil {
+			return err
+		}
+
+		bet, err = s.placeBet(ctx, repos.Bets, transaction)
+		return err
+	})
+	if err != nil {
+		s.logger.Error("Withdraw failed: transaction creation error: " + err.Error())
 		return nil, err
 	}
 
-	if err := tx.Commit(); err != nil {
-		s.logger.Error("Failed to commit DB transaction: " + err.Error())
+	s.logger.Info("Calling wallet service for withdraw")
+	if err := s.execute(ctx, transaction, bet, nil, user); err != nil {
 		return nil, err
 	}
 
-	status := "LOST"
-	if amount > 0 {
-		status = "WON"
-	}
-	s.logger.Infof("Deposit successful: user_id=%s, transaction_id=%s, status=%s", userID.String(), transaction.ID.String(), status)
+	s.logger.Infof("Withdraw successful: user_id=%s, transaction_id=%s", userID.String(), transaction.ID.String())
 
-	return &model.TransactionResponse{
-		TransactionID:         transaction.ID.String(),
-		ProviderTransactionID: providerTxID,
-		OldBalance:            oldBalance,
-		NewBalance:            newBalance,
-		Status:                status,
-	}, nil
+	return transactionResponse(transaction), nil
 }
 
-func (s *TransactionService) Withdraw(ctx context.Context, userID uuid.UUID, currency string, amount float64, providerTxID string) (*model.TransactionResponse, error) {
-	s.logger.Debugf("Withdraw called: user_id=%s, amount=%f, currency=%s, providerTxID=%s", userID.String(), amount, currency, providerTxID)
+func (s *TransactionService) CancelTransaction(ctx context.Context, userID uuid.UUID, transactionID uuid.UUID) (*model.TransactionResponse, error) {
+	s.logger.Debugf("CancelTransaction called: user_id=%s, transaction_id=%s", userID.String(), transactionID.String())
+	ctx, span := otel.Tracer("").Start(ctx, "TransactionService.CancelTransaction", trace.WithAttributes(
+		attribute.String("user_id", userID.String()),
+		attribute.String("transaction_id", transactionID.String()),
+	))
+	defer span.End()
 
-	ctx, span := otel.Tracer("").Start(ctx, "TransactionService.Withdraw", trace.WithAttributes(
+	unlock, err := s.lockPlayer(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	transaction, err := s.txRepo.GetByID(ctx, transactionID)
+	if err != nil {
+		s.logger.Error("CancelTransaction failed: could not fetch transaction: " + err.Error())
+		return nil, model.ErrTransactionNotFound
+	}
+
+	if transaction.UserID != userID {
+		s.logger.Warnf("CancelTransaction failed: unauthorized user_id=%s for transaction_id=%s", userID.String(), transactionID.String())
+		return nil, model.ErrUnauthorized
+	}
+
+	return s.cancel(ctx, transaction)
+}
+
+// CancelByReference cancels a transaction identified by the provider transaction ID, which is the
+// only identifier game providers know. A withdraw and a deposit may share a provider transaction ID:
+// txType tells them apart, and when it is empty the reference must belong to only one of them. When
+// no transaction exists for the reference a canceled tombstone of txType (a withdraw by default) is
+// recorded, so a transaction arriving after its own cancel is refused.
+func (s *TransactionService) CancelByReference(ctx context.Context, userID uuid.UUID, txType model.TransactionType, providerTxID string) (*model.TransactionResponse, error) {
+	s.logger.Debugf("CancelByReference called: user_id=%s, type=%s, providerTxID=%s", userID.String(), txType, providerTxID)
+	ctx, span := otel.Tracer("").Start(ctx, "TransactionService.CancelByReference", trace.WithAttributes(
 		attribute.String("user_id", userID.String()),
-		attribute.Float64("amount", amount),
-		attribute.String("currency", currency),
+		attribute.String("type", string(txType)),
 		attribute.String("provider_tx_id", providerTxID),
 	))
 	defer span.End()
 
-	if amount <= 0 {
-		s.logger.Warnf("Withdraw failed: invalid amount %f for user_id=%s", amount, userID.String())
-		return nil, model.ErrInvalidAmount
+	if providerTxID == "" {
+		s.logger.Warnf("CancelByReference failed: missing provider transaction id for user_id=%s", userID.String())
+		return nil, model.ErrMissingReference
+	}
+	if txType != "" && txType != model.TransactionTypeWithdraw && txType != model.TransactionTypeDeposit {
+		s.logger.Warnf("CancelByReference failed: invalid transaction type %q for user_id=%s", txType, userID.String())
+		return nil, model.ErrInvalidTransactionType
 	}
 
-	s.logger.Debugf("Fetching user by ID: %s", userID.String())
-	user, err := s.userRepo.GetByID(ctx, userID)
+	unlock, err := s.lockPlayer(ctx, userID)
 	if err != nil {
-		s.logger.Error("Withdraw failed: user not found or repo error: " + err.Error())
 		return nil, err
 	}
+	defer unlock()
 
-	oldBalance := user.Balance
-	s.logger.Debugf("User found. Old balance: %f", oldBalance)
-	if oldBalance < amount {
-		s.logger.Warnf("Withdraw failed: insufficient balance for user_id=%s, requested=%f, available=%f", userID.String(), amount, oldBalance)
-		return nil, model.ErrInsufficientBalance
+	transaction, err := s.findByReference(ctx, userID, txType, providerTxID)
+	if errors.Is(err, model.ErrTransactionNotFound) {
+		if txType == "" {
+			txType = model.TransactionTypeWithdraw
+		}
+		return s.recordTombstone(ctx, userID, txType, providerTxID)
+	}
+	if err != nil {
+		s.logger.Warnf("CancelByReference failed: could not fetch transaction: %s", err.Error())
+		return nil, err
 	}
 
-	transaction := &model.Transaction{
-		UserID:    userID,
-		Type:      model.TransactionTypeWithdraw,
-		Amount:    amount,
-		Status:    model.TransactionStatusPending,
-		Reference: providerTxID,
+	return s.cancel(ctx, transaction)
+}
+
+// findByReference resolves a provider transaction ID to the transaction of txType it was used for.
+// Without a type, both withdraws and deposits are looked up and a reference used by both is ambiguous.
+func (s *TransactionService) findByReference(ctx context.Context, userID uuid.UUID, txType model.TransactionType, providerTxID string) (*model.Transaction, error) {
+	if txType != "" {
+		return s.txRepo.GetByReference(ctx, userID, txType, providerTxID)
 	}
-	s.logger.Debug("Creating withdraw transaction record")
-	if err := s.txRepo.Create(ctx, transaction); err != nil {
-		s.logger.Error("Withdraw failed: transaction creation error: " + err.Error())
+
+	var found *model.Transaction
+	for _, txType := range []model.TransactionType{model.TransactionTypeWithdraw, model.TransactionTypeDeposit} {
+		transaction, err := s.txRepo.GetByReference(ctx, userID, txType, providerTxID)
+		if errors.Is(err, model.ErrTransactionNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if found != nil {
+			return nil, model.ErrAmbiguousReference
+		}
+		found = transaction
+	}
+	if found == nil {
+		return nil, model.ErrTransactionNotFound
+	}
+	return found, nil
+}
+
+func (s *TransactionService) recordTombstone(ctx context.Context, userID uuid.UUID, txType model.TransactionType, providerTxID string) (*model.TransactionResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		s.logger.Error("CancelByReference failed: user not found or repo error: " + err.Error())
 		return nil, err
 	}
 
-	s.logger.Info("Calling wallet service for withdraw")
+	tombstone := &model.Transaction{
+		UserID:        userID,
+		Type:          txType,
+		Amount:        model.NewMoney(0, user.Currency),
+		Currency:      user.Currency,
+		Status:        model.TransactionStatusCanceled,
+		Reference:     providerTxID,
+		BalanceBefore: &user.Balance,
+		BalanceAfter:  &user.Balance,
+		GameAmount:    model.NewMoney(0, user.Currency),
+		GameCurrency:  user.Currency,
+	}
+	if err := s.txRepo.Create(ctx, tombstone); err != nil {
+		if errors.Is(err, model.ErrDuplicateTransaction) {
+			// the transaction arrived while the tombstone was being written, cancel it instead
+			transaction, err := s.findByReference(ctx, userID, txType, providerTxID)
+			if err != nil {
+				return nil, err
+			}
+			return s.cancel(ctx, transaction)
+		}
+		s.logger.Error("CancelByReference failed: could not record tombstone: " + err.Error())
+		return nil, err
+	}
+
+	s.logger.Infof("CancelByReference recorded tombstone: transaction_id=%s, providerTxID=%s", tombstone.ID.String(), providerTxID)
+	return transactionResponse(tombstone), nil
+}
+
+func (s *TransactionService) cancel(ctx context.Context, transaction *model.Transaction) (*model.TransactionResponse, error) {
+	if transaction.Status == model.TransactionStatusCanceled {
+		s.logger.Infof("Cancel replayed: transaction_id=%s already canceled", transaction.ID.String())
+		return transactionResponse(transaction), nil
+	}
+
+	if transaction.Type == model.TransactionTypeRollback {
+		s.logger.Warnf("CancelTransaction failed: rollback transaction_id=%s cannot be canceled", transaction.ID.String())
+		return nil, model.ErrTransactionNotCancelable
+	}
+
+	switch transaction.Status {
+	case model.TransactionStatusCompleted, model.TransactionStatusRolledBack:
+		return s.rollback(ctx, transaction)
+	case model.TransactionStatusPending:
+		// the wallet has no cancel endpoint: the outcome of the wallet call is settled first, and
+		// the completed transaction is rolled back
+		s.logger.Infof("CancelTransaction: recovering pending transaction_id=%s before rolling it back", transaction.ID.String())
+		if err := s.recoverPending(ctx, transaction); err != nil {
+			s.logger.Warnf("CancelTransaction failed: outcome of pending transaction_id=%s unknown: %s", transaction.ID.String(), err.Error())
+			return nil, err
+		}
+		return s.rollback(ctx, transaction)
+	default:
+		s.logger.Warnf("CancelTransaction failed: transaction_id=%s with status=%s cannot be canceled", transaction.ID.String(), transaction.Status)
+		return nil, model.ErrTransactionNotCancelable
+	}
+}
+
+// rollback reverses a completed withdraw or deposit. The wallet has no cancel endpoint for settled
+// operations, so the reversal is a compensating wallet call (a deposit crediting the stake back, or
+// a withdraw debiting the win) recorded as a rollback transaction linked to the original one.
+// Rolling back an already rolled back transaction replays the compensating transaction.
+func (s *TransactionService) rollback(ctx context.Context, original *model.Transaction) (*model.TransactionResponse, error) {
+	s.logger.Debugf("Rollback called: transaction_id=%s, type=%s, amount=%s", original.ID.String(), original.Type, original.Amount)
 
-	walletUserID, err := s.getWalletUserID(ctx, userID)
+	user, err := s.userRepo.GetByID(ctx, original.UserID)
 	if err != nil {
-		s.logger.Error("Failed to get wallet user ID: " + err.Error())
+		s.logger.Error("Rollback failed: user not found or repo error: " + err.Error())
 		return nil, err
 	}
-	walletResp, err := s.walletService.ProcessWithdraw(ctx, walletUserID, amount, currency, 0, providerTxID)
+
+	existing, err := s.txRepo.GetRollback(ctx, original.ID)
+	previous, replay, err := s.resolveExisting(existing, err, original.GameAmount)
 	if err != nil {
-		s.logger.Error("Wallet service withdraw failed: " + err.Error())
-		err := s.txRepo.UpdateStatus(ctx, transaction.ID, model.TransactionStatusFailed)
+		s.logger.Warnf("Rollback failed: idempotency check for transaction_id=%s: %s", original.ID.String(), err.Error())
+		return nil, err
+	}
+	if replay != nil {
+		s.logger.Infof("Rollback replayed: transaction_id=%s, rollback_transaction_id=%s", original.ID.String(), replay.TransactionID)
+		return replay, nil
+	}
+
+	if original.Type == model.TransactionTypeDeposit {
+		cmp, err := user.Balance.Cmp(original.Amount)
 		if err != nil {
-			s.logger.Error("Failed to update transaction status to failed: " + err.Error())
+			s.logger.Warnf("Rollback failed: currency of transaction_id=%s does not match balance currency %s", original.ID.String(), user.Balance.Currency())
 			return nil, err
 		}
-		return nil, err
+		if cmp < 0 {
+			s.logger.Warnf("Rollback failed: insufficient balance to reverse deposit transaction_id=%s, available=%s", original.ID.String(), user.Balance)
+			return nil, model.ErrInsufficientBalance
+		}
 	}
 
-	newBalance, err := strconv.ParseFloat(walletResp.Balance, 64)
+	bet, err := s.betRepo.GetByTransactionID(ctx, original.ID)
 	if err != nil {
-		s.logger.Error("Failed to parse wallet balance: " + err.Error())
+		s.logger.Error("Rollback failed: could not fetch bet: " + err.Error())
 		return nil, err
 	}
-
-	tx, err := s.db.BeginTx(ctx, nil)
+	if original.Type == model.TransactionTypeWithdraw && bet.Status != model.BetStatusOpen {
+		s.logger.Warnf("Rollback failed: bet_id=%s of withdraw transaction_id=%s is already %s", bet.ID.String(), original.ID.String(), bet.Status)
+		return nil, model.ErrBetAlreadySettled
+	}
+
+	originalID := original.ID
+	compensation, err := s.startTransaction(ctx, s.txRepo, previous, &model.Transaction{
+		UserID:                original.UserID,
+		Type:                  model.TransactionTypeRollback,
+		Amount:                original.Amount,
+		Currency:              original.Currency,
+		Reference:             original.Reference,
+		BalanceBefore:         &user.Balance,
+		OriginalTransactionID: &originalID,
+		GameAmount:            original.GameAmount,
+		GameCurrency:          original.GameCurrency,
+		ExchangeRate:          original.ExchangeRate,
+	})
 	if err != nil {
-		s.logger.Error("Failed to begin DB transaction: " + err.Error())
+		s.logger.Error("Rollback failed: transaction creation error: " + err.Error())
 		return nil, err
 	}
-	defer func(tx *sql.Tx) { _ = tx.Rollback() }(tx)
 
-	transaction.Status = model.TransactionStatusCompleted
-	s.logger.Debug("Updating transaction status to completed")
-	if err := s.txRepo.Update(ctx, transaction); err != nil {
-		s.logger.Error("Failed to update transaction status: " + err.Error())
+	if err := s.execute(ctx, compensation, bet, original, user); err != nil {
 		return nil, err
 	}
 
-	s.logger.Debugf("Updating user balance to: %f", newBalance)
-	if err := s.userRepo.UpdateBalance(ctx, userID, newBalance); err != nil {
-		s.logger.Error("Failed to update user balance: " + err.Error())
-		return nil, err
+	s.logger.Infof("Rollback successful: transaction_id=%s, rollback_transaction_id=%s", original.ID.String(), compensation.ID.String())
+	return transactionResponse(compensation), nil
+}
+
+// RecoverTransaction finalises a transaction left pending by a crash or by a wallet call with an
+// unknown outcome. The wallet call is re-driven under the transaction's own reference, so an
+// operation the wallet already applied is not applied twice. A re-driven call repeats a reference
+// an earlier attempt may have applied, so no error proves the operation did not happen: the
+// transaction is only completed, any error leaves it pending for the next attempt.
+func (s *TransactionService) RecoverTransaction(ctx context.Context, transaction *model.Transaction) error {
+	s.logger.Debugf("RecoverTransaction called: transaction_id=%s, type=%s", transaction.ID.String(), transaction.Type)
+	ctx, span := otel.Tracer("").Start(ctx, "TransactionService.RecoverTransaction", trace.WithAttributes(
+		attribute.String("transaction_id", transaction.ID.String()),
+		attribute.String("type", string(transaction.Type)),
+	))
+	defer span.End()
+
+	if transaction.Status != model.TransactionStatusPending {
+		return nil
+	}
+
+	unlock, err := s.lockPlayer(ctx, transaction.UserID)
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	if err := tx.Commit(); err != nil {
-		s.logger.Error("Failed to commit DB transaction: " + err.Error())
+	// the request that created the transaction may have finished it while the lock was awaited
+	current, err := s.txRepo.GetByID(ctx, transaction.ID)
+	if err != nil {
+		s.logger.Error("RecoverTransaction failed: could not fetch transaction: " + err.Error())
+		return err
+	}
+	*transaction = *current
+	if transaction.Status != model.TransactionStatusPending {
+		s.logger.Infof("RecoverTransaction: transaction_id=%s already %s", transaction.ID.String(), transaction.Status)
+		return nil
+	}
+	if err := s.recoverPending(ctx, transaction); err != nil {
+		return err
+	}
+	s.logger.Infof("RecoverTransaction successful: transaction_id=%s completed", transaction.ID.String())
+	return nil
+}
+
+// recoverPending re-drives the wallet call of a pending transaction and completes it on success. The
+// caller holds the lock of the player.
+func (s *TransactionService) recoverPending(ctx context.Context, transaction *model.Transaction) error {
+	user, err := s.userRepo.GetByID(ctx, transaction.UserID)
+	if err != nil {
+		s.logger.Error("RecoverTransaction failed: user not found or repo error: " + err.Error())
+		return err
+	}
+
+	var original *model.Transaction
+	betTransactionID := transaction.ID
+	if transaction.Type == model.TransactionTypeRollback {
+		if transaction.OriginalTransactionID == nil {
+			s.logger.Errorf("RecoverTransaction failed: rollback transaction_id=%s has no original transaction", transaction.ID.String())
+			return model.ErrTransactionNotFound
+		}
+		original, err = s.txRepo.GetByID(ctx, *transaction.OriginalTransactionID)
+		if err != nil {
+			s.logger.Error("RecoverTransaction failed: could not fetch original transaction: " + err.Error())
+			return err
+		}
+		betTransactionID = original.ID
+	}
+
+	bet, err := s.betRepo.GetByTransactionID(ctx, betTransactionID)
+	if err != nil {
+		s.logger.Error("RecoverTransaction failed: could not fetch bet: " + err.Error())
+		return err
+	}
+
+	newBalance, err := s.callWallet(ctx, transaction, bet, original, user)
+	if err != nil {
+		s.logger.Errorf("RecoverTransaction: outcome of transaction_id=%s still unknown: %s", transaction.ID.String(), err.Error())
+		return err
+	}
+	return s.completeTransaction(ctx, transaction, bet, original, newBalance)
+}
+
+// lockPlayer locks the balance of a user until the returned function is called, see port.PlayerLocker.
+func (s *TransactionService) lockPlayer(ctx context.Context, userID uuid.UUID) (func(), error) {
+	unlock, err := s.locks.Lock(ctx, userID)
+	if err != nil {
+		s.logger.Warnf("Failed to lock user_id=%s: %s", userID.String(), err.Error())
 		return nil, err
 	}
+	return unlock, nil
+}
 
-	s.logger.Infof("Withdraw successful: user_id=%s, transaction_id=%s", userID.String(), transaction.ID.String())
+// updateTransaction stores transaction, which was read with status from. A concurrent write that
+// left the status as it was, like a counted recovery attempt, changes nothing the caller decided on:
+// the update is repeated over the current version, at most maxConflictRetries times.
+func (s *TransactionService) updateTransaction(ctx context.Context, txRepo port.TransactionRepository, transaction *model.Transaction, from model.TransactionStatus) error {
+	for retry := 0; ; retry++ {
+		err := txRepo.Update(ctx, transaction)
+		if !errors.Is(err, model.ErrConcurrentModification) || retry == maxConflictRetries {
+			return err
+		}
 
-	return &model.TransactionResponse{
-		TransactionID:         transaction.ID.String(),
-		ProviderTransactionID: providerTxID,
-		OldBalance:            oldBalance,
-		NewBalance:            newBalance,
-		Status:                "COMPLETED",
-	}, nil
+		current, err := txRepo.GetByID(ctx, transaction.ID)
+		if err != nil {
+			return err
+		}
+		if current.Status != from {
+			s.logger.Warnf("Transaction_id=%s was moved to status=%s concurrently", transaction.ID.String(), current.Status)
+			return model.ErrConcurrentModification
+		}
+		s.logger.Infof("Retrying update of transaction_id=%s modified concurrently", transaction.ID.String())
+		transaction.RecoveryAttempts = current.RecoveryAttempts
+		transaction.Version = current.Version
+	}
 }
 
-func (s *TransactionService) CancelTransaction(ctx context.Context, userID uuid.UUID, transactionID uuid.UUID) (*model.TransactionResponse, error) {
-	s.logger.Debugf("CancelTransaction called: user_id=%s, transaction_id=%s", userID.String(), transactionID.String())
-	ctx, span := otel.Tracer("").Start(ctx, "TransactionService.CancelTransaction", trace.WithAttributes(
-		attribute.String("user_id", userID.String()),
-		attribute.String("transaction_id", transactionID.String()),
-	))
-	defer span.End()
+// execute calls the wallet for a pending transaction and records the outcome, the new balance of
+// the player is stored on the transaction. The original transaction is only needed for rollbacks.
+// A transaction whose outcome is unknown stays pending for the recovery worker.
+func (s *TransactionService) execute(ctx context.Context, transaction *model.Transaction, bet *model.Bet, original *model.Transaction, user *model.User) error {
+	newBalance, err := s.callWallet(ctx, transaction, bet, original, user)
+	if err != nil {
+		s.logger.Errorf("Wallet service %s failed: %s", transaction.Type, err.Error())
+		if !walletRejected(err) {
+			s.logger.Warnf("Outcome of transaction_id=%s unknown, left pending for recovery", transaction.ID.String())
+			return err
+		}
+		if err2 := s.failTransaction(ctx, transaction, bet, err); err2 != nil {
+			s.logger.Error("Failed to update transaction status to failed: " + err2.Error())
+			return err2
+		}
+		return err
+	}
 
-	transaction, err := s.txRepo.GetByID(ctx, transactionID)
+	return s.completeTransaction(ctx, transaction, bet, original, newBalance)
+}
+
+// walletRejected reports whether a wallet operation that failed with err certainly did not happen:
+// the circuit breaker kept it from being sent, or the wallet refused its first send. Anything else
+// (5xx, timeouts, network errors, a 4xx answering a resend) leaves the outcome unknown.
+func walletRejected(err error) bool {
+	if errors.Is(err, model.ErrWalletUnavailable) {
+		return true
+	}
+	var walletErr *wallet.WalletError
+	return errors.As(err, &walletErr) && walletErr.Rejected()
+}
+
+// callWallet performs the wallet operation of a transaction under its own reference and returns
+// the resulting wallet balance; the ID of the wallet operation is set on the transaction. Repeating
+// it for the same transaction is safe, the wallet sees the same reference again.
+func (s *TransactionService) callWallet(ctx context.Context, transaction *model.Transaction, bet *model.Bet, original *model.Transaction, user *model.User) (model.Money, error) {
+	var walletResp wallet.OperationResponse
+	var err error
+	reference := transaction.Reference
+	switch transaction.Type {
+	case model.TransactionTypeDeposit:
+		walletResp, err = s.walletService.ProcessDeposit(ctx, user.WalletUserID, transaction.Amount, bet.WalletBetID, transaction.Reference)
+	case model.TransactionTypeWithdraw:
+		walletResp, err = s.walletService.ProcessWithdraw(ctx, user.WalletUserID, transaction.Amount, bet.WalletBetID, transaction.Reference)
+	case model.TransactionTypeRollback:
+		if original.Amount.IsZero() {
+			// nothing to reverse for a lost bet settlement
+			return user.Balance, nil
+		}
+		walletResp, err = s.compensate(ctx, user, bet.WalletBetID, original)
+		reference = rollbackReference(original)
+	}
 	if err != nil {
-		s.logger.Error("CancelTransaction failed: could not fetch transaction: " + err.Error())
-		return nil, model.ErrTransactionNotFound
+		return model.Money{}, err
 	}
 
-	if transaction.UserID != userID {
-		s.logger.Warnf("CancelTransaction failed: unauthorized user_id=%s for transaction_id=%s", userID.String(), transactionID.String())
-		return nil, model.ErrUnauthorized
+	newBalance, err := model.ParseMoney(walletResp.Balance, transaction.Currency)
+	if err != nil {
+		s.logger.Errorf("Failed to parse wallet balance %q: %s", walletResp.Balance, err.Error())
+		return model.Money{}, err
 	}
+	transaction.WalletTransactionID = walletTransactionID(walletResp, reference)
+	return newBalance, nil
+}
 
-	if transaction.Status != model.TransactionStatusPending {
-		s.logger.Warnf("CancelTransaction failed: transaction not pending for transaction_id=%s", transactionID.String())
-		return nil, model.ErrTransactionNotPending
+// walletTransactionID returns the ID of the wallet transaction made under reference, or of the only
+// transaction the wallet returned.
+func walletTransactionID(resp wallet.OperationResponse, reference string) *int {
+	for _, walletTx := range resp.Transactions {
+		if walletTx.Reference == reference || len(resp.Transactions) == 1 {
+			id := walletTx.ID
+			return &id
+		}
 	}
+	return nil
+}
 
-	oldBalance := 0.0
-	user, err := s.userRepo.GetByID(ctx, userID)
-	if err == nil {
-		oldBalance = user.Balance
+// completeTransaction records a successful wallet operation: the transaction is completed, the bet
+// is settled or reverted and the user balance follows the wallet.
+func (s *TransactionService) completeTransaction(ctx context.Context, transaction *model.Transaction, bet *model.Bet, original *model.Transaction, newBalance model.Money) error {
+	return s.uow.RunInTx(ctx, func(ctx context.Context, repos port.Repositories) error {
+		transaction.Status = model.TransactionStatusCompleted
+		transaction.BalanceAfter = &newBalance
+		s.logger.Debug("Updating transaction status to completed")
+		if err := s.updateTransaction(ctx, repos.Transactions, transaction, model.TransactionStatusPending); err != nil {
+			s.logger.Error("Failed to update transaction status: " + err.Error())
+			return err
+		}
+
+		switch transaction.Type {
+		case model.TransactionTypeDeposit:
+			s.logger.Debugf("Settling bet_id=%s", bet.ID.String())
+			settledAt := time.Now()
+			bet.Status = model.BetStatusLost
+			if transaction.Amount.IsPositive() {
+				bet.Status = model.BetStatusWon
+			}
+			bet.Payout = transaction.Amount
+			bet.DepositTransactionID = &transaction.ID
+			bet.SettledAt = &settledAt
+			if err := repos.Bets.Update(ctx, bet); err != nil {
+				s.logger.Error("Failed to settle bet: " + err.Error())
+				return err
+			}
+		case model.TransactionTypeRollback:
+			s.logger.Debugf("Updating original transaction status to rolled back for transaction_id=%s", original.ID.String())
+			original.Status = model.TransactionStatusRolledBack
+			if err := s.updateTransaction(ctx, repos.Transactions, original, model.TransactionStatusCompleted); err != nil {
+				s.logger.Error("Failed to update original transaction status: " + err.Error())
+				return err
+			}
+
+			if original.Type == model.TransactionTypeWithdraw {
+				bet.Status = model.BetStatusCanceled
+			} else {
+				// the settlement is undone, the bet is open again for a new settlement
+				bet.Status = model.BetStatusOpen
+				bet.Payout = model.NewMoney(0, bet.Currency)
+				bet.DepositTransactionID = nil
+				bet.SettledAt = nil
+			}
+			s.logger.Debugf("Updating bet_id=%s to status=%s", bet.ID.String(), bet.Status)
+			if err := repos.Bets.Update(ctx, bet); err != nil {
+				s.logger.Error("Failed to update bet: " + err.Error())
+				return err
+			}
+		}
+
+		if err := postToLedger(ctx, repos.Ledger, transaction, original, newBalance); err != nil {
+			s.logger.Error("Failed to post transaction to the ledger: " + err.Error())
+			return err
+		}
+
+		s.logger.Debugf("Updating user balance to: %s", newBalance)
+		if err := repos.Users.UpdateBalance(ctx, transaction.UserID, newBalance, time.Now()); err != nil {
+			s.logger.Error("Failed to update user balance: " + err.Error())
+			return err
+		}
+
+		// the wallet balance before the first transaction of a player that was never synced
+		opening, err := newBalance.Sub(balanceMovement(transaction, original))
+		if err != nil {
+			return err
+		}
+		if err := repos.Users.SetOpeningBalance(ctx, transaction.UserID, opening); err != nil {
+			s.logger.Error("Failed to set user opening balance: " + err.Error())
+			return err
+		}
+		return nil
+	})
+}
+
+// balanceMovement returns how a completed transaction changes the player balance: a withdraw, or the
+// rollback of a deposit, takes its amount away.
+func balanceMovement(transaction *model.Transaction, original *model.Transaction) model.Money {
+	if transaction.Type == model.TransactionTypeWithdraw ||
+		(transaction.Type == model.TransactionTypeRollback && original.Type == model.TransactionTypeDeposit) {
+		return transaction.Amount.Neg()
 	}
+	return transaction.Amount
+}
+
+// failTransaction records a wallet operation that did not happen because of cause. The bet placed
+// by a failed withdraw is canceled and the bet claimed by a failed deposit is released.
+func (s *TransactionService) failTransaction(ctx context.Context, transaction *model.Transaction, bet *model.Bet, cause error) error {
+	return s.uow.RunInTx(ctx, func(ctx context.Context, repos port.Repositories) error {
+		switch transaction.Type {
+		case model.TransactionTypeWithdraw:
+			bet.Status = model.BetStatusCanceled
+			if err := repos.Bets.Update(ctx, bet); err != nil {
+				s.logger.Error("Failed to cancel bet of failed withdraw: " + err.Error())
+				return err
+			}
+		case model.TransactionTypeDeposit:
+			bet.DepositTransactionID = nil
+			if err := repos.Bets.Update(ctx, bet); err != nil {
+				s.logger.Error("Failed to release bet of failed deposit: " + err.Error())
+				return err
+			}
+		}
+
+		transaction.Status = model.TransactionStatusFailed
+		transaction.BalanceAfter = transaction.BalanceBefore
+		transaction.FailureReason = cause.Error()
+		var walletErr *wallet.WalletError
+		if errors.As(cause, &walletErr) {
+			transaction.FailureReason = walletErr.Message
+		}
+		return s.updateTransaction(ctx, repos.Transactions, transaction, model.TransactionStatusPending)
+	})
+}
+
+// compensate performs the wallet operation opposite to the original one. It is sent under its own
+// reference so the wallet does not mistake it for a retry of the original operation.
+func (s *TransactionService) compensate(ctx context.Context, user *model.User, walletBetID int, original *model.Transaction) (wallet.OperationResponse, error) {
+	reference := rollbackReference(original)
+	if original.Type == model.TransactionTypeDeposit {
+		s.logger.Infof("Calling wallet service withdraw to reverse deposit reference=%s", original.Reference)
+		return s.walletService.ProcessWithdraw(ctx, user.WalletUserID, original.Amount, walletBetID, reference)
+	}
+	s.logger.Infof("Calling wallet service deposit to reverse withdraw reference=%s", original.Reference)
+	return s.walletService.ProcessDeposit(ctx, user.WalletUserID, original.Amount, walletBetID, reference)
+}
+
+// rollbackReference is the wallet reference of the compensation of original. It is keyed on the
+// transaction ID, a withdraw and a deposit may share a provider transaction ID.
+func rollbackReference(original *model.Transaction) string {
+	return "rollback-" + original.ID.String()
+}
 
-	if transaction.Reference != "" {
-		s.logger.Debugf("Calling walletService.CancelTransaction for reference=%s", transaction.Reference)
-		if err := s.walletService.CancelTransaction(ctx, transaction.Reference); err != nil {
-			s.logger.Error("CancelTransaction failed: walletService error: " + err.Error())
+// placeBet opens the bet placed by a withdraw. A retried withdraw reopens the bet its
+// failed attempt left canceled, so the wallet sees the same betId again.
+func (s *TransactionService) placeBet(ctx context.Context, betRepo port.BetRepository, withdraw *model.Transaction) (*model.Bet, error) {
+	bet, err := betRepo.GetByProviderBetID(ctx, withdraw.UserID, withdraw.Reference)
+	if errors.Is(err, model.ErrBetNotFound) {
+		bet = &model.Bet{
+			UserID:                withdraw.UserID,
+			ProviderBetID:         withdraw.Reference,
+			WithdrawTransactionID: withdraw.ID,
+			Stake:                 withdraw.Amount,
+			Payout:                model.NewMoney(0, withdraw.Currency),
+			Currency:              withdraw.Currency,
+			Status:                model.BetStatusOpen,
+			PlacedAt:              time.Now(),
+		}
+		if err := betRepo.Create(ctx, bet); err != nil {
 			return nil, err
 		}
+		return bet, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	s.logger.Debugf("Updating transaction status to canceled for transaction_id=%s", transactionID.String())
-	err = s.txRepo.UpdateStatus(ctx, transactionID, model.TransactionStatusCanceled)
+	bet.Status = model.BetStatusOpen
+	bet.Stake = withdraw.Amount
+	bet.PlacedAt = time.Now()
+	if err := betRepo.Update(ctx, bet); err != nil {
+		return nil, err
+	}
+	return bet, nil
+}
+
+// checkIdempotency looks up an earlier transaction made with the same provider transaction ID.
+// A completed transaction is replayed as its original response, a failed one is returned so it
+// can be retried under the same reference, a pending one is still in flight and a canceled one
+// (including cancel tombstones) must not be processed again. Requests are matched on the amount in
+// the game currency, the converted amount depends on the rate of the day. A replay reports the
+// balances stored with the original transaction.
+func (s *TransactionService) checkIdempotency(ctx context.Context, userID uuid.UUID, txType model.TransactionType, providerTxID string, amount model.Money) (*model.Transaction, *model.TransactionResponse, error) {
+	existing, err := s.txRepo.GetByReference(ctx, userID, txType, providerTxID)
+	return s.resolveExisting(existing, err, amount)
+}
+
+// resolveExisting applies the idempotency rules of checkIdempotency to the transaction found for a
+// request, or to the error of looking it up. Rollbacks are looked up by their original transaction.
+func (s *TransactionService) resolveExisting(existing *model.Transaction, err error, amount model.Money) (*model.Transaction, *model.TransactionResponse, error) {
+	if errors.Is(err, model.ErrTransactionNotFound) {
+		return nil, nil, nil
+	}
 	if err != nil {
-		s.logger.Error("CancelTransaction failed: could not update transaction status: " + err.Error())
+		return nil, nil, err
+	}
+
+	if existing.Status == model.TransactionStatusCanceled {
+		return nil, nil, model.ErrTransactionCanceled
+	}
+	if existing.GameAmount != amount {
+		return nil, nil, model.ErrIdempotencyConflict
+	}
+
+	switch existing.Status {
+	case model.TransactionStatusPending:
+		return nil, nil, model.ErrTransactionInProgress
+	case model.TransactionStatusFailed:
+		return existing, nil, nil
+	default:
+		return nil, transactionResponse(existing), nil
+	}
+}
+
+// convert converts amount into the wallet currency. A failed transaction retried under the same
+// reference keeps the amount and rate it was first quoted at.
+func (s *TransactionService) convert(ctx context.Context, previous *model.Transaction, amount model.Money, currency string, txType model.TransactionType) (model.Money, *model.Rate, error) {
+	if previous != nil {
+		return previous.Amount, previous.ExchangeRate, nil
+	}
+	return s.exchange.Convert(ctx, amount, currency, txType)
+}
+
+// startTransaction records a new pending transaction, or moves a previously failed one with the
+// same reference back to pending so the wallet call can be retried with its original amounts.
+func (s *TransactionService) startTransaction(ctx context.Context, txRepo port.TransactionRepository, previous *model.Transaction, transaction *model.Transaction) (*model.Transaction, error) {
+	transaction.Status = model.TransactionStatusPending
+	transaction.BalanceAfter = transaction.BalanceBefore
+	if previous == nil {
+		if err := txRepo.Create(ctx, transaction); err != nil {
+			if errors.Is(err, model.ErrDuplicateTransaction) {
+				return nil, model.ErrTransactionInProgress
+			}
+			return nil, err
+		}
+		return transaction, nil
+	}
+
+	s.logger.Infof("Retrying failed transaction: transaction_id=%s, reference=%s", previous.ID.String(), previous.Reference)
+	previous.Status = model.TransactionStatusPending
+	previous.BalanceBefore = transaction.BalanceBefore
+	previous.BalanceAfter = transaction.BalanceBefore
+	previous.FailureReason = ""
+	if err := s.updateTransaction(ctx, txRepo, previous, model.TransactionStatusFailed); err != nil {
 		return nil, err
 	}
+	return previous, nil
+}
 
-	newBalance := oldBalance
-	user, err = s.userRepo.GetByID(ctx, userID)
-	if err == nil {
-		newBalance = user.Balance
+// transactionResponse builds the provider facing response for a transaction from the balances
+// stored with it. Deposits report the bet outcome (WON/LOST), withdraws report COMPLETED,
+// rollbacks ROLLED_BACK and canceled transactions CANCELED.
+func transactionResponse(transaction *model.Transaction) *model.TransactionResponse {
+	status := "COMPLETED"
+	switch {
+	case transaction.Status == model.TransactionStatusCanceled:
+		status = "CANCELED"
+	case transaction.Type == model.TransactionTypeRollback:
+		status = "ROLLED_BACK"
+	case transaction.Type == model.TransactionTypeDeposit && transaction.Amount.IsPositive():
+		status = "WON"
+	case transaction.Type == model.TransactionTypeDeposit:
+		status = "LOST"
 	}
 
-	s.logger.Infof("CancelTransaction successful: transaction_id=%s canceled by user_id=%s", transactionID.String(), userID.String())
 	return &model.TransactionResponse{
 		TransactionID:         transaction.ID.String(),
 		ProviderTransactionID: transaction.Reference,
-		OldBalance:            oldBalance,
-		NewBalance:            newBalance,
-		Status:                string(model.TransactionStatusCanceled),
-	}, nil
-}
-
-func (s *TransactionService) getWalletUserID(ctx context.Context, userID uuid.UUID) (int, error) {
-	user, err := s.userRepo.GetByID(ctx, userID)
-	if err != nil {
-		return 0, err
+		OldBalance:            transaction.BalanceBefore,
+		NewBalance:            transaction.BalanceAfter,
+		Status:                status,
 	}
-	return user.WalletUserID, nil
 }
@@ -0,0 +1,371 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"kentech-project/internal/adapters/lock"
+	"kentech-project/internal/adapters/repository/memory"
+	"kentech-project/internal/adapters/repository/wallet"
+	"kentech-project/internal/adapters/repository/wallet/fakewallet"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/pkg/logger"
+
+	"github.com/google/uuid"
+)
+
+const testAPIKey = "test-key"
+
+// stubRates serves one rate per pair, which the test can change.
+type stubRates struct {
+	mu    sync.Mutex
+	rates map[string]model.Rate
+}
+
+func (r *stubRates) set(t *testing.T, base, quote, rate string) {
+	t.Helper()
+	parsed, err := model.ParseRate(rate)
+	if err != nil {
+		t.Fatalf("parse rate %s: %v", rate, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rates[base+quote] = parsed
+}
+
+func (r *stubRates) GetRate(ctx context.Context, base, quote string) (*model.ExchangeRate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rate, ok := r.rates[base+quote]
+	if !ok {
+		return nil, model.ErrExchangeRateNotFound
+	}
+	return &model.ExchangeRate{Base: base, Quote: quote, Rate: rate, UpdatedAt: time.Now()}, nil
+}
+
+// opWallet is a wallet of one account that replays an operation repeating the kind and reference of
+// an earlier one.
+type opWallet struct {
+	mu         sync.Mutex
+	balance    model.Money
+	operations map[string]wallet.OperationResponse
+}
+
+func (w *opWallet) operate(kind string, amount model.Money, reference string) (wallet.OperationResponse, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key := kind + " " + reference
+	if response, ok := w.operations[key]; ok {
+		return response, nil
+	}
+	if kind == "withdraw" {
+		amount = amount.Neg()
+	}
+	balance, err := w.balance.Add(amount)
+	if err != nil {
+		return wallet.OperationResponse{}, err
+	}
+	w.balance = balance
+	response := wallet.OperationResponse{
+		Balance:      balance.String(),
+		Transactions: []wallet.OperationResponseTransaction{{ID: len(w.operations) + 1, Reference: reference}},
+	}
+	w.operations[key] = response
+	return response, nil
+}
+
+func (w *opWallet) ProcessDeposit(ctx context.Context, userID int, amount model.Money, betID int, reference string) (wallet.OperationResponse, error) {
+	return w.operate("deposit", amount, reference)
+}
+
+func (w *opWallet) ProcessWithdraw(ctx context.Context, userID int, amount model.Money, betID int, reference string) (wallet.OperationResponse, error) {
+	return w.operate("withdraw", amount, reference)
+}
+
+func (w *opWallet) GetBalance(ctx context.Context, userID int) (model.Money, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.balance, nil
+}
+
+// newPlayer registers a USD player on wallet user 1 with a synced balance.
+func newPlayer(t *testing.T, store *memory.Store, balance string) *model.User {
+	t.Helper()
+	ctx := context.Background()
+	user := &model.User{WalletUserID: 1, Username: "player", Email: "player@example.com", Password: "x", Currency: "USD"}
+	if err := store.Users.Create(ctx, user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := store.Users.UpdateBalance(ctx, user.ID, usd(t, balance), time.Now()); err != nil {
+		t.Fatalf("update balance: %v", err)
+	}
+	return user
+}
+
+// fakeWalletFixture runs the transaction service against the fake wallet, whose account 1 holds
+// the balance of the player.
+type fakeWalletFixture struct {
+	store        *memory.Store
+	wallet       *fakewallet.Server
+	rates        *stubRates
+	transactions *TransactionService
+	user         *model.User
+}
+
+func newFakeWalletFixture(t *testing.T, policy wallet.RetryPolicy) *fakeWalletFixture {
+	t.Helper()
+	log := logger.New()
+	store := memory.NewStore(log)
+	rates := &stubRates{rates: make(map[string]model.Rate)}
+
+	fake := fakewallet.NewServer(testAPIKey, fakewallet.DuplicateReplay, log)
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	policy.AttemptTimeout = time.Second
+	client := wallet.NewWalletClient(srv.URL, log, testAPIKey, policy)
+
+	fake.SetBalance(1, usd(t, "100.00"))
+	return &fakeWalletFixture{
+		store:  store,
+		wallet: fake,
+		rates:  rates,
+		transactions: NewTransactionService(store.Users, store.Transactions, store.Bets, client,
+			NewExchangeService(rates, 0, log), store, lock.NewLocalLocker(log), log),
+		user: newPlayer(t, store, "100.00"),
+	}
+}
+
+func (f *fakeWalletFixture) transaction(t *testing.T, txType model.TransactionType, reference string) *model.Transaction {
+	t.Helper()
+	transaction, err := f.store.Transactions.GetByReference(context.Background(), f.user.ID, txType, reference)
+	if err != nil {
+		t.Fatalf("get %s %s: %v", txType, reference, err)
+	}
+	return transaction
+}
+
+func (f *fakeWalletFixture) bet(t *testing.T, reference string) *model.Bet {
+	t.Helper()
+	bet, err := f.store.Bets.GetByProviderBetID(context.Background(), f.user.ID, reference)
+	if err != nil {
+		t.Fatalf("get bet %s: %v", reference, err)
+	}
+	return bet
+}
+
+func (f *fakeWalletFixture) walletBalance(t *testing.T) model.Money {
+	t.Helper()
+	balance, _ := f.wallet.Balance(1)
+	return balance
+}
+
+func TestRollbacksOfASharedReference(t *testing.T) {
+	ctx := context.Background()
+	log := logger.New()
+	store := memory.NewStore(log)
+	stub := &opWallet{balance: usd(t, "100.00"), operations: make(map[string]wallet.OperationResponse)}
+	transactions := NewTransactionService(store.Users, store.Transactions, store.Bets, stub,
+		NewExchangeService(nil, 0, log), store, lock.NewLocalLocker(log), log)
+	user := newPlayer(t, store, "100.00")
+
+	// a withdraw and the deposit settling its bet carry the same provider transaction ID
+	bet, err := transactions.Withdraw(ctx, user.ID, usd(t, "10.00"), "round-1")
+	if err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	win, err := transactions.Deposit(ctx, user.ID, usd(t, "25.00"), "round-1", "round-1")
+	if err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+
+	rollbacks := make(map[uuid.UUID]string)
+	for _, tt := range []struct {
+		original *model.TransactionResponse
+		balance  string
+	}{{win, "90.00"}, {bet, "100.00"}} {
+		originalID := uuid.MustParse(tt.original.TransactionID)
+		rollback, err := transactions.CancelTransaction(ctx, user.ID, originalID)
+		if err != nil {
+			t.Fatalf("cancel %s: %v", originalID, err)
+		}
+		if rollback.NewBalance == nil || *rollback.NewBalance != usd(t, tt.balance) {
+			t.Fatalf("cancel %s: new balance = %v, want %s", originalID, rollback.NewBalance, tt.balance)
+		}
+		rollbacks[originalID] = rollback.TransactionID
+	}
+	winID, betID := uuid.MustParse(win.TransactionID), uuid.MustParse(bet.TransactionID)
+	if rollbacks[winID] == rollbacks[betID] {
+		t.Fatalf("the deposit and the withdraw were rolled back by the same transaction %s", rollbacks[winID])
+	}
+
+	replay, err := transactions.CancelTransaction(ctx, user.ID, winID)
+	if err != nil || replay.TransactionID != rollbacks[winID] {
+		t.Fatalf("replayed cancel = %+v, %v, want rollback %s", replay, err, rollbacks[winID])
+	}
+
+	for originalID, rollbackID := range rollbacks {
+		details, err := transactions.GetTransaction(ctx, user.ID, originalID)
+		if err != nil {
+			t.Fatalf("get %s: %v", originalID, err)
+		}
+		if details.Rollback == nil || details.Rollback.ID.String() != rollbackID {
+			t.Errorf("rollback of %s = %+v, want %s", originalID, details.Rollback, rollbackID)
+		}
+	}
+	if balance, _ := stub.GetBalance(ctx, 1); balance != usd(t, "100.00") {
+		t.Fatalf("wallet balance = %s, want 100.00", balance)
+	}
+}
+
+func TestCancelByReferenceNeedsTheTypeOfASharedReference(t *testing.T) {
+	ctx := context.Background()
+	log := logger.New()
+	store := memory.NewStore(log)
+	stub := &opWallet{balance: usd(t, "100.00"), operations: make(map[string]wallet.OperationResponse)}
+	transactions := NewTransactionService(store.Users, store.Transactions, store.Bets, stub,
+		NewExchangeService(nil, 0, log), store, lock.NewLocalLocker(log), log)
+	user := newPlayer(t, store, "100.00")
+
+	if _, err := transactions.Withdraw(ctx, user.ID, usd(t, "10.00"), "round-1"); err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	win, err := transactions.Deposit(ctx, user.ID, usd(t, "25.00"), "round-1", "round-1")
+	if err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+
+	if _, err := transactions.CancelByReference(ctx, user.ID, "", "round-1"); !errors.Is(err, model.ErrAmbiguousReference) {
+		t.Fatalf("cancel without a type: err = %v, want %v", err, model.ErrAmbiguousReference)
+	}
+	if balance, _ := stub.GetBalance(ctx, 1); balance != usd(t, "115.00") {
+		t.Fatalf("wallet balance after the refused cancel = %s, want 115.00", balance)
+	}
+
+	rollback, err := transactions.CancelByReference(ctx, user.ID, model.TransactionTypeDeposit, "round-1")
+	if err != nil {
+		t.Fatalf("cancel the deposit: %v", err)
+	}
+	if rollback.Status != "ROLLED_BACK" || rollback.NewBalance == nil || *rollback.NewBalance != usd(t, "90.00") {
+		t.Fatalf("cancel the deposit = %+v, want a rollback to 90.00", rollback)
+	}
+	details, err := transactions.GetTransaction(ctx, user.ID, uuid.MustParse(win.TransactionID))
+	if err != nil {
+		t.Fatalf("get deposit: %v", err)
+	}
+	if details.Status != model.TransactionStatusRolledBack {
+		t.Fatalf("deposit status = %s, want %s", details.Status, model.TransactionStatusRolledBack)
+	}
+}
+
+func TestRetriedTransactionKeepsItsQuote(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeWalletFixture(t, wallet.RetryPolicy{MaxAttempts: 1})
+	f.rates.set(t, "EUR", "USD", "1.10")
+	amount, err := model.ParseMoney("10.00", "EUR")
+	if err != nil {
+		t.Fatalf("parse amount: %v", err)
+	}
+
+	// the wallet refuses the first attempt, the retry comes after the rate moved
+	f.wallet.SetBalance(1, usd(t, "5.00"))
+	var walletErr *wallet.WalletError
+	if _, err := f.transactions.Withdraw(ctx, f.user.ID, amount, "bet-1"); !errors.As(err, &walletErr) || !walletErr.Rejected() {
+		t.Fatalf("first withdraw: err = %v, want a wallet rejection", err)
+	}
+	f.rates.set(t, "EUR", "USD", "1.20")
+	f.wallet.SetBalance(1, usd(t, "100.00"))
+	response, err := f.transactions.Withdraw(ctx, f.user.ID, amount, "bet-1")
+	if err != nil {
+		t.Fatalf("retried withdraw: %v", err)
+	}
+
+	transaction := f.transaction(t, model.TransactionTypeWithdraw, "bet-1")
+	if transaction.Status != model.TransactionStatusCompleted || transaction.Amount != usd(t, "11.00") ||
+		transaction.ExchangeRate == nil || transaction.ExchangeRate.String() != "1.1" {
+		t.Fatalf("transaction = %s %s at rate %v, want completed 11.00 at 1.1", transaction.Status, transaction.Amount, transaction.ExchangeRate)
+	}
+	if response.NewBalance == nil || *response.NewBalance != usd(t, "89.00") {
+		t.Fatalf("new balance = %v, want 89.00", response.NewBalance)
+	}
+}
+
+func TestRefusedResendLeavesTheTransactionPending(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeWalletFixture(t, wallet.RetryPolicy{MaxAttempts: 2, RetryableStatuses: []int{http.StatusServiceUnavailable}})
+
+	// the first send may have been applied, the 4xx answering the resend does not tell
+	f.wallet.Script(fakewallet.Outcome{Status: http.StatusServiceUnavailable}, fakewallet.Outcome{Status: http.StatusBadRequest})
+	var walletErr *wallet.WalletError
+	if _, err := f.transactions.Withdraw(ctx, f.user.ID, usd(t, "10.00"), "bet-1"); !errors.As(err, &walletErr) || walletErr.Rejected() {
+		t.Fatalf("withdraw: err = %v, want a refused resend", err)
+	}
+	transaction := f.transaction(t, model.TransactionTypeWithdraw, "bet-1")
+	if transaction.Status != model.TransactionStatusPending || transaction.FailureReason != "" {
+		t.Fatalf("withdraw = %s (%q), want pending", transaction.Status, transaction.FailureReason)
+	}
+	if bet := f.bet(t, "bet-1"); bet.Status != model.BetStatusOpen {
+		t.Fatalf("bet status = %s, want %s", bet.Status, model.BetStatusOpen)
+	}
+
+	if err := f.transactions.RecoverTransaction(ctx, transaction); err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	transaction = f.transaction(t, model.TransactionTypeWithdraw, "bet-1")
+	if transaction.Status != model.TransactionStatusCompleted || transaction.BalanceAfter == nil || *transaction.BalanceAfter != usd(t, "90.00") {
+		t.Fatalf("recovered withdraw = %s with balance after %v, want completed at 90.00", transaction.Status, transaction.BalanceAfter)
+	}
+	if balance := f.walletBalance(t); balance != usd(t, "90.00") {
+		t.Fatalf("wallet balance = %s, want 90.00", balance)
+	}
+}
+
+func TestCancelPendingDepositReopensTheBet(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeWalletFixture(t, wallet.RetryPolicy{MaxAttempts: 1})
+
+	if _, err := f.transactions.Withdraw(ctx, f.user.ID, usd(t, "10.00"), "bet-1"); err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	f.wallet.Script(fakewallet.Outcome{Status: http.StatusServiceUnavailable})
+	if _, err := f.transactions.Deposit(ctx, f.user.ID, usd(t, "25.00"), "win-1", "bet-1"); err == nil {
+		t.Fatal("deposit during an outage succeeded")
+	}
+	pending := f.transaction(t, model.TransactionTypeDeposit, "win-1")
+	if pending.Status != model.TransactionStatusPending {
+		t.Fatalf("deposit status = %s, want %s", pending.Status, model.TransactionStatusPending)
+	}
+	if _, err := f.transactions.Deposit(ctx, f.user.ID, usd(t, "5.00"), "win-2", "bet-1"); !errors.Is(err, model.ErrTransactionInProgress) {
+		t.Fatalf("second deposit on a claimed bet: err = %v, want %v", err, model.ErrTransactionInProgress)
+	}
+
+	// the pending deposit is applied by its recovery and rolled back
+	rollback, err := f.transactions.CancelTransaction(ctx, f.user.ID, pending.ID)
+	if err != nil {
+		t.Fatalf("cancel pending deposit: %v", err)
+	}
+	if rollback.NewBalance == nil || *rollback.NewBalance != usd(t, "90.00") {
+		t.Fatalf("cancel: new balance = %v, want 90.00", rollback.NewBalance)
+	}
+	if deposit := f.transaction(t, model.TransactionTypeDeposit, "win-1"); deposit.Status != model.TransactionStatusRolledBack {
+		t.Fatalf("deposit status = %s, want %s", deposit.Status, model.TransactionStatusRolledBack)
+	}
+	if bet := f.bet(t, "bet-1"); bet.Status != model.BetStatusOpen || bet.DepositTransactionID != nil {
+		t.Fatalf("bet = %s claimed by %v, want open and unclaimed", bet.Status, bet.DepositTransactionID)
+	}
+
+	if _, err := f.transactions.Deposit(ctx, f.user.ID, usd(t, "5.00"), "win-2", "bet-1"); err != nil {
+		t.Fatalf("deposit settling the reopened bet: %v", err)
+	}
+	bet := f.bet(t, "bet-1")
+	if bet.Status != model.BetStatusWon || bet.Payout != usd(t, "5.00") {
+		t.Fatalf("bet = %s paying %s, want %s paying 5.00", bet.Status, bet.Payout, model.BetStatusWon)
+	}
+	if balance := f.walletBalance(t); balance != usd(t, "95.00") {
+		t.Fatalf("wallet balance = %s, want 95.00", balance)
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/internal/core/port"
+	"kentech-project/pkg/logger"
+)
+
+// WalletAccountService manages the registry of wallet accounts handed out to players on registration.
+type WalletAccountService struct {
+	accountRepo port.WalletAccountRepository
+	logger      *logger.Logger
+}
+
+func NewWalletAccountService(accountRepo port.WalletAccountRepository, log *logger.Logger) *WalletAccountService {
+	return &WalletAccountService{
+		accountRepo: accountRepo,
+		logger:      log,
+	}
+}
+
+// Import registers wallet accounts as available. Accounts already registered are skipped, so the same
+// list can be imported again.
+func (s *WalletAccountService) Import(ctx context.Context, accounts []model.WalletAccountRequest) (*model.ImportWalletAccountsResponse, error) {
+	s.logger.Debugf("Import called: %d wallet accounts", len(accounts))
+
+	for _, account := range accounts {
+		if account.WalletUserID <= 0 {
+			s.logger.Warnf("Import failed: invalid wallet user id %d", account.WalletUserID)
+			return nil, model.ErrInvalidWalletAccount
+		}
+		if _, err := model.CurrencyExponent(account.Currency); err != nil {
+			s.logger.Warnf("Import failed: unknown currency %s for wallet_user_id=%d", account.Currency, account.WalletUserID)
+			return nil, err
+		}
+	}
+
+	response := &model.ImportWalletAccountsResponse{}
+	for _, account := range accounts {
+		err := s.accountRepo.Add(ctx, &model.WalletAccount{
+			WalletUserID: account.WalletUserID,
+			Currency:     account.Currency,
+		})
+		if errors.Is(err, model.ErrWalletAccountExists) {
+			response.Skipped++
+			continue
+		}
+		if err != nil {
+			s.logger.Error("Import failed: " + err.Error())
+			return nil, err
+		}
+		response.Imported++
+	}
+
+	s.logger.Infof("Import successful: imported=%d, skipped=%d", response.Imported, response.Skipped)
+	return response, nil
+}
+
+func (s *WalletAccountService) List(ctx context.Context) ([]*model.WalletAccount, error) {
+	s.logger.Debug("List wallet accounts called")
+
+	accounts, err := s.accountRepo.List(ctx)
+	if err != nil {
+		s.logger.Warnf("List wallet accounts failed: %s", err.Error())
+		return nil, err
+	}
+	return accounts, nil
+}
@@ -0,0 +1,17 @@
+package port
+
+import (
+	"context"
+	"kentech-project/internal/core/domain/model"
+
+	"github.com/google/uuid"
+)
+
+type BetRepository interface {
+	Create(ctx context.Context, bet *model.Bet) error
+	GetByID(ctx context.Context, id uuid.UUID) (*model.Bet, error)
+	GetByProviderBetID(ctx context.Context, userID uuid.UUID, providerBetID string) (*model.Bet, error)
+	// GetByTransactionID returns the bet placed or settled by the given transaction.
+	GetByTransactionID(ctx context.Context, transactionID uuid.UUID) (*model.Bet, error)
+	Update(ctx context.Context, bet *model.Bet) error
+}
@@ -0,0 +1,21 @@
+package port
+
+import (
+	"context"
+	"kentech-project/internal/core/domain/model"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LedgerRepository interface {
+	// Account returns the account of a type and currency, owned by userID or a system account when it
+	// is nil, creating it on first use. Inside a unit of work the account stays locked until it ends.
+	Account(ctx context.Context, userID *uuid.UUID, accountType model.LedgerAccountType, currency string) (*model.LedgerAccount, error)
+	// Post appends a validated entry and sets the balance after the lines of player accounts. System
+	// accounts are not updated, so postings of different players do not contend on them.
+	Post(ctx context.Context, entry *model.JournalEntry) error
+	// BalanceAt rebuilds the balance of the player account of a user in currency as it was at the
+	// given time, zero before the first entry.
+	BalanceAt(ctx context.Context, userID uuid.UUID, currency string, at time.Time) (model.Money, error)
+}
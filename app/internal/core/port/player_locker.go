@@ -0,0 +1,14 @@
+package port
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// PlayerLocker serialises the operations changing the balance of a player, from the balance check
+// to the update of the stored balance.
+type PlayerLocker interface {
+	// Lock blocks until the player is locked or ctx is done. The returned function releases the lock.
+	Lock(ctx context.Context, userID uuid.UUID) (unlock func(), err error)
+}
@@ -0,0 +1,45 @@
+package porttest
+
+import (
+	"context"
+	"fmt"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/internal/core/port"
+	"testing"
+)
+
+// MaxWalletUserID is the highest wallet user ID the suites create users with, IDs from 1 to
+// MaxWalletUserID must be usable by the repositories of a Factory.
+const MaxWalletUserID = 10
+
+// Factory returns empty repositories for one test. The suites only use the user and transaction
+// repositories.
+type Factory func(t *testing.T) port.Repositories
+
+func newUser(walletUserID int) *model.User {
+	return &model.User{
+		WalletUserID: walletUserID,
+		Username:     fmt.Sprintf("player%d", walletUserID),
+		Email:        fmt.Sprintf("player%d@example.com", walletUserID),
+		Password:     "hashed-password",
+		Currency:     "USD",
+	}
+}
+
+func createUser(t *testing.T, repos port.Repositories, walletUserID int) *model.User {
+	t.Helper()
+	user := newUser(walletUserID)
+	if err := repos.Users.Create(context.Background(), user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func usd(t *testing.T, amount string) model.Money {
+	t.Helper()
+	money, err := model.ParseMoney(amount, "USD")
+	if err != nil {
+		t.Fatalf("parse %s: %v", amount, err)
+	}
+	return money
+}
@@ -0,0 +1,440 @@
+package porttest
+
+import (
+	"context"
+	"errors"
+	"kentech-project/internal/core/domain/model"
+	"kentech-project/internal/core/port"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newTransaction(t *testing.T, user *model.User, txType model.TransactionType, status model.TransactionStatus, reference, amount string) *model.Transaction {
+	t.Helper()
+	money := usd(t, amount)
+	balance := usd(t, "100")
+	return &model.Transaction{
+		UserID:        user.ID,
+		Type:          txType,
+		Amount:        money,
+		Currency:      "USD",
+		Status:        status,
+		Reference:     reference,
+		BalanceBefore: &balance,
+		BalanceAfter:  &balance,
+		GameAmount:    money,
+		GameCurrency:  "USD",
+	}
+}
+
+func createTransaction(t *testing.T, repos port.Repositories, transaction *model.Transaction) *model.Transaction {
+	t.Helper()
+	if err := repos.Transactions.Create(context.Background(), transaction); err != nil {
+		t.Fatalf("create transaction: %v", err)
+	}
+	// keeps the creation times apart, they are stored with microseconds
+	time.Sleep(2 * time.Millisecond)
+	return transaction
+}
+
+func transactionIDs(transactions []*model.Transaction) []uuid.UUID {
+	ids := make([]uuid.UUID, len(transactions))
+	for i, transaction := range transactions {
+		ids[i] = transaction.ID
+	}
+	return ids
+}
+
+func assertTransactions(t *testing.T, name string, got []*model.Transaction, want ...*model.Transaction) {
+	t.Helper()
+	gotIDs, wantIDs := transactionIDs(got), transactionIDs(want)
+	if len(gotIDs) != len(wantIDs) {
+		t.Fatalf("%s: got %v, want %v", name, gotIDs, wantIDs)
+	}
+	for i := range gotIDs {
+		if gotIDs[i] != wantIDs[i] {
+			t.Fatalf("%s: got %v, want %v", name, gotIDs, wantIDs)
+		}
+	}
+}
+
+// TestTransactionRepository checks that the transaction repository of newRepos behaves as
+// port.TransactionRepository requires.
+func TestTransactionRepository(t *testing.T, newRepos Factory) {
+	ctx := context.Background()
+
+	t.Run("create and get", func(t *testing.T) {
+		repos := newRepos(t)
+		user := createUser(t, repos, 1)
+		withdraw := newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusCompleted, "bet-1", "10.5")
+		rate, _ := model.ParseRate("1.085")
+		withdraw.GameAmount, _ = model.ParseMoney("9.68", "EUR")
+		withdraw.GameCurrency = "EUR"
+		withdraw.ExchangeRate = &rate
+		walletID := 42
+		withdraw.WalletTransactionID = &walletID
+		balanceAfter := usd(t, "89.5")
+		withdraw.BalanceAfter = &balanceAfter
+		createTransaction(t, repos, withdraw)
+		if withdraw.ID == uuid.Nil || withdraw.CreatedAt.IsZero() || withdraw.UpdatedAt.IsZero() {
+			t.Fatalf("create did not set the ID and timestamps: %+v", withdraw)
+		}
+
+		rollback := newTransaction(t, user, model.TransactionTypeRollback, model.TransactionStatusFailed, "bet-1", "10.5")
+		rollback.OriginalTransactionID = &withdraw.ID
+		rollback.FailureReason = "wallet error"
+		createTransaction(t, repos, rollback)
+
+		got, err := repos.Transactions.GetByID(ctx, withdraw.ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if got.UserID != user.ID || got.Type != withdraw.Type || got.Amount != withdraw.Amount ||
+			got.Currency != "USD" || got.Status != withdraw.Status || got.Reference != "bet-1" ||
+			*got.BalanceBefore != *withdraw.BalanceBefore || *got.BalanceAfter != *withdraw.BalanceAfter ||
+			got.GameAmount != withdraw.GameAmount || got.GameCurrency != "EUR" ||
+			got.ExchangeRate == nil || got.ExchangeRate.String() != rate.String() ||
+			got.WalletTransactionID == nil || *got.WalletTransactionID != 42 ||
+			got.OriginalTransactionID != nil || got.FailureReason != "" {
+			t.Fatalf("get = %+v, want %+v", got, withdraw)
+		}
+
+		got, err = repos.Transactions.GetRollback(ctx, withdraw.ID)
+		if err != nil {
+			t.Fatalf("get rollback: %v", err)
+		}
+		if got.ID != rollback.ID || got.OriginalTransactionID == nil || *got.OriginalTransactionID != withdraw.ID ||
+			got.FailureReason != "wallet error" || got.ExchangeRate != nil || got.WalletTransactionID != nil {
+			t.Fatalf("get rollback = %+v, want %+v", got, rollback)
+		}
+	})
+
+	t.Run("balances may be unknown", func(t *testing.T) {
+		repos := newRepos(t)
+		user := createUser(t, repos, 1)
+		transaction := newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusCompleted, "bet-1", "1")
+		transaction.BalanceBefore, transaction.BalanceAfter = nil, nil
+		createTransaction(t, repos, transaction)
+
+		got, err := repos.Transactions.GetByID(ctx, transaction.ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if got.BalanceBefore != nil || got.BalanceAfter != nil {
+			t.Fatalf("balances = %v, %v, want none", got.BalanceBefore, got.BalanceAfter)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repos := newRepos(t)
+		user := createUser(t, repos, 1)
+		createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusCompleted, "bet-1", "1"))
+
+		if _, err := repos.Transactions.GetByID(ctx, uuid.New()); !errors.Is(err, model.ErrTransactionNotFound) {
+			t.Errorf("get by id: err = %v, want %v", err, model.ErrTransactionNotFound)
+		}
+		if _, err := repos.Transactions.GetByReference(ctx, user.ID, model.TransactionTypeDeposit, "bet-1"); !errors.Is(err, model.ErrTransactionNotFound) {
+			t.Errorf("get by reference of another type: err = %v, want %v", err, model.ErrTransactionNotFound)
+		}
+		if _, err := repos.Transactions.GetByReference(ctx, uuid.New(), model.TransactionTypeWithdraw, "bet-1"); !errors.Is(err, model.ErrTransactionNotFound) {
+			t.Errorf("get by reference of another user: err = %v, want %v", err, model.ErrTransactionNotFound)
+		}
+	})
+
+	t.Run("duplicate reference", func(t *testing.T) {
+		repos := newRepos(t)
+		user := createUser(t, repos, 1)
+		other := createUser(t, repos, 2)
+		createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusCompleted, "bet-1", "1"))
+
+		err := repos.Transactions.Create(ctx, newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusPending, "bet-1", "2"))
+		if !errors.Is(err, model.ErrDuplicateTransaction) {
+			t.Fatalf("duplicate: err = %v, want %v", err, model.ErrDuplicateTransaction)
+		}
+		// the reference is unique per user and type
+		createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeDeposit, model.TransactionStatusCompleted, "bet-1", "1"))
+		createTransaction(t, repos, newTransaction(t, other, model.TransactionTypeWithdraw, model.TransactionStatusCompleted, "bet-1", "1"))
+	})
+
+	t.Run("rollbacks are keyed on their original", func(t *testing.T) {
+		repos := newRepos(t)
+		user := createUser(t, repos, 1)
+		bet := createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusRolledBack, "bet-1", "10"))
+		win := createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeDeposit, model.TransactionStatusRolledBack, "bet-1", "25"))
+
+		rollbacks := make(map[uuid.UUID]*model.Transaction)
+		for _, original := range []*model.Transaction{bet, win} {
+			rollback := newTransaction(t, user, model.TransactionTypeRollback, model.TransactionStatusCompleted, "bet-1", original.Amount.String())
+			rollback.OriginalTransactionID = &original.ID
+			rollbacks[original.ID] = createTransaction(t, repos, rollback)
+		}
+
+		again := newTransaction(t, user, model.TransactionTypeRollback, model.TransactionStatusPending, "bet-1", "10")
+		again.OriginalTransactionID = &bet.ID
+		if err := repos.Transactions.Create(ctx, again); !errors.Is(err, model.ErrDuplicateTransaction) {
+			t.Fatalf("second rollback: err = %v, want %v", err, model.ErrDuplicateTransaction)
+		}
+		for originalID, want := range rollbacks {
+			got, err := repos.Transactions.GetRollback(ctx, originalID)
+			if err != nil {
+				t.Fatalf("get rollback of %s: %v", originalID, err)
+			}
+			if got.ID != want.ID {
+				t.Fatalf("get rollback of %s = %s, want %s", originalID, got.ID, want.ID)
+			}
+		}
+		if _, err := repos.Transactions.GetRollback(ctx, uuid.New()); !errors.Is(err, model.ErrTransactionNotFound) {
+			t.Fatalf("get rollback of an unknown transaction: err = %v, want %v", err, model.ErrTransactionNotFound)
+		}
+	})
+
+	t.Run("concurrent duplicates", func(t *testing.T) {
+		repos := newRepos(t)
+		user := createUser(t, repos, 1)
+
+		const attempts = 10
+		errs := make(chan error, attempts)
+		var wg sync.WaitGroup
+		for i := 0; i < attempts; i++ {
+			transaction := newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusPending, "bet-1", "1")
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- repos.Transactions.Create(ctx, transaction)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		created := 0
+		for err := range errs {
+			switch {
+			case err == nil:
+				created++
+			case !errors.Is(err, model.ErrDuplicateTransaction):
+				t.Fatalf("create: err = %v, want nil or %v", err, model.ErrDuplicateTransaction)
+			}
+		}
+		if created != 1 {
+			t.Fatalf("created %d transactions with the same reference, want 1", created)
+		}
+	})
+
+	t.Run("history is newest first", func(t *testing.T) {
+		repos := newRepos(t)
+		user := createUser(t, repos, 1)
+		other := createUser(t, repos, 2)
+		empty := createUser(t, repos, 3)
+
+		first := createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusCompleted, "bet-1", "1"))
+		createTransaction(t, repos, newTransaction(t, other, model.TransactionTypeWithdraw, model.TransactionStatusCompleted, "bet-1", "1"))
+		second := createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeDeposit, model.TransactionStatusCompleted, "bet-1", "2"))
+		third := createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusCompleted, "bet-2", "3"))
+
+		got, err := repos.Transactions.GetByUserID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("get by user: %v", err)
+		}
+		assertTransactions(t, "get by user", got, third, second, first)
+
+		got, err = repos.Transactions.GetByUserID(ctx, empty.ID)
+		if err != nil || len(got) != 0 {
+			t.Fatalf("get by user without transactions = %v, %v", got, err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		repos := newRepos(t)
+		user := createUser(t, repos, 1)
+		other := createUser(t, repos, 2)
+
+		bet := createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusCompleted, "bet-1", "10"))
+		win := createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeDeposit, model.TransactionStatusCompleted, "bet-1", "25"))
+		failed := createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusFailed, "bet-2", "5"))
+		rollback := createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeRollback, model.TransactionStatusCompleted, "bet-1", "10"))
+		createTransaction(t, repos, newTransaction(t, other, model.TransactionTypeWithdraw, model.TransactionStatusCompleted, "bet-1", "10"))
+
+		// the stored creation times, which may be less precise than the ones set by Create
+		all, err := repos.Transactions.GetByUserID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("get by user: %v", err)
+		}
+		assertTransactions(t, "get by user", all, rollback, failed, win, bet)
+		winCreatedAt, failedCreatedAt := all[2].CreatedAt, all[1].CreatedAt
+
+		minAmount, maxAmount := usd(t, "10"), usd(t, "9.99")
+		tests := []struct {
+			name   string
+			filter model.TransactionFilter
+			want   []*model.Transaction
+		}{
+			{"no filter", model.TransactionFilter{}, []*model.Transaction{rollback, failed, win, bet}},
+			{"types", model.TransactionFilter{Types: []model.TransactionType{model.TransactionTypeWithdraw, model.TransactionTypeRollback}}, []*model.Transaction{rollback, failed, bet}},
+			{"statuses", model.TransactionFilter{Statuses: []model.TransactionStatus{model.TransactionStatusFailed}}, []*model.Transaction{failed}},
+			{"reference", model.TransactionFilter{Reference: "bet-1"}, []*model.Transaction{rollback, win, bet}},
+			{"min amount", model.TransactionFilter{MinAmount: &minAmount}, []*model.Transaction{rollback, win, bet}},
+			{"max amount", model.TransactionFilter{MaxAmount: &maxAmount}, []*model.Transaction{failed}},
+			{"from is inclusive", model.TransactionFilter{From: &winCreatedAt}, []*model.Transaction{rollback, failed, win}},
+			{"to is exclusive", model.TransactionFilter{To: &failedCreatedAt}, []*model.Transaction{win, bet}},
+			{"combined", model.TransactionFilter{Types: []model.TransactionType{model.TransactionTypeWithdraw}, From: &winCreatedAt}, []*model.Transaction{failed}},
+		}
+		for _, tt := range tests {
+			tt.filter.UserID = user.ID
+			got, err := repos.Transactions.List(ctx, tt.filter, nil, 10)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			assertTransactions(t, tt.name, got, tt.want...)
+		}
+
+		// paging through the history returns every transaction once
+		var paged []*model.Transaction
+		var after *model.TransactionCursor
+		for page := 0; ; page++ {
+			if page > len(all) {
+				t.Fatal("paging does not end")
+			}
+			got, err := repos.Transactions.List(ctx, model.TransactionFilter{UserID: user.ID}, after, 3)
+			if err != nil {
+				t.Fatalf("page %d: %v", page, err)
+			}
+			if len(got) == 0 {
+				break
+			}
+			paged = append(paged, got...)
+			last := got[len(got)-1]
+			after = &model.TransactionCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+		}
+		assertTransactions(t, "paged", paged, rollback, failed, win, bet)
+	})
+
+	t.Run("stale pending", func(t *testing.T) {
+		repos := newRepos(t)
+		user := createUser(t, repos, 1)
+
+		first := createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusPending, "bet-1", "1"))
+		second := createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusPending, "bet-2", "1"))
+		createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusCompleted, "bet-3", "1"))
+		exhausted := newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusPending, "bet-4", "1")
+		exhausted.RecoveryAttempts = 3
+		createTransaction(t, repos, exhausted)
+
+		before := time.Now().Add(time.Second)
+		got, err := repos.Transactions.ListStalePending(ctx, before, 3, 10)
+		if err != nil {
+			t.Fatalf("list stale pending: %v", err)
+		}
+		assertTransactions(t, "stale pending", got, first, second)
+
+		got, _ = repos.Transactions.ListStalePending(ctx, before, 3, 1)
+		assertTransactions(t, "stale pending with a limit", got, first)
+
+		// updating a transaction makes it the most recent one
+		first.RecoveryAttempts++
+		if err := repos.Transactions.Update(ctx, first); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		got, _ = repos.Transactions.ListStalePending(ctx, before, 3, 10)
+		assertTransactions(t, "stale pending after an update", got, second, first)
+
+		got, _ = repos.Transactions.ListStalePending(ctx, time.Now().Add(-time.Hour), 3, 10)
+		assertTransactions(t, "stale pending before creation", got)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		repos := newRepos(t)
+		user := createUser(t, repos, 1)
+		transaction := createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusPending, "bet-1", "10"))
+
+		walletID := 7
+		transaction.Status = model.TransactionStatusCompleted
+		balanceAfter := usd(t, "90")
+		transaction.BalanceAfter = &balanceAfter
+		transaction.WalletTransactionID = &walletID
+		transaction.RecoveryAttempts = 2
+		if err := repos.Transactions.Update(ctx, transaction); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		got, err := repos.Transactions.GetByID(ctx, transaction.ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if got.Status != model.TransactionStatusCompleted || *got.BalanceAfter != usd(t, "90") ||
+			got.WalletTransactionID == nil || *got.WalletTransactionID != 7 || got.RecoveryAttempts != 2 ||
+			got.UserID != user.ID || !got.UpdatedAt.After(got.CreatedAt) {
+			t.Fatalf("updated transaction = %+v", got)
+		}
+
+		got.Status = model.TransactionStatusFailed
+		got.FailureReason = "insufficient funds"
+		if err := repos.Transactions.Update(ctx, got); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		if got, _ := repos.Transactions.GetByID(ctx, transaction.ID); got.FailureReason != "insufficient funds" {
+			t.Fatalf("failure reason = %q, want %q", got.FailureReason, "insufficient funds")
+		}
+	})
+
+	t.Run("stale update", func(t *testing.T) {
+		repos := newRepos(t)
+		user := createUser(t, repos, 1)
+		transaction := createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusPending, "bet-1", "10"))
+		stale, err := repos.Transactions.GetByID(ctx, transaction.ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+
+		transaction.Status = model.TransactionStatusCanceled
+		if err := repos.Transactions.Update(ctx, transaction); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		stale.RecoveryAttempts++
+		if err := repos.Transactions.Update(ctx, stale); !errors.Is(err, model.ErrConcurrentModification) {
+			t.Fatalf("update of a stale transaction: err = %v, want %v", err, model.ErrConcurrentModification)
+		}
+
+		current, err := repos.Transactions.GetByID(ctx, transaction.ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		current.Status = model.TransactionStatusRolledBack
+		if err := repos.Transactions.Update(ctx, current); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		transaction.FailureReason = "stale"
+		if err := repos.Transactions.Update(ctx, transaction); !errors.Is(err, model.ErrConcurrentModification) {
+			t.Fatalf("update of a transaction read before its status changed: err = %v, want %v", err, model.ErrConcurrentModification)
+		}
+
+		got, err := repos.Transactions.GetByID(ctx, transaction.ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if got.Status != model.TransactionStatusRolledBack || got.RecoveryAttempts != 0 || got.FailureReason != "" {
+			t.Fatalf("transaction after stale updates = %+v", got)
+		}
+		got.RecoveryAttempts++
+		if err := repos.Transactions.Update(ctx, got); err != nil {
+			t.Fatalf("update of the current transaction: %v", err)
+		}
+	})
+
+	t.Run("returned transactions are copies", func(t *testing.T) {
+		repos := newRepos(t)
+		user := createUser(t, repos, 1)
+		transaction := createTransaction(t, repos, newTransaction(t, user, model.TransactionTypeWithdraw, model.TransactionStatusPending, "bet-1", "10"))
+		transaction.Status = model.TransactionStatusFailed
+
+		got, err := repos.Transactions.GetByID(ctx, transaction.ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		got.Status = model.TransactionStatusCompleted
+		if again, _ := repos.Transactions.GetByID(ctx, transaction.ID); again.Status != model.TransactionStatusPending {
+			t.Fatalf("stored transaction changed without update: status %s", again.Status)
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package porttest
+
+import (
+	"context"
+	"errors"
+	"kentech-project/internal/core/domain/model"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestUserRepository checks that the user repository of newRepos behaves as port.UserRepository
+// requires.
+func TestUserRepository(t *testing.T, newRepos Factory) {
+	ctx := context.Background()
+
+	t.Run("create and get", func(t *testing.T) {
+		repos := newRepos(t)
+		user := createUser(t, repos, 1)
+		if user.ID == uuid.Nil || user.CreatedAt.IsZero() || user.UpdatedAt.IsZero() {
+			t.Fatalf("create did not set the ID and timestamps: %+v", user)
+		}
+		if !user.Balance.IsZero() || user.Balance.Currency() != "USD" {
+			t.Fatalf("balance = %s %s, want 0 USD", user.Balance, user.Balance.Currency())
+		}
+
+		lookups := map[string]func() (*model.User, error){
+			"id":       func() (*model.User, error) { return repos.Users.GetByID(ctx, user.ID) },
+			"username": func() (*model.User, error) { return repos.Users.GetByUsername(ctx, user.Username) },
+			"email":    func() (*model.User, error) { return repos.Users.GetByEmail(ctx, user.Email) },
+		}
+		for name, lookup := range lookups {
+			got, err := lookup()
+			if err != nil {
+				t.Fatalf("get by %s: %v", name, err)
+			}
+			if got.ID != user.ID || got.WalletUserID != 1 || got.Username != user.Username ||
+				got.Email != user.Email || got.Password != user.Password || got.Currency != "USD" ||
+				got.Balance != user.Balance || got.BalanceSyncedAt != nil {
+				t.Fatalf("get by %s = %+v, want %+v", name, got, user)
+			}
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repos := newRepos(t)
+		createUser(t, repos, 1)
+		if _, err := repos.Users.GetByID(ctx, uuid.New()); !errors.Is(err, model.ErrUserNotFound) {
+			t.Errorf("get by id: err = %v, want %v", err, model.ErrUserNotFound)
+		}
+		if _, err := repos.Users.GetByUsername(ctx, "nobody"); !errors.Is(err, model.ErrUserNotFound) {
+			t.Errorf("get by username: err = %v, want %v", err, model.ErrUserNotFound)
+		}
+		if _, err := repos.Users.GetByEmail(ctx, "nobody@example.com"); !errors.Is(err, model.ErrUserNotFound) {
+			t.Errorf("get by email: err = %v, want %v", err, model.ErrUserNotFound)
+		}
+	})
+
+	t.Run("unique", func(t *testing.T) {
+		repos := newRepos(t)
+		createUser(t, repos, 1)
+
+		tests := []struct {
+			name    string
+			user    *model.User
+			wantErr error
+		}{
+			{"username", &model.User{WalletUserID: 2, Username: "player1", Email: "other@example.com", Password: "x", Currency: "USD"}, model.ErrUserAlreadyExists},
+			{"email", &model.User{WalletUserID: 2, Username: "other", Email: "player1@example.com", Password: "x", Currency: "USD"}, model.ErrUserAlreadyExists},
+			{"wallet user id", &model.User{WalletUserID: 1, Username: "other", Email: "other@example.com", Password: "x", Currency: "USD"}, model.ErrWalletUserIDExhausted},
+		}
+		for _, tt := range tests {
+			if err := repos.Users.Create(ctx, tt.user); !errors.Is(err, tt.wantErr) {
+				t.Errorf("duplicate %s: err = %v, want %v", tt.name, err, tt.wantErr)
+			}
+		}
+
+		second := createUser(t, repos, 2)
+		second.Username = "player1"
+		if err := repos.Users.Update(ctx, second); !errors.Is(err, model.ErrUserAlreadyExists) {
+			t.Errorf("update to a duplicate username: err = %v, want %v", err, model.ErrUserAlreadyExists)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		repos := newRepos(t)
+		user := createUser(t, repos, 1)
+		user.Email = "renamed@example.com"
+		user.Balance = usd(t, "12.34")
+		if err := repos.Users.Update(ctx, user); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+
+		got, err := repos.Users.GetByEmail(ctx, "renamed@example.com")
+		if err != nil {
+			t.Fatalf("get by new email: %v", err)
+		}
+		if got.ID != user.ID || got.Balance != usd(t, "12.34") {
+			t.Fatalf("updated user = %+v", got)
+		}
+		if _, err := repos.Users.GetByEmail(ctx, "player1@example.com"); !errors.Is(err, model.ErrUserNotFound) {
+			t.Fatalf("get by old email: err = %v, want %v", err, model.ErrUserNotFound)
+		}
+	})
+
+	t.Run("update balance", func(t *testing.T) {
+		repos := newRepos(t)
+		user := createUser(t, repos, 1)
+		syncedAt := time.Now().UTC().Truncate(time.Millisecond)
+
+		if err := repos.Users.UpdateBalance(ctx, user.ID, usd(t, "20"), syncedAt); err != nil {
+			t.Fatalf("update balance: %v", err)
+		}
+		// an older read does not overwrite the balance
+		if err := repos.Users.UpdateBalance(ctx, user.ID, usd(t, "5"), syncedAt.Add(-time.Second)); err != nil {
+			t.Fatalf("update balance with an older read: %v", err)
+		}
+		got, err := repos.Users.GetByID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if got.Balance != usd(t, "20") || got.BalanceSyncedAt == nil || !got.BalanceSyncedAt.Equal(syncedAt) {
+			t.Fatalf("balance = %s synced at %v, want 20.00 synced at %s", got.Balance, got.BalanceSyncedAt, syncedAt)
+		}
+
+		if err := repos.Users.UpdateBalance(ctx, user.ID, usd(t, "30"), syncedAt.Add(time.Second)); err != nil {
+			t.Fatalf("update balance with a newer read: %v", err)
+		}
+		got, _ = repos.Users.GetByID(ctx, user.ID)
+		if got.Balance != usd(t, "30") {
+			t.Fatalf("balance = %s, want 30.00", got.Balance)
+		}
+
+		// updating the user keeps the time the balance was synced
+		got.Email = "renamed@example.com"
+		if err := repos.Users.Update(ctx, got); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		if got, _ := repos.Users.GetByID(ctx, user.ID); got.BalanceSyncedAt == nil {
+			t.Fatal("update cleared the balance sync time")
+		}
+	})
+
+	t.Run("stale update", func(t *testing.T) {
+		repos := newRepos(t)
+		user := createUser(t, repos, 1)
+		stale, err := repos.Users.GetByID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+
+		user.Email = "renamed@example.com"
+		if err := repos.Users.Update(ctx, user); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		stale.Username = "stale"
+		if err := repos.Users.Update(ctx, stale); !errors.Is(err, model.ErrConcurrentModification) {
+			t.Fatalf("update of a stale user: err = %v, want %v", err, model.ErrConcurrentModification)
+		}
+
+		// the balance written by the wallet is not overwritten by a user read before it
+		if err := repos.Users.UpdateBalance(ctx, user.ID, usd(t, "20"), time.Now()); err != nil {
+			t.Fatalf("update balance: %v", err)
+		}
+		user.Username = "renamed"
+		if err := repos.Users.Update(ctx, user); !errors.Is(err, model.ErrConcurrentModification) {
+			t.Fatalf("update of a user read before its balance changed: err = %v, want %v", err, model.ErrConcurrentModification)
+		}
+
+		got, err := repos.Users.GetByID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if got.Username != "player1" || got.Email != "renamed@example.com" || got.Balance != usd(t, "20") {
+			t.Fatalf("user after stale updates = %+v", got)
+		}
+		got.Username = "renamed"
+		if err := repos.Users.Update(ctx, got); err != nil {
+			t.Fatalf("update of the current user: %v", err)
+		}
+		if err := repos.Users.Update(ctx, got); err != nil {
+			t.Fatalf("second update of the same copy: %v", err)
+		}
+	})
+
+	t.Run("returned users are copies", func(t *testing.T) {
+		repos := newRepos(t)
+		user := createUser(t, repos, 1)
+		user.Username = "changed"
+		got, err := repos.Users.GetByID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		got.Email = "changed@example.com"
+		if again, _ := repos.Users.GetByID(ctx, user.ID); again.Username != "player1" || again.Email != "player1@example.com" {
+			t.Fatalf("stored user changed without update: %+v", again)
+		}
+	})
+}
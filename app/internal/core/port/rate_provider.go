@@ -0,0 +1,11 @@
+package port
+
+import (
+	"context"
+	"kentech-project/internal/core/domain/model"
+)
+
+type RateProvider interface {
+	// GetRate returns the rate converting base into quote, or model.ErrExchangeRateNotFound.
+	GetRate(ctx context.Context, base, quote string) (*model.ExchangeRate, error)
+}
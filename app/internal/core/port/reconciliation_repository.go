@@ -0,0 +1,26 @@
+package port
+
+import (
+	"context"
+	"kentech-project/internal/core/domain/model"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ReconciliationRepository interface {
+	// CreateRun records a new running run, model.ErrReconciliationInProgress if one is already running.
+	CreateRun(ctx context.Context, run *model.ReconciliationRun) error
+	UpdateRun(ctx context.Context, run *model.ReconciliationRun) error
+	// AbandonRuns fails the runs still running that started before the given time, left behind by a
+	// process that stopped during the run. It returns how many were abandoned.
+	AbandonRuns(ctx context.Context, before time.Time) (int, error)
+	GetRun(ctx context.Context, id uuid.UUID) (*model.ReconciliationRun, error)
+	// ListRuns returns the most recent runs first.
+	ListRuns(ctx context.Context, limit int) ([]*model.ReconciliationRun, error)
+	AddItem(ctx context.Context, item *model.ReconciliationItem) error
+	ListItems(ctx context.Context, runID uuid.UUID) ([]*model.ReconciliationItem, error)
+	// ListPlayerBalances returns the stored balance and the net amount of the completed transactions
+	// of up to limit players with an ID greater than after, ordered by ID.
+	ListPlayerBalances(ctx context.Context, after uuid.UUID, limit int) ([]*model.PlayerBalances, error)
+}
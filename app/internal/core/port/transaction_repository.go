@@ -3,6 +3,7 @@ package port
 import (
 	"context"
 	"kentech-project/internal/core/domain/model"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -11,6 +12,18 @@ type TransactionRepository interface {
 	Create(ctx context.Context, transaction *model.Transaction) error
 	GetByID(ctx context.Context, id uuid.UUID) (*model.Transaction, error)
 	GetByUserID(ctx context.Context, userID uuid.UUID) ([]*model.Transaction, error)
+	// List returns up to limit transactions matching filter, newest first, starting after the cursor
+	// when it is not nil.
+	List(ctx context.Context, filter model.TransactionFilter, after *model.TransactionCursor, limit int) ([]*model.Transaction, error)
+	// GetByReference returns the transaction of the given type that a user made with a provider transaction ID.
+	// Rollbacks share the reference of the transaction they reverse, they are found with GetRollback.
+	GetByReference(ctx context.Context, userID uuid.UUID, txType model.TransactionType, reference string) (*model.Transaction, error)
+	// GetRollback returns the rollback reversing the transaction originalID, there is at most one.
+	GetRollback(ctx context.Context, originalID uuid.UUID) (*model.Transaction, error)
+	// ListStalePending returns pending transactions not updated since before, that were re-driven
+	// less than maxAttempts times, oldest first.
+	ListStalePending(ctx context.Context, before time.Time, maxAttempts, limit int) ([]*model.Transaction, error)
+	// Update stores transaction if it is still at transaction.Version, and fails with
+	// model.ErrConcurrentModification when it was written since it was read.
 	Update(ctx context.Context, transaction *model.Transaction) error
-	UpdateStatus(ctx context.Context, id uuid.UUID, status model.TransactionStatus) error
 }
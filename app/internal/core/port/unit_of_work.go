@@ -0,0 +1,18 @@
+package port
+
+import "context"
+
+// Repositories groups the repositories bound to one unit of work.
+type Repositories struct {
+	Users          UserRepository
+	Transactions   TransactionRepository
+	Bets           BetRepository
+	WalletAccounts WalletAccountRepository
+	Ledger         LedgerRepository
+}
+
+type UnitOfWork interface {
+	// RunInTx runs fn with repositories sharing a single database transaction. The transaction is
+	// committed when fn returns nil and rolled back otherwise.
+	RunInTx(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) error
+}
@@ -3,6 +3,7 @@ package port
 import (
 	"context"
 	"kentech-project/internal/core/domain/model"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -12,6 +13,12 @@ type UserRepository interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*model.User, error)
 	GetByUsername(ctx context.Context, username string) (*model.User, error)
 	GetByEmail(ctx context.Context, email string) (*model.User, error)
+	// Update stores user if it is still at user.Version, and fails with model.ErrConcurrentModification
+	// when it was written since it was read.
 	Update(ctx context.Context, user *model.User) error
-	UpdateBalance(ctx context.Context, userID uuid.UUID, balance float64) error
+	// UpdateBalance stores the wallet balance read at syncedAt, unless a more recent one is already stored.
+	UpdateBalance(ctx context.Context, userID uuid.UUID, balance model.Money, syncedAt time.Time) error
+	// SetOpeningBalance records the wallet balance the user had before any of its transactions, which
+	// the reconciliation nets transactions from. Only the first opening balance recorded is kept.
+	SetOpeningBalance(ctx context.Context, userID uuid.UUID, balance model.Money) error
 }
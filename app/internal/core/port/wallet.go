@@ -3,10 +3,12 @@ package port
 import (
 	"context"
 	"kentech-project/internal/adapters/repository/wallet"
+	"kentech-project/internal/core/domain/model"
 )
 
 type WalletService interface {
-	ProcessDeposit(ctx context.Context, userID int, amount float64, currency string, betID int, reference string) (wallet.OperationResponse, error)
-	ProcessWithdraw(ctx context.Context, userID int, amount float64, currency string, betID int, reference string) (wallet.OperationResponse, error)
-	CancelTransaction(ctx context.Context, reference string) error
+	ProcessDeposit(ctx context.Context, userID int, amount model.Money, betID int, reference string) (wallet.OperationResponse, error)
+	ProcessWithdraw(ctx context.Context, userID int, amount model.Money, betID int, reference string) (wallet.OperationResponse, error)
+	// GetBalance returns the balance of a wallet account in the account currency.
+	GetBalance(ctx context.Context, userID int) (model.Money, error)
 }
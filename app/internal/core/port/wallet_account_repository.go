@@ -0,0 +1,15 @@
+package port
+
+import (
+	"context"
+	"kentech-project/internal/core/domain/model"
+)
+
+type WalletAccountRepository interface {
+	// Add registers an available account, model.ErrWalletAccountExists if it is already known.
+	Add(ctx context.Context, account *model.WalletAccount) error
+	// AssignNext marks the oldest available account as assigned and returns it, restricted to
+	// currency unless it is empty. It returns model.ErrWalletUserIDExhausted when none is left.
+	AssignNext(ctx context.Context, currency string) (*model.WalletAccount, error)
+	List(ctx context.Context) ([]*model.WalletAccount, error)
+}
@@ -0,0 +1,235 @@
+-- Initial schema. Tables and indexes are created only when missing, and the users and transactions tables
+-- of databases created by the former local-tools/init.sql are brought up to date: missing columns are added
+-- and their existing rows backfilled.
+
+-- wallet accounts registry, the wallet does not create accounts so they are imported and assigned on registration
+CREATE TABLE IF NOT EXISTS wallet_accounts (
+    wallet_user_id BIGINT PRIMARY KEY,
+    currency VARCHAR(3) NOT NULL,
+    assigned_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- users table
+CREATE TABLE IF NOT EXISTS users (
+    id UUID PRIMARY KEY,
+    wallet_user_id BIGINT UNIQUE NOT NULL REFERENCES wallet_accounts(wallet_user_id),
+    username VARCHAR(255) UNIQUE NOT NULL,
+    email VARCHAR(255) UNIQUE NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    balance NUMERIC(19,4) NOT NULL DEFAULT 0,
+    balance_synced_at TIMESTAMP,
+    opening_balance NUMERIC(19,4),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- users created by init.sql: the currency came from a fixed map of wallet accounts, and the accounts were
+-- not registered
+ALTER TABLE users ADD COLUMN IF NOT EXISTS currency VARCHAR(3);
+UPDATE users SET currency = CASE wallet_user_id
+    WHEN 34679664254 THEN 'EUR'
+    WHEN 34616761765 THEN 'KES'
+    ELSE 'USD'
+END WHERE currency IS NULL;
+ALTER TABLE users ALTER COLUMN currency SET NOT NULL;
+UPDATE users SET balance = 0 WHERE balance IS NULL;
+ALTER TABLE users ALTER COLUMN balance TYPE NUMERIC(19,4),
+    ALTER COLUMN balance SET NOT NULL,
+    ALTER COLUMN balance SET DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS balance_synced_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS opening_balance NUMERIC(19,4);
+INSERT INTO wallet_accounts (wallet_user_id, currency, assigned_at)
+SELECT wallet_user_id, currency, COALESCE(created_at, CURRENT_TIMESTAMP) FROM users
+ON CONFLICT (wallet_user_id) DO NOTHING;
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'users_wallet_user_id_fkey') THEN
+        ALTER TABLE users ADD CONSTRAINT users_wallet_user_id_fkey
+            FOREIGN KEY (wallet_user_id) REFERENCES wallet_accounts(wallet_user_id);
+    END IF;
+END $$;
+
+-- transactions table
+CREATE TABLE IF NOT EXISTS transactions (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    amount NUMERIC(19,4) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    reference VARCHAR(255) NOT NULL,
+    balance_before NUMERIC(19,4),
+    balance_after NUMERIC(19,4),
+    game_amount NUMERIC(19,4) NOT NULL,
+    game_currency VARCHAR(3) NOT NULL,
+    exchange_rate NUMERIC(20,10),
+    original_transaction_id UUID REFERENCES transactions(id),
+    wallet_transaction_id BIGINT,
+    failure_reason TEXT,
+    recovery_attempts INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- transactions created by init.sql were made in the currency of their player, without conversion. Their
+-- balances were not stored and stay empty.
+ALTER TABLE transactions ALTER COLUMN amount TYPE NUMERIC(19,4);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS currency VARCHAR(3);
+UPDATE transactions t SET currency = u.currency FROM users u WHERE t.user_id = u.id AND t.currency IS NULL;
+ALTER TABLE transactions ALTER COLUMN currency SET NOT NULL;
+UPDATE transactions SET reference = id::text WHERE reference IS NULL;
+ALTER TABLE transactions ALTER COLUMN reference SET NOT NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS balance_before NUMERIC(19,4);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS balance_after NUMERIC(19,4);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS game_amount NUMERIC(19,4);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS game_currency VARCHAR(3);
+UPDATE transactions SET game_amount = amount, game_currency = currency WHERE game_amount IS NULL;
+ALTER TABLE transactions ALTER COLUMN game_amount SET NOT NULL,
+    ALTER COLUMN game_currency SET NOT NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS exchange_rate NUMERIC(20,10);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS original_transaction_id UUID REFERENCES transactions(id);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS wallet_transaction_id BIGINT;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS failure_reason TEXT;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS recovery_attempts INT NOT NULL DEFAULT 0;
+
+-- init.sql did not make references unique: a provider transaction ID used more than once per user and type
+-- keeps its completed (or else oldest) transaction, the others are re-keyed with their ID so the idempotency
+-- index below can be created
+UPDATE transactions t SET reference = LEFT(t.reference, 218) || ':' || t.id::text
+FROM (
+    SELECT id, row_number() OVER (
+        PARTITION BY user_id, type, reference ORDER BY status = 'completed' DESC, created_at, id
+    ) AS n
+    FROM transactions WHERE type <> 'rollback'
+) d
+WHERE t.id = d.id AND d.n > 1;
+
+-- opening balances: the wallet balance a player had before any of our transactions, which the reconciliation
+-- nets transactions from. Players already synced, or with transactions, are baselined on their stored balance.
+UPDATE users u SET opening_balance = u.balance - COALESCE((
+    SELECT SUM(CASE
+        WHEN t.type = 'deposit' THEN t.amount
+        WHEN t.type = 'withdraw' THEN -t.amount
+        WHEN t.type = 'rollback' AND o.type = 'withdraw' THEN t.amount
+        WHEN t.type = 'rollback' THEN -t.amount
+    END)
+    FROM transactions t
+    LEFT JOIN transactions o ON o.id = t.original_transaction_id
+    WHERE t.user_id = u.id AND t.status IN ('completed', 'rolled_back')
+), 0)
+WHERE u.opening_balance IS NULL
+    AND (u.balance_synced_at IS NOT NULL OR EXISTS (SELECT 1 FROM transactions t WHERE t.user_id = u.id));
+
+-- bets table, a bet is placed by a withdraw and settled by a deposit
+CREATE TABLE IF NOT EXISTS bets (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    wallet_bet_id BIGSERIAL UNIQUE,
+    provider_bet_id VARCHAR(255) NOT NULL,
+    withdraw_transaction_id UUID NOT NULL,
+    deposit_transaction_id UUID,
+    stake NUMERIC(19,4) NOT NULL,
+    payout NUMERIC(19,4) NOT NULL DEFAULT 0,
+    currency VARCHAR(3) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    placed_at TIMESTAMP NOT NULL,
+    settled_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (withdraw_transaction_id) REFERENCES transactions(id),
+    FOREIGN KEY (deposit_transaction_id) REFERENCES transactions(id)
+);
+
+-- exchange rates, one unit of base_currency is worth rate units of quote_currency
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    base_currency VARCHAR(3) NOT NULL,
+    quote_currency VARCHAR(3) NOT NULL,
+    rate NUMERIC(20,10) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (base_currency, quote_currency)
+);
+
+-- ledger accounts, one per player and currency plus the house and adjustment accounts of every currency.
+-- Only player accounts keep a running balance, the balance of a system account is the sum of its lines.
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    id UUID PRIMARY KEY,
+    user_id UUID REFERENCES users(id),
+    type VARCHAR(50) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    balance NUMERIC(19,4) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- append-only journal, every entry moves money between accounts and its lines balance
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id UUID PRIMARY KEY,
+    transaction_id UUID REFERENCES transactions(id),
+    description TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS journal_lines (
+    id BIGSERIAL PRIMARY KEY,
+    entry_id UUID NOT NULL REFERENCES journal_entries(id),
+    account_id UUID NOT NULL REFERENCES ledger_accounts(id),
+    debit NUMERIC(19,4) NOT NULL DEFAULT 0 CHECK (debit >= 0),
+    credit NUMERIC(19,4) NOT NULL DEFAULT 0 CHECK (credit >= 0),
+    balance_after NUMERIC(19,4),
+    created_at TIMESTAMP NOT NULL
+);
+
+-- reconciliation runs, comparing every player balance with their transactions and the wallet
+CREATE TABLE IF NOT EXISTS reconciliation_runs (
+    id UUID PRIMARY KEY,
+    status VARCHAR(50) NOT NULL,
+    users_checked INT NOT NULL DEFAULT 0,
+    discrepancies INT NOT NULL DEFAULT 0,
+    error TEXT,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP
+);
+
+-- players whose balances did not match during a reconciliation run
+CREATE TABLE IF NOT EXISTS reconciliation_items (
+    id UUID PRIMARY KEY,
+    run_id UUID NOT NULL REFERENCES reconciliation_runs(id),
+    user_id UUID NOT NULL REFERENCES users(id),
+    wallet_user_id BIGINT NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    stored_balance NUMERIC(19,4) NOT NULL,
+    transactions_balance NUMERIC(19,4) NOT NULL,
+    wallet_balance NUMERIC(19,4),
+    wallet_error TEXT,
+    issues TEXT[] NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+CREATE INDEX IF NOT EXISTS idx_wallet_accounts_available ON wallet_accounts(currency, created_at) WHERE assigned_at IS NULL;
+-- transaction history pages, newest first, see TransactionRepository.List
+CREATE INDEX IF NOT EXISTS idx_transactions_user_created_at ON transactions(user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_transactions_status ON transactions(status);
+CREATE INDEX IF NOT EXISTS idx_transactions_status_updated_at ON transactions(status, updated_at);
+CREATE INDEX IF NOT EXISTS idx_transactions_reference ON transactions(reference);
+CREATE INDEX IF NOT EXISTS idx_transactions_original_transaction_id ON transactions(original_transaction_id);
+-- a provider transaction ID can only be used once per user and transaction type (idempotency key),
+-- rollbacks carry the reference of their original and are keyed on it instead
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_user_type_reference ON transactions(user_id, type, reference) WHERE type <> 'rollback';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_rollback_original ON transactions(original_transaction_id) WHERE type = 'rollback';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_bets_user_provider_bet_id ON bets(user_id, provider_bet_id);
+CREATE INDEX IF NOT EXISTS idx_bets_withdraw_transaction_id ON bets(withdraw_transaction_id);
+CREATE INDEX IF NOT EXISTS idx_bets_deposit_transaction_id ON bets(deposit_transaction_id);
+-- system accounts have no user, they are unique per type and currency
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ledger_accounts_owner ON ledger_accounts((COALESCE(user_id, '00000000-0000-0000-0000-000000000000'::uuid)), type, currency);
+CREATE INDEX IF NOT EXISTS idx_journal_entries_transaction_id ON journal_entries(transaction_id);
+CREATE INDEX IF NOT EXISTS idx_journal_lines_account_created_at ON journal_lines(account_id, created_at, id);
+-- only one reconciliation can run at a time, across all replicas
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reconciliation_runs_running ON reconciliation_runs(status) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS idx_reconciliation_runs_started_at ON reconciliation_runs(started_at);
+CREATE INDEX IF NOT EXISTS idx_reconciliation_items_run_id ON reconciliation_items(run_id);
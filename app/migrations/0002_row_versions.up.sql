@@ -0,0 +1,4 @@
+-- Row versions for optimistic concurrency: every write of a user or a transaction increments its version,
+-- and an update only applies to the version the row was read at.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,9 @@
+package migrations
+
+import "embed"
+
+// FS holds the schema migrations, applied in version order by postgres.Migrator. A migration is a
+// pair of files named <version>_<name>.up.sql and <version>_<name>.down.sql.
+//
+//go:embed *.sql
+var FS embed.FS
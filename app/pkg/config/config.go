@@ -3,6 +3,9 @@ package config
 import (
 	"kentech-project/pkg/logger"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -16,6 +19,56 @@ type Config struct {
 	JWTSecret    string
 	WalletURL    string
 	WalletAPIKey string
+
+	// size of the database connection pool, 0 leaves it unbounded; see postgres.PlayerLocker
+	DatabaseMaxOpenConns int
+	// how long a balance change waits for another one of the same player, see postgres.PlayerLocker
+	PlayerLockTimeout time.Duration
+
+	// wallet retry policy, see wallet.RetryPolicy
+	WalletMaxAttempts       int
+	WalletInitialBackoff    time.Duration
+	WalletMaxBackoff        time.Duration
+	WalletBackoffMultiplier float64
+	WalletRetryJitter       float64
+	WalletAttemptTimeout    time.Duration
+	WalletRetryableStatuses []int
+
+	// wallet circuit breaker, see breaker.Config
+	WalletBreakerWindowSize    int
+	WalletBreakerMinRequests   int
+	WalletBreakerFailureRate   float64
+	WalletBreakerCooldown      time.Duration
+	WalletBreakerHalfOpenCalls int
+
+	// recovery of stuck pending transactions, see service.RecoveryConfig
+	RecoveryEnabled     bool
+	RecoveryInterval    time.Duration
+	RecoveryStaleAfter  time.Duration
+	RecoveryBatchSize   int
+	RecoveryMaxAttempts int
+
+	// FX conversion of game currencies, rates are read from "db", "file" or disabled when empty
+	FXRatesSource string
+	FXRatesFile   string
+	FXSpread      float64
+
+	// balance reconciliation, see service.ReconciliationConfig
+	ReconciliationEnabled   bool
+	ReconciliationInterval  time.Duration
+	ReconciliationBatchSize int
+	ReconciliationTimeout   time.Duration
+
+	// freshness of the player balance, see service.BalancePolicy
+	BalanceMode          string
+	BalanceCacheTTL      time.Duration
+	BalanceFallbackLocal bool
+
+	// key of the admin endpoints, they are disabled when empty
+	AdminAPIKey string
+
+	// apply the pending schema migrations before serving
+	MigrateOnStart bool
 }
 
 func Load() (*Config, error) {
@@ -32,6 +85,46 @@ func Load() (*Config, error) {
 		JWTSecret:    getEnv("JWT_SECRET", "defaultsecretkey"),
 		WalletURL:    getEnv("WALLET_URL", "http://localhost:9090"),
 		WalletAPIKey: getEnv("WALLET_API_KEY", "default"),
+
+		DatabaseMaxOpenConns: getEnvInt("DB_MAX_OPEN_CONNS", 20),
+		PlayerLockTimeout:    getEnvDuration("PLAYER_LOCK_TIMEOUT", 45*time.Second),
+
+		WalletMaxAttempts:       getEnvInt("WALLET_MAX_ATTEMPTS", 3),
+		WalletInitialBackoff:    getEnvDuration("WALLET_INITIAL_BACKOFF", 100*time.Millisecond),
+		WalletMaxBackoff:        getEnvDuration("WALLET_MAX_BACKOFF", 2*time.Second),
+		WalletBackoffMultiplier: getEnvFloat("WALLET_BACKOFF_MULTIPLIER", 2),
+		WalletRetryJitter:       getEnvFloat("WALLET_RETRY_JITTER", 0.2),
+		WalletAttemptTimeout:    getEnvDuration("WALLET_ATTEMPT_TIMEOUT", 10*time.Second),
+		WalletRetryableStatuses: getEnvIntList("WALLET_RETRYABLE_STATUS_CODES", []int{408, 429, 500, 502, 503, 504}),
+
+		WalletBreakerWindowSize:    getEnvInt("WALLET_BREAKER_WINDOW_SIZE", 20),
+		WalletBreakerMinRequests:   getEnvInt("WALLET_BREAKER_MIN_REQUESTS", 10),
+		WalletBreakerFailureRate:   getEnvFloat("WALLET_BREAKER_FAILURE_RATE", 0.5),
+		WalletBreakerCooldown:      getEnvDuration("WALLET_BREAKER_COOLDOWN", 30*time.Second),
+		WalletBreakerHalfOpenCalls: getEnvInt("WALLET_BREAKER_HALF_OPEN_CALLS", 1),
+
+		RecoveryEnabled:     getEnvBool("RECOVERY_ENABLED", true),
+		RecoveryInterval:    getEnvDuration("RECOVERY_INTERVAL", 30*time.Second),
+		RecoveryStaleAfter:  getEnvDuration("RECOVERY_STALE_AFTER", 2*time.Minute),
+		RecoveryBatchSize:   getEnvInt("RECOVERY_BATCH_SIZE", 50),
+		RecoveryMaxAttempts: getEnvInt("RECOVERY_MAX_ATTEMPTS", 10),
+
+		FXRatesSource: getEnv("FX_RATES_SOURCE", ""),
+		FXRatesFile:   getEnv("FX_RATES_FILE", "fx-rates.json"),
+		FXSpread:      getEnvFloat("FX_SPREAD", 0),
+
+		ReconciliationEnabled:   getEnvBool("RECONCILIATION_ENABLED", false),
+		ReconciliationInterval:  getEnvDuration("RECONCILIATION_INTERVAL", 24*time.Hour),
+		ReconciliationBatchSize: getEnvInt("RECONCILIATION_BATCH_SIZE", 100),
+		ReconciliationTimeout:   getEnvDuration("RECONCILIATION_TIMEOUT", time.Hour),
+
+		BalanceMode:          getEnv("BALANCE_MODE", "cached"),
+		BalanceCacheTTL:      getEnvDuration("BALANCE_CACHE_TTL", 30*time.Second),
+		BalanceFallbackLocal: getEnvBool("BALANCE_FALLBACK_LOCAL", true),
+
+		AdminAPIKey: getEnv("ADMIN_API_KEY", ""),
+
+		MigrateOnStart: getEnvBool("MIGRATE_ON_START", false),
 	}
 
 	log.Debugf("Config loaded: %+v", cfg)
@@ -47,3 +140,59 @@ func getEnv(key, defaultValue string) string {
 	log.Warnf("Environment variables not set, using default value for %s: %s", key, defaultValue)
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(getEnv(key, strconv.Itoa(defaultValue)))
+	if err != nil {
+		logger.New().Warnf("Invalid integer for %s, using default value: %d", key, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(getEnv(key, strconv.FormatFloat(defaultValue, 'f', -1, 64)), 64)
+	if err != nil {
+		logger.New().Warnf("Invalid number for %s, using default value: %v", key, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(getEnv(key, strconv.FormatBool(defaultValue)))
+	if err != nil {
+		logger.New().Warnf("Invalid boolean for %s, using default value: %t", key, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, defaultValue.String()))
+	if err != nil {
+		logger.New().Warnf("Invalid duration for %s, using default value: %s", key, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvIntList reads a comma separated list of integers, e.g. "500,502,503".
+func getEnvIntList(key string, defaultValue []int) []int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		logger.New().Warnf("Environment variables not set, using default value for %s: %v", key, defaultValue)
+		return defaultValue
+	}
+
+	values := make([]int, 0)
+	for _, part := range strings.Split(raw, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			logger.New().Warnf("Invalid integer list for %s, using default value: %v", key, defaultValue)
+			return defaultValue
+		}
+		values = append(values, value)
+	}
+	return values
+}
@@ -67,3 +67,8 @@ func (l *Logger) Warnf(format string, args ...interface{}) {
 func (l *Logger) Debugf(format string, args ...interface{}) {
 	l.sugar.Debugf(format, args...)
 }
+
+// Warnw logs a message with additional key/value pairs as structured fields.
+func (l *Logger) Warnw(message string, keysAndValues ...interface{}) {
+	l.sugar.Warnw(message, keysAndValues...)
+}
@@ -1,31 +0,0 @@
--- users table
-CREATE TABLE IF NOT EXISTS users (
-    id UUID PRIMARY KEY,
-    wallet_user_id BIGINT UNIQUE NOT NULL,
-    username VARCHAR(255) UNIQUE NOT NULL,
-    email VARCHAR(255) UNIQUE NOT NULL,
-    password VARCHAR(255) NOT NULL,
-    balance DECIMAL(10,2) DEFAULT 0.00,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
--- transactions table
-CREATE TABLE IF NOT EXISTS transactions (
-    id UUID PRIMARY KEY,
-    user_id UUID NOT NULL,
-    type VARCHAR(50) NOT NULL,
-    amount DECIMAL(10,2) NOT NULL,
-    status VARCHAR(50) NOT NULL,
-    reference VARCHAR(255),
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id)
-);
-
--- Indexes
-CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
-CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
-CREATE INDEX IF NOT EXISTS idx_transactions_user_id ON transactions(user_id);
-CREATE INDEX IF NOT EXISTS idx_transactions_status ON transactions(status);
-CREATE INDEX IF NOT EXISTS idx_transactions_reference ON transactions(reference);
@@ -0,0 +1,16 @@
+-- Local development data, loaded by docker-compose once the migrations are applied.
+
+-- accounts of the local wallet
+INSERT INTO wallet_accounts (wallet_user_id, currency) VALUES
+    (34633089486, 'USD'),
+    (34679664254, 'EUR'),
+    (34616761765, 'KES'),
+    (34673635133, 'USD')
+ON CONFLICT DO NOTHING;
+
+-- local development rates
+INSERT INTO exchange_rates (base_currency, quote_currency, rate) VALUES
+    ('EUR', 'USD', 1.0850),
+    ('USD', 'KES', 129.2500),
+    ('EUR', 'KES', 140.2300)
+ON CONFLICT DO NOTHING;